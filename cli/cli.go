@@ -0,0 +1,82 @@
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sfgo/config"
+	"sfgo/core/snowflake"
+	"strings"
+)
+
+const usage = `usage: sfgo [command] [options]
+
+commands:
+  serve [options]            启动服务，未指定命令时默认执行，options 为配置项的命令行参数，sfgo serve -h 列出全部参数
+  parse [options] [id...]    解析id的时间戳、workerId、序列号，未指定id时从标准输入逐行读取
+  gen [options]              离线生成id，输出到标准输出或文件，e.g. -n 1000 -worker 5，options 也包括配置项的命令行参数
+  workers list|expire|release [options]
+                             查看、回收、释放workerId分配记录，options 也包括配置项的命令行参数
+  config check [options]     校验配置并输出生效的配置及其来源
+  help                       输出本帮助
+`
+
+// Run 执行命令，返回退出码，0为成功，1为执行失败，2为参数或配置无效
+//
+// args 命令行参数，不包括程序名称，为空或以 - 开头时执行serve，兼容旧版本的启动方式
+func Run(args []string) int {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return runServe(args)
+	}
+	switch args[0] {
+	case "serve":
+		return runServe(args[1:])
+	case "parse":
+		return runParse(args[1:])
+	case "gen":
+		return runGen(args[1:])
+	case "workers":
+		return runWorkers(args[1:])
+	case "config":
+		return runConfig(args[1:])
+	case "help":
+		fmt.Print(usage)
+		return 0
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n%s", args[0], usage)
+		return 2
+	}
+}
+
+// loadConfig 读取配置并设置snowflake的配置，与服务共用，返回不为0时为退出码
+//
+// fs 不为nil时，配置项的命令行参数注册到fs，与子命令自己的参数一起解析
+func loadConfig(fs *flag.FlagSet, args []string) (*config.Config, int) {
+	var cfg *config.Config
+	var err error
+	if fs == nil {
+		cfg, err = config.Load(args)
+	} else {
+		cfg, err = config.LoadFlags(fs, args)
+	}
+	if errors.Is(err, flag.ErrHelp) {
+		return nil, 0
+	}
+	if err == nil {
+		err = snowflake.Configure(cfg.Snowflake)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return nil, 2
+	}
+	return cfg, 0
+}
+
+// exitCode 解析命令行参数失败时的退出码，-h 时为0
+func exitCode(err error) int {
+	if errors.Is(err, flag.ErrHelp) {
+		return 0
+	}
+	return 2
+}
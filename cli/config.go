@@ -0,0 +1,26 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+)
+
+const configUsage = `usage: sfgo config check [options]
+
+  校验配置，options 与 sfgo serve 相同，配置有效时输出生效的配置及其来源，无效时列出所有原因，退出码为2
+`
+
+// runConfig 执行config命令，与服务使用相同的方式读取、校验配置
+func runConfig(args []string) int {
+	if len(args) < 1 || args[0] != "check" {
+		fmt.Fprint(os.Stderr, configUsage)
+		return 2
+	}
+	cfg, code := loadConfig(nil, args[1:])
+	if cfg == nil {
+		return code
+	}
+	cfg.Print(os.Stdout)
+	fmt.Println("config is valid.")
+	return 0
+}
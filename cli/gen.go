@@ -0,0 +1,250 @@
+package cli
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sfgo/common/convutil"
+	"sfgo/config"
+	"sfgo/core"
+	"sfgo/core/snowflake"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 输出格式
+const (
+	formatText   = "text"
+	formatCsv    = "csv"
+	formatBinary = "binary"
+)
+
+// runGen 离线生成id，未指定 -timestamps 时使用当前时间，否则按文件中的历史时间生成id，用于数据迁移
+//
+// workerId不经过WorkerIdProvider分配，生成前通过WorkerIdProvider确认workerId没有被分配给运行中的实例，否则可能生成重复的id
+func runGen(args []string) int {
+	fs := flag.NewFlagSet("gen", flag.ContinueOnError)
+	n := fs.Int64("n", 1, "生成id的数量，未指定 -timestamps 时生效")
+	workerId := fs.Int64("worker", -1, fmt.Sprintf("workerId，0到%d，未指定 -timestamps 时生效", snowflake.MaxWorkerId()))
+	timestamps := fs.String("timestamps", "", "时间戳文件，每行一个，为 - 时从标准输入读取，可以在 -window 内乱序，格式为毫秒时间戳或日期时间，e.g. 2021-03-01 08:00:00.123")
+	window := fs.Duration("window", snowflake.DefaultOfflineWindow, "时间戳可以比已出现的最大时间戳早的时长，每毫秒占用12字节内存，输入已排序时可以设置为1ms，指定 -timestamps 时生效")
+	workers := fs.String("workers", "", "为迁移保留的workerId，e.g. 1000-1023 或 5,7，指定 -timestamps 时生效")
+	location := fs.String("tz", "Local", "日期时间未带时区时使用的时区，e.g. Asia/Shanghai")
+	format := fs.String("format", formatText, "输出格式，text 每行一个id，csv 每行为 时间戳,id，binary 每个id为8字节大端序整数")
+	output := fs.String("o", "", "输出文件，为空时输出到标准输出")
+	skipLiveCheck := fs.Bool("skip-live-check", false, "不检查workerId是否已被分配，WorkerIdProvider不支持列出分配记录时（如环境变量、hostname）需要指定")
+	// 与服务相同的配置项参数，用于检查workerId是否已被分配
+	cfg, code := loadConfig(fs, args)
+	if cfg == nil {
+		return code
+	}
+	if fs.NArg() > 0 {
+		fmt.Fprintf(os.Stderr, "unexpected arguments: %v\n", fs.Args())
+		return 2
+	}
+	if *format != formatText && *format != formatCsv && *format != formatBinary {
+		fmt.Fprintf(os.Stderr, "-format must be one of text, csv, binary, got %q\n", *format)
+		return 2
+	}
+	var workerIds []int64
+	if *timestamps != "" {
+		var err error
+		if workerIds, err = snowflake.ParseWorkerIds(*workers); err != nil {
+			fmt.Fprintf(os.Stderr, "-workers is invalid: %s\n", err.Error())
+			return 2
+		}
+	} else {
+		if *n < 1 {
+			fmt.Fprintf(os.Stderr, "-n must be greater than 0, got %d\n", *n)
+			return 2
+		}
+		if *workerId < 0 || *workerId > snowflake.MaxWorkerId() {
+			fmt.Fprintf(os.Stderr, "-worker must between 0 and %d, got %d\n", snowflake.MaxWorkerId(), *workerId)
+			return 2
+		}
+		workerIds = []int64{*workerId}
+	}
+	if !*skipLiveCheck {
+		if code := checkWorkerIds(cfg, workerIds); code != 0 {
+			return code
+		}
+	}
+
+	var out io.Writer = os.Stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		defer f.Close()
+		out = f
+	}
+	w := newIdWriter(out, *format)
+	var count int64
+	var err error
+	if *timestamps != "" {
+		count, err = genHistorical(w, *timestamps, *location, workerIds, *window)
+	} else {
+		count, err = genCurrent(w, *n, *workerId)
+	}
+	// 出错时也输出已生成的id，与出错之前的输入一一对应
+	if flushErr := w.flush(); err == nil {
+		err = flushErr
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if *output != "" {
+		fmt.Fprintf(os.Stderr, "%d ids written to %s\n", count, *output)
+	}
+	return 0
+}
+
+// checkWorkerIds 确认workerId没有被WorkerIdProvider分配，未保留时提示保留，避免迁移期间被分配给新实例
+//
+// WorkerIdProvider不支持列出分配记录时（如环境变量、hostname）无法确认，返回失败，需要确认后使用 -skip-live-check
+func checkWorkerIds(cfg *config.Config, workerIds []int64) int {
+	provider, err := snowflake.GetWorkerProvider()
+	if err == nil {
+		err = snowflake.CheckWorkerIdsNotAllocated(provider, cfg.AppName, workerIds)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\nuse -skip-live-check if you are sure the worker ids are not in use\n", err.Error())
+		return 1
+	}
+	admin, ok := provider.(snowflake.WorkerIdAdmin)
+	if !ok {
+		return 0
+	}
+	reservations, err := admin.ListReservations(cfg.AppName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "list reservations failed. %s\n", err.Error())
+		return 1
+	}
+	reserved := make(map[int64]bool, len(reservations))
+	for _, r := range reservations {
+		reserved[r.WorkerId] = true
+	}
+	for _, workerId := range workerIds {
+		if !reserved[workerId] {
+			fmt.Fprintf(os.Stderr, "warning: worker id %d is not reserved and may be allocated to a new instance, reserve it with PUT /admin/workers/reservations/%d\n", workerId, workerId)
+		}
+	}
+	return 0
+}
+
+// genCurrent 使用当前时间生成n个id
+func genCurrent(w *idWriter, n, workerId int64) (int64, error) {
+	sf := snowflake.NewSnowflake(workerId)
+	for i := int64(0); i < n; i++ {
+		id, err := sf.GetId()
+		if err != nil {
+			// 序列号用完或时钟回拨时等待后重试
+			if e, ok := core.AsError(err); ok && e.RetryAfter > 0 {
+				time.Sleep(e.RetryAfter)
+				i--
+				continue
+			}
+			return i, err
+		}
+		parts, _ := snowflake.DefaultLayout.Decompose(id)
+		if err = w.write(id, strconv.FormatInt(parts.Timestamp, 10)); err != nil {
+			return i, err
+		}
+	}
+	return n, nil
+}
+
+// genHistorical 按文件中的时间戳生成id，每个时间戳一个id，输出顺序与文件相同
+func genHistorical(w *idWriter, path, location string, workerIds []int64, window time.Duration) (int64, error) {
+	loc, err := time.LoadLocation(location)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time zone %q", location)
+	}
+	generator, err := snowflake.NewOfflineGeneratorWithWindow(workerIds, window)
+	if err != nil {
+		return 0, err
+	}
+	var in io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return 0, err
+		}
+		defer f.Close()
+		in = f
+	}
+	var count, line int64
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		line++
+		raw := strings.TrimSpace(scanner.Text())
+		if raw == "" {
+			continue
+		}
+		t, err := convutil.ParseTime(raw, loc)
+		if err != nil {
+			return count, fmt.Errorf("line %d: %s", line, err.Error())
+		}
+		id, err := generator.Generate(t.UnixMilli())
+		if err != nil {
+			return count, fmt.Errorf("line %d: %s", line, err.Error())
+		}
+		if err = w.write(id, raw); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, scanner.Err()
+}
+
+// idWriter 按格式输出id
+type idWriter struct {
+	format string
+	w      *bufio.Writer
+	csv    *csv.Writer
+	buf    []byte
+}
+
+func newIdWriter(out io.Writer, format string) *idWriter {
+	w := &idWriter{format: format, w: bufio.NewWriter(out), buf: make([]byte, 0, 24)}
+	if format == formatCsv {
+		w.csv = csv.NewWriter(w.w)
+	}
+	return w
+}
+
+// write 输出id，timestamp 为csv格式中的时间戳列，为输入的原始值
+func (w *idWriter) write(id int64, timestamp string) error {
+	switch w.format {
+	case formatCsv:
+		return w.csv.Write([]string{timestamp, strconv.FormatInt(id, 10)})
+	case formatBinary:
+		w.buf = binary.BigEndian.AppendUint64(w.buf[:0], uint64(id))
+	default:
+		w.buf = append(strconv.AppendInt(w.buf[:0], id, 10), '\n')
+	}
+	_, err := w.w.Write(w.buf)
+	return err
+}
+
+func (w *idWriter) flush() error {
+	if w.csv != nil {
+		w.csv.Flush()
+		if err := w.csv.Error(); err != nil {
+			return err
+		}
+	}
+	if err := w.w.Flush(); err != nil {
+		return errors.New("write output failed. " + err.Error())
+	}
+	return nil
+}
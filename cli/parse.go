@@ -0,0 +1,80 @@
+package cli
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sfgo/core/idcodec"
+	"sfgo/core/snowflake"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// runParse 解析id的时间戳、workerId、序列号，未指定id时从标准输入逐行读取，有无效的id时退出码为1
+//
+// id可以为十进制、base62、base32、base58形式，未指定 -encoding 时识别编码方式，无法区分时输出所有可能的结果
+func runParse(args []string) int {
+	fs := flag.NewFlagSet("parse", flag.ContinueOnError)
+	layoutName := fs.String("layout", snowflake.DefaultLayout.Name(), "位分配方式，格式为 时间戳位数-workerId位数-序列号位数")
+	epoch := fs.Int64("epoch", snowflake.DefaultLayout.Epoch, "起始时间戳，单位ms")
+	asJson := fs.Bool("json", false, "以json格式输出")
+	encoding := fs.String("encoding", "", "id的编码方式，"+strings.Join(idcodec.Names(), ", ")+"，为空时识别编码方式")
+	if err := fs.Parse(args); err != nil {
+		return exitCode(err)
+	}
+	layout, err := snowflake.ParseLayout(*layoutName, *epoch)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	ids := fs.Args()
+	if len(ids) == 0 {
+		if ids, err = readLines(os.Stdin); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+	code := 0
+	parts := make([]snowflake.ParsedId, 0, len(ids))
+	for _, raw := range ids {
+		p, err := layout.ParseAny(raw, *encoding)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid id %q: %s\n", raw, err.Error())
+			code = 1
+			continue
+		}
+		parts = append(parts, p...)
+	}
+	printIdParts(parts, *asJson)
+	return code
+}
+
+func printIdParts(parts []snowflake.ParsedId, asJson bool) {
+	if asJson {
+		v, _ := json.MarshalIndent(parts, "", "  ")
+		fmt.Println(string(v))
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "INPUT\tENCODING\tID\tTIME\tTIMESTAMP\tWORKER ID\tSEQUENCE")
+	for _, p := range parts {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%d\t%d\t%d\n", p.Input, p.Encoding, p.Id, time.UnixMilli(p.Timestamp).Format("2006-01-02 15:04:05.000"), p.Timestamp, p.WorkerId, p.Sequence)
+	}
+	w.Flush()
+}
+
+// readLines 读取非空行
+func readLines(r io.Reader) ([]string, error) {
+	lines := make([]string, 0)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines, scanner.Err()
+}
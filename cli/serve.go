@@ -0,0 +1,25 @@
+package cli
+
+import (
+	"log"
+	"sfgo/config"
+	"sfgo/discovery"
+	"sfgo/web"
+)
+
+// runServe 启动服务，收到SIGINT、SIGTERM后停止
+func runServe(args []string) int {
+	cfg, code := loadConfig(nil, args)
+	if cfg == nil {
+		return code
+	}
+	cfg.Log()
+	log.Println("server start.")
+	discovery.AutoRegister(cfg.Discovery, cfg.AppName, cfg.Server.Port)
+	discovery.EnableRaftPeerDiscovery()
+	discovery.EnableWorkerIdRegistry()
+	manager := config.NewManager(cfg, args)
+	manager.Watch()
+	web.Run(manager)
+	return 0
+}
@@ -0,0 +1,111 @@
+package cli
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sfgo/core/snowflake"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+const workersUsage = `usage: sfgo workers <command> [options]
+
+commands:
+  list                       列出workerId分配记录
+  expire [-older-than 24h]   回收长时间未上报时间戳的workerId，默认使用 ZOOKEEPER_RECYCLE_AFTER 或 RAFT_RECYCLE_AFTER
+  release [-force] <workerId>
+                             释放workerId，默认仅释放长时间未上报时间戳的workerId，-force 时强制释放，占用者将停止发放id
+
+options 还包括 -json 及与 sfgo serve 相同的配置项参数（如 -config、-woker-id-provider），配置的读取方式与服务相同
+`
+
+// runWorkers 执行workers命令，用于查看、回收、释放应用的workerId分配记录
+func runWorkers(args []string) int {
+	if len(args) < 1 {
+		fmt.Fprint(os.Stderr, workersUsage)
+		return 2
+	}
+	// 先确认命令有效，再读取配置、创建WorkerIdProvider
+	fs := flag.NewFlagSet("workers "+args[0], flag.ContinueOnError)
+	asJson := fs.Bool("json", false, "以json格式输出")
+	var olderThan *time.Duration
+	var force *bool
+	switch args[0] {
+	case "list":
+	case "expire":
+		olderThan = fs.Duration("older-than", 0, "回收超过该时长未上报时间戳的workerId")
+	case "release":
+		force = fs.Bool("force", false, "强制释放仍在上报时间戳的workerId")
+	default:
+		fmt.Fprint(os.Stderr, workersUsage)
+		return 2
+	}
+	cfg, code := loadConfig(fs, args[1:])
+	if cfg == nil {
+		return code
+	}
+	var workerId int64
+	if args[0] == "release" {
+		var err error
+		if workerId, err = strconv.ParseInt(fs.Arg(0), 10, 64); fs.NArg() != 1 || err != nil {
+			fmt.Fprint(os.Stderr, workersUsage)
+			return 2
+		}
+	} else if fs.NArg() > 0 {
+		fmt.Fprintf(os.Stderr, "unexpected arguments: %v\n", fs.Args())
+		return 2
+	}
+	appName := cfg.AppName
+	provider, err := snowflake.GetWorkerProvider()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	recycler, ok := provider.(snowflake.WorkerIdRecycler)
+	if !ok {
+		fmt.Fprintln(os.Stderr, "the worker id provider doesn't support listing or expiring allocations")
+		return 1
+	}
+	var allocations []snowflake.WorkerIdAllocation
+	switch args[0] {
+	case "list":
+		allocations, err = recycler.ListAllocations(appName)
+	case "expire":
+		allocations, err = recycler.ExpireStaleAllocations(appName, *olderThan)
+	case "release":
+		admin, ok := provider.(snowflake.WorkerIdAdmin)
+		if !ok {
+			fmt.Fprintln(os.Stderr, "the worker id provider doesn't support releasing allocations")
+			return 1
+		}
+		var allocation snowflake.WorkerIdAllocation
+		if allocation, err = admin.ReleaseAllocation(appName, workerId, *force); err == nil {
+			allocations = []snowflake.WorkerIdAllocation{allocation}
+		}
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	printAllocations(allocations, *asJson)
+	return 0
+}
+
+func printAllocations(allocations []snowflake.WorkerIdAllocation, asJson bool) {
+	if asJson {
+		v, _ := json.MarshalIndent(allocations, "", "  ")
+		fmt.Println(string(v))
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "WORKER ID\tOWNER\tLAST TIMESTAMP\tAGE\tSTALE\tPATH")
+	now := time.Now()
+	for _, a := range allocations {
+		last := time.UnixMilli(a.Timestamp)
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%v\t%s\n", a.WorkerId, a.Owner, last.Format("2006-01-02 15:04:05"), now.Sub(last).Truncate(time.Second), a.Stale, a.Path)
+	}
+	w.Flush()
+}
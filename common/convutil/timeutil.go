@@ -0,0 +1,23 @@
+package convutil
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// 日期时间支持的格式，未带时区时使用指定的时区
+var timeLayouts = []string{time.RFC3339Nano, "2006-01-02 15:04:05.999999999", "2006-01-02T15:04:05.999999999", "2006-01-02"}
+
+// ParseTime 解析毫秒时间戳或日期时间，e.g. 1614556800123、2021-03-01T08:00:00+08:00、2021-03-01 08:00:00.123，未带时区时使用loc
+func ParseTime(raw string, loc *time.Location) (time.Time, error) {
+	if ms, err := strconv.ParseInt(raw, 10, 64); err == nil {
+		return time.UnixMilli(ms), nil
+	}
+	for _, layout := range timeLayouts {
+		if t, err := time.ParseInLocation(layout, raw, loc); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q, must be milliseconds or date time like 2006-01-02 15:04:05.000", raw)
+}
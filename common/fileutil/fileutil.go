@@ -1,6 +1,9 @@
 package fileutil
 
-import "os"
+import (
+	"os"
+	"path/filepath"
+)
 
 // Exists 判断文件是否存在
 func Exists(path string) bool {
@@ -10,3 +13,36 @@ func Exists(path string) bool {
 	}
 	return true
 }
+
+// WriteFileAtomic 原子地写入文件，先写入同目录下的临时文件并fsync，再重命名为目标文件，写入过程中进程退出不会留下不完整的文件
+func WriteFileAtomic(path string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+	f, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := f.Name()
+	// 失败时删除临时文件
+	defer os.Remove(tmpPath)
+	if _, err = f.Write(data); err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if err = os.Chmod(tmpPath, perm); err != nil {
+		return err
+	}
+	if err = os.Rename(tmpPath, path); err != nil {
+		return err
+	}
+	// fsync目录，保证重命名已持久化
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"sfgo/core/snowflake"
+	"sfgo/discovery"
+	"sfgo/web/handler/id"
+	"strconv"
+	"strings"
+)
+
+// Config 服务的全部配置，由Load从配置文件、环境变量及命令行参数读取，各部分配置传给对应的模块
+//
+// 标签 yaml toml 为配置文件中的名称，env 为环境变量名称，以 _* 结尾时为前缀，desc 为说明，secret 为true时输出配置时隐藏，reload 为true时可以在运行时修改
+type Config struct {
+	// 应用名称，同时也是注册到Nacos的微服务名称，用于区分workerId所属的应用
+	AppName string `yaml:"appName" toml:"appName" env:"DISCOVERY_MICROSRV_NAME" desc:"应用名称，同时也是注册到Nacos的微服务名称"`
+	// 配置文件修改后自动重新加载，收到SIGHUP时也会重新加载
+	ConfigWatchInterval int64            `yaml:"configWatchInterval" toml:"configWatchInterval" env:"SFGO_CONFIG_WATCH_INTERVAL" desc:"检查配置文件是否修改的间隔，单位ms，小于等于0时不检查"`
+	Server              ServerConfig     `yaml:"server" toml:"server"`
+	Id                  id.Config        `yaml:"id" toml:"id"`
+	Discovery           discovery.Config `yaml:"discovery" toml:"discovery"`
+	Snowflake           snowflake.Config `yaml:"snowflake" toml:"snowflake"`
+	// 配置文件路径，由Load设置
+	file string
+	// 各配置项及其来源，由Load设置
+	settings []*setting
+}
+
+// ServerConfig Web服务的配置
+type ServerConfig struct {
+	Port       string `yaml:"port" toml:"port" env:"SERVER_PORT" desc:"服务端口"`
+	AdminToken string `yaml:"adminToken" toml:"adminToken" env:"ADMIN_TOKEN" secret:"true" reload:"true" desc:"管理接口 /admin 的令牌，为空时禁用管理接口"`
+}
+
+// Default 默认配置
+func Default() *Config {
+	return &Config{
+		AppName:             "id-generator",
+		ConfigWatchInterval: 5000,
+		Server: ServerConfig{
+			Port: "8074",
+		},
+		Id:        id.DefaultConfig(),
+		Discovery: discovery.DefaultConfig(),
+		Snowflake: snowflake.DefaultConfig(),
+	}
+}
+
+// Validate 校验配置，返回所有无效的配置项
+func (c *Config) Validate() error {
+	problems := make([]string, 0)
+	if c.AppName == "" {
+		problems = append(problems, "DISCOVERY_MICROSRV_NAME can't be empty")
+	}
+	if port, err := strconv.Atoi(c.Server.Port); err != nil || port < 1 || port > 65535 {
+		problems = append(problems, fmt.Sprintf("SERVER_PORT must between 1 and 65535, got %q", c.Server.Port))
+	}
+	if len(c.Id.JsSafeTagList()) > 0 && !c.Snowflake.JsSafe {
+		problems = append(problems, "ID_JS_SAFE_TAGS requires SNOWFLAKE_JS_SAFE=true")
+	}
+	for _, err := range []error{c.Id.Validate(), c.Discovery.Validate(), c.Snowflake.Validate()} {
+		if err != nil {
+			problems = append(problems, strings.Split(err.Error(), "\n")...)
+		}
+	}
+	if len(problems) > 0 {
+		return errors.New("invalid config:\n  " + strings.Join(problems, "\n  "))
+	}
+	return nil
+}
@@ -0,0 +1,442 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sfgo/core/snowflake"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v2"
+)
+
+// 配置文件路径的环境变量，也可以通过命令行参数 -config 指定，文件格式根据扩展名判断，支持 .yaml .yml .toml
+const configFileEnv = "SFGO_CONFIG"
+
+// 配置值的来源，优先级从低到高
+const (
+	SourceDefault = "default"
+	SourceFile    = "file"
+	SourceEnv     = "env"
+	SourceFlag    = "flag"
+)
+
+// setting 配置项，对应Config中带有env标签的字段，或者WorkerIdProvider声明的配置项
+type setting struct {
+	// 配置文件中的路径，e.g. snowflake.gossip.enabled
+	key string
+	// 环境变量名称，prefix为true时为前缀，e.g. ID_MAX_BATCH_SIZE_
+	env    string
+	prefix bool
+	desc   string
+	secret bool
+	// 是否可以在运行时修改
+	reload bool
+	value  reflect.Value
+	// 不为空时，value为map，配置值为其中mapKey的值，未设置时为mapDefault，用于WorkerIdProvider的配置项
+	mapKey     string
+	mapDefault string
+	source     string
+}
+
+// flagName 命令行参数名称，为环境变量名称的小写形式，e.g. -server-port
+func (s *setting) flagName() string {
+	return strings.ToLower(strings.ReplaceAll(s.env, "_", "-"))
+}
+
+func (s *setting) set(raw string) error {
+	if s.mapKey != "" {
+		return setMapEntry(s.value, s.mapKey, raw)
+	}
+	return setValue(s.value, raw)
+}
+
+// display 输出的值，敏感信息隐藏
+func (s *setting) display() string {
+	value := s.String()
+	if s.secret && value != "" {
+		return "******"
+	}
+	return value
+}
+
+func (s *setting) String() string {
+	if s.mapKey != "" {
+		if v := s.value.MapIndex(reflect.ValueOf(s.mapKey)); v.IsValid() {
+			return v.String()
+		}
+		return s.mapDefault
+	}
+	return formatValue(s.value)
+}
+
+// Load 读取配置，优先级从高到低为 命令行参数、环境变量、配置文件、默认值，配置无效时返回所有无效的配置项
+//
+// args 命令行参数，不包括程序名称，-h 时返回 flag.ErrHelp
+func Load(args []string) (*Config, error) {
+	fs := flag.NewFlagSet("sfgo", flag.ContinueOnError)
+	cfg, err := LoadFlags(fs, args)
+	if err != nil {
+		return nil, err
+	}
+	if fs.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected arguments: %s", strings.Join(fs.Args(), " "))
+	}
+	return cfg, nil
+}
+
+// LoadFlags 与Load相同，配置项的命令行参数注册到fs，用于子命令在fs中预先定义自己的参数，
+// 解析后子命令的参数及剩余的位置参数从fs获取
+func LoadFlags(fs *flag.FlagSet, args []string) (*Config, error) {
+	cfg := Default()
+	settings := collectSettings(reflect.ValueOf(cfg).Elem(), "")
+	settings = append(settings, providerOptionSettings(cfg)...)
+	for _, s := range settings {
+		s.source = SourceDefault
+	}
+
+	configFile := fs.String("config", os.Getenv(configFileEnv), "配置文件路径，支持 .yaml .yml .toml，也可以通过环境变量 "+configFileEnv+" 指定")
+	flagValues := make(map[string]*flagValue)
+	for _, s := range settings {
+		if s.prefix {
+			continue
+		}
+		fv := &flagValue{value: s.String(), isBool: s.value.Kind() == reflect.Bool}
+		if s.secret {
+			fv.value = ""
+		}
+		flagValues[s.flagName()] = fv
+		fs.Var(fv, s.flagName(), fmt.Sprintf("%s (env %s)", s.desc, s.env))
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	problems := make([]string, 0)
+	if *configFile != "" {
+		keys, err := loadFile(*configFile, cfg)
+		if err != nil {
+			return nil, fmt.Errorf("load config file %s failed. %w", *configFile, err)
+		}
+		for _, s := range settings {
+			if keys[s.key] {
+				s.source = SourceFile
+			}
+		}
+	}
+	environ := os.Environ()
+	for _, s := range settings {
+		if s.prefix {
+			for _, kv := range environ {
+				name, raw, _ := strings.Cut(kv, "=")
+				if !strings.HasPrefix(name, s.env) || name == s.env {
+					continue
+				}
+				key := strings.ToLower(strings.TrimPrefix(name, s.env))
+				if err := setMapEntry(s.value, key, raw); err != nil {
+					problems = append(problems, fmt.Sprintf("environment variable %s=%s is invalid: %s", name, raw, err.Error()))
+					continue
+				}
+				s.source = SourceEnv
+			}
+			continue
+		}
+		// 设置为空字符串也生效，e.g. 清空配置文件中的密码，非字符串的配置项为空时视为无效
+		raw, ok := os.LookupEnv(s.env)
+		if !ok {
+			continue
+		}
+		if err := s.set(raw); err != nil {
+			problems = append(problems, fmt.Sprintf("environment variable %s=%s is invalid: %s", s.env, raw, err.Error()))
+			continue
+		}
+		s.source = SourceEnv
+	}
+	fs.Visit(func(f *flag.Flag) {
+		for _, s := range settings {
+			if !s.prefix && s.flagName() == f.Name {
+				if err := s.set(flagValues[f.Name].value); err != nil {
+					problems = append(problems, fmt.Sprintf("flag -%s=%s is invalid: %s", f.Name, flagValues[f.Name].value, err.Error()))
+					return
+				}
+				s.source = SourceFlag
+			}
+		}
+	})
+	if len(problems) > 0 {
+		return nil, errors.New("invalid config:\n  " + strings.Join(problems, "\n  "))
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	cfg.file = *configFile
+	cfg.settings = settings
+	return cfg, nil
+}
+
+// Setting 配置项的当前值及其来源
+type Setting struct {
+	Key string `json:"key"`
+	Env string `json:"env"`
+	// 敏感信息隐藏为 ******
+	Value      string `json:"value"`
+	Source     string `json:"source"`
+	Reloadable bool   `json:"reloadable"`
+}
+
+// File 配置文件路径，未使用配置文件时为空
+func (c *Config) File() string {
+	return c.file
+}
+
+// Settings 各配置项的当前值，敏感信息隐藏，仅包括当前分配方式的配置项，及其它已设置的配置项
+func (c *Config) Settings() []Setting {
+	providers := make(map[string]bool)
+	for _, name := range c.Snowflake.ProviderNameList() {
+		options, _ := snowflake.ProviderOptions(name)
+		for _, option := range options {
+			providers[option.Name] = true
+		}
+	}
+	settings := make([]Setting, 0, len(c.settings))
+	for _, s := range c.settings {
+		if s.mapKey != "" && !providers[s.mapKey] && s.source == SourceDefault {
+			continue
+		}
+		env := s.env
+		if s.prefix {
+			env += "*"
+		}
+		settings = append(settings, Setting{Key: s.key, Env: env, Value: s.display(), Source: s.source, Reloadable: s.reload})
+	}
+	return settings
+}
+
+// Print 输出配置及其来源，敏感信息隐藏
+func (c *Config) Print(w io.Writer) {
+	for _, s := range c.Settings() {
+		fmt.Fprintf(w, "  %s = %s (%s)\n", s.Key, s.Value, s.Source)
+	}
+}
+
+// Log 输出配置到日志
+func (c *Config) Log() {
+	var b strings.Builder
+	c.Print(&b)
+	log.Printf("config:\n%s", b.String())
+}
+
+// collectSettings 收集带有env标签的字段
+func collectSettings(v reflect.Value, prefix string) []*setting {
+	settings := make([]*setting, 0)
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		key := field.Tag.Get("yaml")
+		if key == "" || key == "-" {
+			continue
+		}
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+		env := field.Tag.Get("env")
+		if env == "" {
+			if field.Type.Kind() == reflect.Struct {
+				settings = append(settings, collectSettings(v.Field(i), key)...)
+			}
+			continue
+		}
+		s := &setting{
+			key:    key,
+			env:    env,
+			desc:   field.Tag.Get("desc"),
+			secret: field.Tag.Get("secret") == "true",
+			reload: field.Tag.Get("reload") == "true",
+			value:  v.Field(i),
+		}
+		if strings.HasSuffix(env, "_*") {
+			s.env = strings.TrimSuffix(env, "*")
+			s.prefix = true
+		}
+		settings = append(settings, s)
+	}
+	return settings
+}
+
+// providerOptionSettings 各WorkerIdProvider声明的配置项，配置文件中为 snowflake.providerOptions.<配置项名称>
+func providerOptionSettings(cfg *Config) []*setting {
+	settings := make([]*setting, 0)
+	seen := make(map[string]bool)
+	options := reflect.ValueOf(&cfg.Snowflake.ProviderOptions).Elem()
+	for _, name := range snowflake.ProviderNames() {
+		providerOptions, _ := snowflake.ProviderOptions(name)
+		for _, option := range providerOptions {
+			if seen[option.Name] {
+				continue
+			}
+			seen[option.Name] = true
+			settings = append(settings, &setting{
+				key:        "snowflake.providerOptions." + option.Name,
+				env:        option.Name,
+				desc:       fmt.Sprintf("%s: %s", name, option.Description),
+				secret:     option.Secret,
+				value:      options,
+				mapKey:     option.Name,
+				mapDefault: option.Default,
+			})
+		}
+	}
+	return settings
+}
+
+// loadFile 读取配置文件，不允许未知的配置项，返回配置文件中出现的配置项路径
+func loadFile(path string, cfg *Config) (map[string]bool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	raw := make(map[string]any)
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		if err = yaml.UnmarshalStrict(data, cfg); err != nil {
+			return nil, err
+		}
+		err = yaml.Unmarshal(data, &raw)
+	case ".toml":
+		decoder := toml.NewDecoder(strings.NewReader(string(data)))
+		decoder.DisallowUnknownFields()
+		if err = decoder.Decode(cfg); err != nil {
+			var strictErr *toml.StrictMissingError
+			if errors.As(err, &strictErr) {
+				return nil, errors.New(strictErr.String())
+			}
+			return nil, err
+		}
+		err = toml.Unmarshal(data, &raw)
+	default:
+		return nil, fmt.Errorf("unsupported config file format %q, use .yaml .yml or .toml", filepath.Ext(path))
+	}
+	if err != nil {
+		return nil, err
+	}
+	keys := make(map[string]bool)
+	flattenKeys(raw, "", keys)
+	return keys, nil
+}
+
+// flattenKeys 收集配置文件中的配置项路径，包括中间路径，e.g. snowflake snowflake.gossip snowflake.gossip.enabled
+func flattenKeys(value any, prefix string, keys map[string]bool) {
+	switch m := value.(type) {
+	case map[string]any:
+		for k, v := range m {
+			flattenKeys(v, joinKey(prefix, k), keys)
+		}
+	case map[any]any:
+		for k, v := range m {
+			flattenKeys(v, joinKey(prefix, fmt.Sprint(k)), keys)
+		}
+	}
+	if prefix != "" {
+		keys[prefix] = true
+	}
+}
+
+func joinKey(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
+
+// setValue 将字符串转换为字段的类型，map的格式为 key:value，多个用 , 分隔
+func setValue(v reflect.Value, raw string) error {
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return errors.New("must be true or false")
+		}
+		v.SetBool(b)
+	case reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return errors.New("must be an integer")
+		}
+		v.SetInt(n)
+	case reflect.Map:
+		v.Set(reflect.MakeMap(v.Type()))
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item == "" {
+				continue
+			}
+			key, value, found := strings.Cut(item, ":")
+			if !found {
+				return fmt.Errorf("item %q must be key:value", item)
+			}
+			if err := setMapEntry(v, strings.TrimSpace(key), strings.TrimSpace(value)); err != nil {
+				return fmt.Errorf("item %q: %s", item, err.Error())
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+// setMapEntry 设置map中key的值
+func setMapEntry(m reflect.Value, key, raw string) error {
+	elem := reflect.New(m.Type().Elem()).Elem()
+	if err := setValue(elem, raw); err != nil {
+		return err
+	}
+	if m.IsNil() {
+		m.Set(reflect.MakeMap(m.Type()))
+	}
+	m.SetMapIndex(reflect.ValueOf(key), elem)
+	return nil
+}
+
+// formatValue 字段值的字符串形式，map的格式与setValue相同，按key排序
+func formatValue(v reflect.Value) string {
+	if v.Kind() != reflect.Map {
+		return fmt.Sprint(v.Interface())
+	}
+	items := make([]string, 0, v.Len())
+	for _, key := range v.MapKeys() {
+		items = append(items, fmt.Sprintf("%v:%v", key.Interface(), v.MapIndex(key).Interface()))
+	}
+	sort.Strings(items)
+	return strings.Join(items, ",")
+}
+
+// flagValue 命令行参数的原始值，解析后按优先级设置
+type flagValue struct {
+	value  string
+	isBool bool
+}
+
+func (f *flagValue) String() string {
+	if f == nil {
+		return ""
+	}
+	return f.value
+}
+
+func (f *flagValue) Set(value string) error {
+	f.value = value
+	return nil
+}
+
+func (f *flagValue) IsBoolFlag() bool {
+	return f.isBool
+}
@@ -0,0 +1,159 @@
+package config
+
+import (
+	"errors"
+	"log"
+	"os"
+	"os/signal"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// Manager 持有当前配置，配置文件修改或收到SIGHUP时重新加载
+//
+// 仅应用带有 reload 标签的配置项，其它配置项的修改会被拒绝并记录日志，需要重启后生效
+type Manager struct {
+	// 启动时的命令行参数，重新加载时使用相同的参数
+	args    []string
+	current atomic.Pointer[Config]
+	// 保证同时只有一个重新加载
+	mu        sync.Mutex
+	listeners []func(*Config)
+}
+
+// NewManager 创建配置管理，cfg 为启动时通过Load读取的配置，args 为读取时的命令行参数
+func NewManager(cfg *Config, args []string) *Manager {
+	m := &Manager{args: args}
+	m.current.Store(cfg)
+	return m
+}
+
+// Current 当前配置，不能修改
+func (m *Manager) Current() *Config {
+	return m.current.Load()
+}
+
+// OnReload 添加配置重新加载后的回调，仅在可以运行时修改的配置项变化时调用
+func (m *Manager) OnReload(listener func(*Config)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.listeners = append(m.listeners, listener)
+}
+
+// Reload 重新读取配置，新配置无效时保留当前配置并返回错误
+func (m *Manager) Reload() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	old := m.current.Load()
+	cfg, err := Load(m.args)
+	if err != nil {
+		log.Printf("reload config failed, keep the current config. %s", err.Error())
+		return err
+	}
+	oldSettings := make(map[string]*setting, len(old.settings))
+	for _, s := range old.settings {
+		oldSettings[s.key] = s
+	}
+	changes := make([]string, 0)
+	for _, s := range cfg.settings {
+		o := oldSettings[s.key]
+		if o == nil || o.String() == s.String() {
+			continue
+		}
+		if !s.reload {
+			log.Printf("config %s (%s) can't be changed at runtime, restart to apply. current: %s, new: %s", s.key, s.env, o.display(), s.display())
+			s.restore(o)
+			continue
+		}
+		changes = append(changes, s.key+": "+o.display()+" -> "+s.display())
+	}
+	if len(changes) == 0 {
+		log.Println("reload config finished, nothing changed.")
+		return nil
+	}
+	if err = cfg.Validate(); err != nil {
+		log.Printf("reload config failed, keep the current config. %s", err.Error())
+		return err
+	}
+	m.current.Store(cfg)
+	for _, listener := range m.listeners {
+		listener(cfg)
+	}
+	log.Printf("reload config finished, changed:\n  %s", strings.Join(changes, "\n  "))
+	return nil
+}
+
+// Watch 在后台检查配置文件是否修改，修改时重新加载，收到SIGHUP时也会重新加载
+//
+// 检查间隔为 SFGO_CONFIG_WATCH_INTERVAL，小于等于0或未使用配置文件时仅在收到SIGHUP时重新加载
+func (m *Manager) Watch() {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	cfg := m.Current()
+	var tick <-chan time.Time
+	if cfg.file != "" && cfg.ConfigWatchInterval > 0 {
+		tick = time.NewTicker(time.Duration(cfg.ConfigWatchInterval) * time.Millisecond).C
+		log.Printf("watching config file %s every %dms", cfg.file, cfg.ConfigWatchInterval)
+	}
+	go func() {
+		last, _ := stat(cfg.file)
+		for {
+			select {
+			case <-hup:
+				log.Println("received SIGHUP, reload config.")
+				last, _ = stat(cfg.file)
+				_ = m.Reload()
+			case <-tick:
+				info, err := stat(cfg.file)
+				if err != nil {
+					// 编辑器保存时可能会先删除文件，下次检查时再重新加载
+					continue
+				}
+				if info.modTime.Equal(last.modTime) && info.size == last.size {
+					continue
+				}
+				last = info
+				log.Printf("config file %s changed, reload config.", cfg.file)
+				_ = m.Reload()
+			}
+		}
+	}()
+}
+
+// fileInfo 用于判断配置文件是否修改
+type fileInfo struct {
+	modTime time.Time
+	size    int64
+}
+
+func stat(path string) (fileInfo, error) {
+	if path == "" {
+		return fileInfo{}, errors.New("no config file")
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileInfo{}, err
+	}
+	return fileInfo{modTime: info.ModTime(), size: info.Size()}, nil
+}
+
+// restore 恢复为from的值及来源，用于拒绝不能在运行时修改的配置项
+func (s *setting) restore(from *setting) {
+	s.source = from.source
+	if s.mapKey == "" {
+		s.value.Set(from.value)
+		return
+	}
+	key := reflect.ValueOf(s.mapKey)
+	// 不能修改当前配置的map，为新配置创建新的map
+	m := reflect.MakeMap(s.value.Type())
+	for _, k := range s.value.MapKeys() {
+		m.SetMapIndex(k, s.value.MapIndex(k))
+	}
+	m.SetMapIndex(key, from.value.MapIndex(key))
+	s.value.Set(m)
+}
@@ -0,0 +1,68 @@
+package core
+
+import (
+	"errors"
+	"time"
+)
+
+// 错误码，供调用方判断失败的原因，值不会变化
+const (
+	// ErrCodeClockBackwards 时钟回拨，时间超过回拨前的时间戳后恢复
+	ErrCodeClockBackwards = "CLOCK_BACKWARDS"
+	// ErrCodeSequenceExhausted 当前毫秒的序列号已用完，且未能等到下一毫秒
+	ErrCodeSequenceExhausted = "SEQUENCE_EXHAUSTED"
+	// ErrCodeNotInitialized id生成器未初始化
+	ErrCodeNotInitialized = "NOT_INITIALIZED"
+	// ErrCodeWorkerOwnershipUnconfirmed workerId的归属无法确认，确认后恢复
+	ErrCodeWorkerOwnershipUnconfirmed = "WORKER_OWNERSHIP_UNCONFIRMED"
+	// ErrCodeWorkerLeaseExpired workerId的租约已到期，续约成功后恢复
+	ErrCodeWorkerLeaseExpired = "WORKER_LEASE_EXPIRED"
+	// ErrCodeWorkerLeaseLost workerId的租约已丢失，不会恢复
+	ErrCodeWorkerLeaseLost = "WORKER_LEASE_LOST"
+	// ErrCodeWorkerIdReleased workerId已释放，e.g. 服务停止或已交接给新实例，不会恢复
+	ErrCodeWorkerIdReleased = "WORKER_ID_RELEASED"
+	// ErrCodeWorkerIdConflict 其它节点使用了相同的workerId
+	ErrCodeWorkerIdConflict = "WORKER_ID_CONFLICT"
+	// ErrCodeJsSafeDisabled 未启用js-safe的id，启用后恢复
+	ErrCodeJsSafeDisabled = "JS_SAFE_DISABLED"
+)
+
+// Error id生成失败的原因
+type Error struct {
+	// 错误码，见 ErrCodeClockBackwards 等
+	Code string
+	Msg  string
+	// 建议的重试间隔，小于等于0时表示当前实例短时间内无法恢复，应换其它实例重试
+	RetryAfter time.Duration
+}
+
+// NewError 创建Error
+func NewError(code, msg string, retryAfter time.Duration) *Error {
+	return &Error{Code: code, Msg: msg, RetryAfter: retryAfter}
+}
+
+func (e *Error) Error() string {
+	return e.Msg
+}
+
+// Is 错误码相同即视为同一错误，e.g. 带有不同重试间隔的时钟回拨错误
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code
+}
+
+// WithRetryAfter 返回重试间隔为retryAfter的副本
+func (e *Error) WithRetryAfter(retryAfter time.Duration) *Error {
+	c := *e
+	c.RetryAfter = retryAfter
+	return &c
+}
+
+// AsError 获取err中的Error，不是id生成失败的原因时返回false
+func AsError(err error) (*Error, bool) {
+	var e *Error
+	if errors.As(err, &e) {
+		return e, true
+	}
+	return nil, false
+}
@@ -4,4 +4,20 @@ type IdGenerator interface {
 	Init()
 	GetId() (int64, error)
 	GetIds(n int) ([]int64, error)
+	// Ready 是否可以发放id，不可以时返回原因
+	Ready() error
+	// Close 停止发放id，释放占用的资源
+	Close()
+}
+
+// JsSafeIdGenerator 可以生成不超过 2^53-1 的id的IdGenerator可实现该接口，用于无法处理64位整数的客户端，e.g. JavaScript
+type JsSafeIdGenerator interface {
+	// GetJsSafeIds 获取n个不超过 2^53-1 的id
+	GetJsSafeIds(n int) ([]int64, error)
+}
+
+// StringIdGenerator 生成字符串id的生成器，e.g. UUIDv7、ULID、KSUID，生成的id按字符串排序单调递增
+type StringIdGenerator interface {
+	GetStringId() (string, error)
+	GetStringIds(n int) ([]string, error)
 }
@@ -0,0 +1,191 @@
+package idcodec
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// 编码方式的名称
+const (
+	DECIMAL = "decimal"
+	BASE62  = "base62"
+	BASE32  = "base32"
+	BASE58  = "base58"
+)
+
+// Encoding 将非负的int64 id编码为字符串，并可以解码回原来的id
+type Encoding struct {
+	name     string
+	alphabet string
+	// 固定宽度，不足时以alphabet[0]补齐，为0时不补齐
+	width int
+	// 字符对应的值，-1为无效字符
+	values [256]int8
+	// 解码时忽略的字符
+	ignore string
+}
+
+func newEncoding(name, alphabet string, width int) *Encoding {
+	e := &Encoding{name: name, alphabet: alphabet, width: width}
+	for i := range e.values {
+		e.values[i] = -1
+	}
+	for i := 0; i < len(alphabet); i++ {
+		e.values[alphabet[i]] = int8(i)
+	}
+	return e
+}
+
+// Decimal 十进制，默认的编码方式
+var Decimal = newEncoding(DECIMAL, "0123456789", 0)
+
+// Base62 0-9A-Za-z，最长11个字符，不补齐
+var Base62 = newEncoding(BASE62, "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz", 0)
+
+// Base58 比特币的字母表，不包括容易混淆的 0 O I l，最长11个字符，不补齐
+var Base58 = newEncoding(BASE58, "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz", 0)
+
+// Base32 Crockford base32，固定为13个字符，字母表按ASCII排序，因此编码后的字符串按字典序排序与id的大小顺序一致
+//
+// 解码时不区分大小写，I L 视为 1，O 视为 0，并忽略 -
+var Base32 = crockford()
+
+func crockford() *Encoding {
+	e := newEncoding(BASE32, "0123456789ABCDEFGHJKMNPQRSTVWXYZ", 13)
+	for i := 0; i < len(e.alphabet); i++ {
+		if c := e.alphabet[i]; c >= 'A' && c <= 'Z' {
+			e.values[c-'A'+'a'] = int8(i)
+		}
+	}
+	e.values['I'], e.values['i'], e.values['L'], e.values['l'] = 1, 1, 1, 1
+	e.values['O'], e.values['o'] = 0, 0
+	e.ignore = "-"
+	return e
+}
+
+var encodings = []*Encoding{Decimal, Base62, Base32, Base58}
+
+// Names 所有编码方式的名称
+func Names() []string {
+	names := make([]string, 0, len(encodings))
+	for _, e := range encodings {
+		names = append(names, e.name)
+	}
+	return names
+}
+
+// ByName 按名称获取编码方式，名称为空时为Decimal
+func ByName(name string) (*Encoding, bool) {
+	if name == "" {
+		return Decimal, true
+	}
+	for _, e := range encodings {
+		if e.name == name {
+			return e, true
+		}
+	}
+	return nil, false
+}
+
+// Name 编码方式的名称
+func (e *Encoding) Name() string {
+	return e.name
+}
+
+// Encode 编码id，id不能为负数
+func (e *Encoding) Encode(id int64) string {
+	base := uint64(len(e.alphabet))
+	var buf [64]byte
+	i := len(buf)
+	for n := uint64(id); n > 0 || i == len(buf); n /= base {
+		i--
+		buf[i] = e.alphabet[n%base]
+	}
+	for len(buf)-i < e.width {
+		i--
+		buf[i] = e.alphabet[0]
+	}
+	return string(buf[i:])
+}
+
+// EncodeAll 编码多个id
+func (e *Encoding) EncodeAll(ids []int64) []string {
+	encoded := make([]string, 0, len(ids))
+	for _, id := range ids {
+		encoded = append(encoded, e.Encode(id))
+	}
+	return encoded
+}
+
+// Decode 解码为id，有无效字符或超出int64的范围时返回错误
+func (e *Encoding) Decode(s string) (int64, error) {
+	base := int64(len(e.alphabet))
+	var id int64
+	digits := 0
+	for i := 0; i < len(s); i++ {
+		if strings.IndexByte(e.ignore, s[i]) >= 0 {
+			continue
+		}
+		v := e.values[s[i]]
+		if v < 0 {
+			return 0, fmt.Errorf("invalid %s character %q", e.name, s[i])
+		}
+		if id > (math.MaxInt64-int64(v))/base {
+			return 0, fmt.Errorf("%s %q is out of range", e.name, s)
+		}
+		id = id*base + int64(v)
+		digits++
+	}
+	if digits == 0 {
+		return 0, errors.New("empty id")
+	}
+	return id, nil
+}
+
+// Candidate 按某种编码方式解码的结果
+type Candidate struct {
+	Encoding *Encoding
+	Id       int64
+}
+
+// DecodeAny 按所有可能的编码方式解码，用于解析任意形式的id
+//
+// 依次尝试十进制、base32、base62、base58，返回所有能解码的结果，base32仅在去掉 - 后为13个字符时尝试。
+// 输入可能有多种解释时（e.g. 123 可以是十进制、base62、base58，13位数字可以是十进制、base32）返回全部结果，
+// 由调用方根据时间戳等判断，已知编码方式时应使用对应Encoding的Decode
+func DecodeAny(s string) ([]Candidate, error) {
+	if s == "" {
+		return nil, errors.New("empty id")
+	}
+	candidates := make([]Candidate, 0, len(encodings))
+	errs := make([]string, 0, len(encodings))
+	for _, e := range encodings {
+		if e.width > 0 && e.digits(s) != e.width {
+			errs = append(errs, fmt.Sprintf("%s id must be %d characters", e.name, e.width))
+			continue
+		}
+		id, err := e.Decode(s)
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		candidates = append(candidates, Candidate{Encoding: e, Id: id})
+	}
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("unrecognized id %q, not a decimal, base32, base62 or base58 id: %s", s, strings.Join(errs, ", "))
+	}
+	return candidates, nil
+}
+
+// digits 字符数，不包括解码时忽略的字符
+func (e *Encoding) digits(s string) int {
+	n := 0
+	for i := 0; i < len(s); i++ {
+		if strings.IndexByte(e.ignore, s[i]) < 0 {
+			n++
+		}
+	}
+	return n
+}
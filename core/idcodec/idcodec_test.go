@@ -0,0 +1,156 @@
+package idcodec
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func TestEncodeDecodeRoundTrip(t *testing.T) {
+	ids := []int64{0, 1, 61, 62, 1366055558968246272, math.MaxInt64}
+	for i := 0; i < 1000; i++ {
+		ids = append(ids, rand.Int63())
+	}
+	for _, e := range encodings {
+		for _, id := range ids {
+			s := e.Encode(id)
+			got, err := e.Decode(s)
+			if err != nil {
+				t.Fatalf("%s: decode %q of %d failed. %v", e.Name(), s, id, err)
+			}
+			if got != id {
+				t.Fatalf("%s: decode %q: got %d, want %d", e.Name(), s, got, id)
+			}
+		}
+	}
+	for id, want := range map[int64]string{0: "0", 1: "1", math.MaxInt64: "9223372036854775807"} {
+		if got := Decimal.Encode(id); got != want {
+			t.Fatalf("decimal: got %s, want %s", got, want)
+		}
+	}
+	if got := Base58.Encode(0); got != "1" {
+		t.Fatalf("base58: got %s for 0, want 1", got)
+	}
+	if got := Base32.Encode(0); got != "0000000000000" {
+		t.Fatalf("base32: got %s for 0, want 13 zeros", got)
+	}
+	if got := Base32.Encode(math.MaxInt64); got != "7ZZZZZZZZZZZZ" {
+		t.Fatalf("base32: got %s for max int64", got)
+	}
+}
+
+func TestBase32SortsInNumericOrder(t *testing.T) {
+	ids := []int64{0, 1, 31, 32, 1023, 1024, math.MaxInt64}
+	for i := 0; i < 1000; i++ {
+		// 覆盖不同的位数
+		ids = append(ids, rand.Int63()>>uint(rand.Intn(63)))
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	for i, id := range ids {
+		s := Base32.Encode(id)
+		if len(s) != 13 {
+			t.Fatalf("got %q for %d, want 13 characters", s, id)
+		}
+		if i > 0 && ids[i-1] != id && Base32.Encode(ids[i-1]) >= s {
+			t.Fatalf("%d < %d but %q >= %q", ids[i-1], id, Base32.Encode(ids[i-1]), s)
+		}
+	}
+}
+
+func TestBase32DecodeIsLenient(t *testing.T) {
+	want, err := Base32.Decode("15X9M9C7W0000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 不区分大小写，I L 视为 1，O 视为 0，忽略 -
+	for _, s := range []string{"15x9-m9c7-w0000", "I5X9M9C7WOOOO", "l5x9m9c7w0o00"} {
+		got, err := Base32.Decode(s)
+		if err != nil {
+			t.Fatalf("%s: %v", s, err)
+		}
+		if got != want {
+			t.Fatalf("%s: got %d, want %d", s, got, want)
+		}
+	}
+}
+
+func TestDecodeRejectsOverflowAndInvalidInput(t *testing.T) {
+	for _, c := range []struct {
+		e *Encoding
+		s string
+	}{
+		{Decimal, "9223372036854775808"},
+		// 比最大值大1
+		{Base62, "AzL8n0Y58m8"},
+		{Base62, "zzzzzzzzzzz"},
+		{Base58, "zzzzzzzzzzz"},
+		{Base32, "8000000000000"},
+		{Base32, "ZZZZZZZZZZZZZ"},
+		{Decimal, ""},
+		{Base32, "--"},
+		{Decimal, "12a"},
+		{Decimal, "-1"},
+		{Base62, "ab-c"},
+		{Base58, "0OIl"},
+		{Base32, "U"},
+	} {
+		if id, err := c.e.Decode(c.s); err == nil {
+			t.Fatalf("%s: decode %q should fail, got %d", c.e.Name(), c.s, id)
+		}
+	}
+	if got, err := Base62.Decode("AzL8n0Y58m7"); err != nil || got != math.MaxInt64 {
+		t.Fatalf("base62: got %d %v, want max int64", got, err)
+	}
+}
+
+// encodingNames 候选结果的编码方式
+func encodingNames(candidates []Candidate) []string {
+	names := make([]string, 0, len(candidates))
+	for _, c := range candidates {
+		names = append(names, c.Encoding.Name())
+	}
+	return names
+}
+
+func TestDecodeAny(t *testing.T) {
+	for _, c := range []struct {
+		s     string
+		names []string
+	}{
+		// 十进制的snowflake id超出base62、base58的范围
+		{"1366055558968246272", []string{DECIMAL}},
+		// 较短的数字可能是任意一种编码方式
+		{"123", []string{DECIMAL, BASE62, BASE58}},
+		// 13位数字可能是base32
+		{"1234567890123", []string{DECIMAL, BASE32}},
+		{"15x9-m9c7-w0000", []string{BASE32}},
+		{"15X9M9C7W0000", []string{BASE32}},
+		{"1cuY2Aq9t7w", []string{BASE62, BASE58}},
+		{"1cuY2Aq9t70", []string{BASE62}},
+		{"4Av427VXcEs", []string{BASE62, BASE58}},
+	} {
+		candidates, err := DecodeAny(c.s)
+		if err != nil {
+			t.Fatalf("%s: %v", c.s, err)
+		}
+		names := encodingNames(candidates)
+		if len(names) != len(c.names) {
+			t.Fatalf("%s: got %v, want %v", c.s, names, c.names)
+		}
+		for i := range names {
+			if names[i] != c.names[i] {
+				t.Fatalf("%s: got %v, want %v", c.s, names, c.names)
+			}
+			e, _ := ByName(names[i])
+			if id, _ := e.Decode(c.s); candidates[i].Id != id {
+				t.Fatalf("%s: got %d as %s, want %d", c.s, candidates[i].Id, names[i], id)
+			}
+		}
+	}
+	for _, s := range []string{"", "!!", "abc-def", "zzzzzzzzzzzzzzzzzzzz"} {
+		if candidates, err := DecodeAny(s); err == nil {
+			t.Fatalf("%q: got %v, want error", s, encodingNames(candidates))
+		}
+	}
+}
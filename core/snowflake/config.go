@@ -0,0 +1,147 @@
+package snowflake
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Config snowflake的配置，需要在创建IdGenerator、WorkerIdProvider之前通过Configure设置
+//
+// 标签 yaml toml 为配置文件中的名称，env 为环境变量名称，以 _* 结尾时为前缀，desc 为说明
+type Config struct {
+	WorkerIdProvider             string           `yaml:"workerIdProvider" toml:"workerIdProvider" env:"WOKER_ID_PROVIDER" desc:"工作节点ID分配方式，多个用 , 分隔时按顺序尝试"`
+	WorkerIdProviderTimeout      int64            `yaml:"workerIdProviderTimeout" toml:"workerIdProviderTimeout" env:"WOKER_ID_PROVIDER_TIMEOUT" desc:"分配方式为多个时，每个分配方式获取workerId的超时时间，单位ms"`
+	WorkerIdProviderTimeouts     map[string]int64 `yaml:"workerIdProviderTimeouts" toml:"workerIdProviderTimeouts" env:"WOKER_ID_PROVIDER_TIMEOUT_*" desc:"各分配方式获取workerId的超时时间，单位ms，key为分配方式名称"`
+	WorkerIdProviderAllowOverlap bool             `yaml:"workerIdProviderAllowOverlap" toml:"workerIdProviderAllowOverlap" env:"WOKER_ID_PROVIDER_ALLOW_OVERLAP" desc:"分配方式为多个时，是否允许各分配方式的workerId取值范围重叠"`
+	SpareWorkerIdCount           int64            `yaml:"spareWorkerIdCount" toml:"spareWorkerIdCount" env:"SPARE_WORKER_ID_COUNT" desc:"每个实例额外占用的备用workerId数量，时钟回拨时临时使用"`
+	StateDir                     string           `yaml:"stateDir" toml:"stateDir" env:"WORKER_ID_STATE_DIR" desc:"保存workerId的目录，容器中运行时建议挂载持久化的卷"`
+	StateSyncInterval            int64            `yaml:"stateSyncInterval" toml:"stateSyncInterval" env:"WORKER_ID_STATE_SYNC_INTERVAL" desc:"定时将已发放id的最新时间戳写入本地文件的间隔，单位ms，小于等于0时仅在关闭时写入"`
+	HandoffTimeout               int64            `yaml:"handoffTimeout" toml:"handoffTimeout" env:"WORKER_ID_HANDOFF_TIMEOUT" desc:"新实例等待上一个占用者释放workerId的最长时间，单位ms，启用gossip时生效"`
+	JsSafe                       bool             `yaml:"jsSafe" toml:"jsSafe" env:"SNOWFLAKE_JS_SAFE" desc:"是否同时提供不超过2^53-1的id（js-safe），启用时workerId不能超过127"`
+	Gossip                       GossipOptions    `yaml:"gossip" toml:"gossip"`
+	// 各分配方式的配置项，key为配置项名称，e.g. ZOOKEEPER_CONN_STRING，未设置的配置项为默认值
+	ProviderOptions map[string]string `yaml:"providerOptions" toml:"providerOptions"`
+}
+
+// GossipOptions gossip检测workerId冲突的配置
+type GossipOptions struct {
+	Enabled        bool   `yaml:"enabled" toml:"enabled" env:"GOSSIP_ENABLED" desc:"是否启用gossip检测workerId冲突"`
+	BindAddr       string `yaml:"bindAddr" toml:"bindAddr" env:"GOSSIP_BIND_ADDR" desc:"gossip监听地址"`
+	BindPort       int64  `yaml:"bindPort" toml:"bindPort" env:"GOSSIP_BIND_PORT" desc:"gossip监听端口，同时使用tcp及udp"`
+	AdvertiseAddr  string `yaml:"advertiseAddr" toml:"advertiseAddr" env:"GOSSIP_ADVERTISE_ADDR" desc:"其它节点访问本节点的地址，默认为应用的ip"`
+	Seeds          string `yaml:"seeds" toml:"seeds" env:"GOSSIP_SEEDS" desc:"种子节点，多个用 , 分隔"`
+	Datacenter     string `yaml:"datacenter" toml:"datacenter" env:"GOSSIP_DATACENTER" desc:"数据中心，仅用于展示"`
+	ConflictPolicy string `yaml:"conflictPolicy" toml:"conflictPolicy" env:"GOSSIP_CONFLICT_POLICY" desc:"workerId冲突时的处理策略，log unready stop"`
+}
+
+// DefaultConfig 默认配置
+func DefaultConfig() Config {
+	return Config{
+		WorkerIdProvider:         PROVIDER_ENVIRNMENT,
+		WorkerIdProviderTimeout:  10000,
+		WorkerIdProviderTimeouts: map[string]int64{},
+		StateDir:                 filepath.Join(os.TempDir(), "snowflake-go"),
+		StateSyncInterval:        5000,
+		HandoffTimeout:           30000,
+		Gossip: GossipOptions{
+			BindAddr:       "0.0.0.0",
+			BindPort:       7946,
+			ConflictPolicy: CONFLICT_POLICY_UNREADY,
+		},
+		ProviderOptions: map[string]string{},
+	}
+}
+
+// conf 当前配置
+var conf = DefaultConfig()
+
+// Configure 校验并设置配置，需要在创建IdGenerator、WorkerIdProvider之前调用
+func Configure(c Config) error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	conf = c
+	return nil
+}
+
+// ProviderNameList WorkerIdProvider中的各分配方式名称
+func (c Config) ProviderNameList() []string {
+	names := make([]string, 0)
+	for _, name := range strings.Split(c.WorkerIdProvider, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// Validate 校验配置，返回所有无效的配置项
+func (c Config) Validate() error {
+	problems := make([]string, 0)
+	names := c.ProviderNameList()
+	if len(names) == 0 {
+		problems = append(problems, "WOKER_ID_PROVIDER can't be empty")
+	}
+	for _, name := range names {
+		if _, ok := ProviderOptions(name); !ok {
+			problems = append(problems, fmt.Sprintf("unknown worker id provider %q in WOKER_ID_PROVIDER, valid names: %s", name, strings.Join(ProviderNames(), ", ")))
+		}
+	}
+	if c.WorkerIdProviderTimeout <= 0 {
+		problems = append(problems, fmt.Sprintf("WOKER_ID_PROVIDER_TIMEOUT must be greater than 0, got %d", c.WorkerIdProviderTimeout))
+	}
+	for _, name := range sortedKeys(c.WorkerIdProviderTimeouts) {
+		timeout := c.WorkerIdProviderTimeouts[name]
+		if _, ok := ProviderOptions(name); !ok {
+			problems = append(problems, fmt.Sprintf("WOKER_ID_PROVIDER_TIMEOUT_%s: unknown worker id provider %q", strings.ToUpper(name), name))
+		} else if timeout <= 0 {
+			problems = append(problems, fmt.Sprintf("WOKER_ID_PROVIDER_TIMEOUT_%s must be greater than 0, got %d", strings.ToUpper(name), timeout))
+		}
+	}
+	if c.SpareWorkerIdCount < 0 || c.SpareWorkerIdCount > MaxWorkerId() {
+		problems = append(problems, fmt.Sprintf("SPARE_WORKER_ID_COUNT must between 0 and %d, got %d", MaxWorkerId(), c.SpareWorkerIdCount))
+	}
+	if c.StateDir == "" {
+		problems = append(problems, "WORKER_ID_STATE_DIR can't be empty")
+	}
+	if c.HandoffTimeout < 0 {
+		problems = append(problems, fmt.Sprintf("WORKER_ID_HANDOFF_TIMEOUT can't be negative, got %d", c.HandoffTimeout))
+	}
+	switch c.Gossip.ConflictPolicy {
+	case CONFLICT_POLICY_LOG, CONFLICT_POLICY_UNREADY, CONFLICT_POLICY_STOP:
+	default:
+		problems = append(problems, fmt.Sprintf("GOSSIP_CONFLICT_POLICY must be one of log, unready, stop, got %q", c.Gossip.ConflictPolicy))
+	}
+	if c.Gossip.BindPort < 1 || c.Gossip.BindPort > 65535 {
+		problems = append(problems, fmt.Sprintf("GOSSIP_BIND_PORT must between 1 and 65535, got %d", c.Gossip.BindPort))
+	}
+	known := make(map[string]bool)
+	for _, name := range ProviderNames() {
+		options, _ := ProviderOptions(name)
+		for _, option := range options {
+			known[option.Name] = true
+		}
+	}
+	for _, name := range sortedKeys(c.ProviderOptions) {
+		if !known[name] {
+			problems = append(problems, fmt.Sprintf("unknown worker id provider option %s", name))
+		}
+	}
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, "\n"))
+	}
+	return nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,13 @@
+//go:build !unix
+
+package snowflake
+
+import (
+	"errors"
+	"os"
+)
+
+// tryLockFile 当前系统不支持flock
+func tryLockFile(f *os.File) (bool, error) {
+	return false, errors.New("file lock is only supported on unix")
+}
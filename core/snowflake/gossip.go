@@ -0,0 +1,475 @@
+package snowflake
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sfgo/core"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/memberlist"
+)
+
+// workerId冲突时的处理策略
+const (
+	// 仅记录日志及指标
+	CONFLICT_POLICY_LOG = "log"
+	// 就绪检查失败，从负载均衡中摘除，但仍然发放id
+	CONFLICT_POLICY_UNREADY = "unready"
+	// 就绪检查失败，并停止发放id
+	CONFLICT_POLICY_STOP = "stop"
+)
+
+// 节点的workerId交接状态
+const (
+	// 正在发放id，未广播状态的旧版本节点也视为该状态
+	handoffStateActive = "active"
+	// 新实例等待上一个占用者释放workerId
+	handoffStateWaiting = "waiting"
+	// 已停止发放id并释放workerId
+	handoffStateReleased = "released"
+)
+
+// ErrWorkerIdConflict 其它节点使用了相同的workerId
+var ErrWorkerIdConflict = core.NewError(core.ErrCodeWorkerIdConflict, "IdGenerator: worker id is used by other nodes", 0)
+
+// GossipConfig WorkerIdConflictDetector的配置
+type GossipConfig struct {
+	// 节点名称，集群内唯一，为空时使用 ip:port
+	NodeName string
+	// 监听地址及端口
+	BindAddr string
+	BindPort int
+	// 其它节点访问本节点的地址，为空时使用BindAddr
+	AdvertiseAddr string
+	// 种子节点，host:port，启动后加入种子节点所在的集群，未加入时定时重试
+	Seeds []string
+	// 数据中心
+	Datacenter string
+	// workerId冲突时的处理策略
+	Policy string
+	// 新实例等待上一个占用者释放workerId的最长时间，小于等于0时不交接
+	HandoffTimeout time.Duration
+}
+
+// GossipPeer gossip集群中节点广播的信息
+type GossipPeer struct {
+	Node       string `json:"node"`
+	AppName    string `json:"appName"`
+	Addr       string `json:"addr"`
+	WorkerId   int64  `json:"workerId"`
+	Datacenter string `json:"datacenter"`
+	Layout     string `json:"layout"`
+	// workerId交接状态，active waiting released
+	State string `json:"state,omitempty"`
+	// 释放workerId时已发放id的最新时间戳
+	LastTimestamp int64 `json:"lastTimestamp,omitempty"`
+}
+
+// active 是否正在发放id
+func (p GossipPeer) active() bool {
+	return p.State == "" || p.State == handoffStateActive
+}
+
+// WorkerIdConflictDetector 通过gossip在实例间广播各自的workerId，检测workerId冲突
+//
+// 用于发现配置错误，e.g. 两个实例设置了相同的 SNOWFLAKE_WORKER_ID。同一应用中workerId及位分配方式都相同，且都在发放id的节点视为冲突
+//
+// 同时用于滚动更新时交接workerId：新实例以waiting状态加入，正在使用该workerId的旧实例发现后停止发放id并释放，
+// 广播released状态及最后的时间戳，新实例等待旧实例释放后再发放id
+type WorkerIdConflictDetector struct {
+	config GossipConfig
+	self   GossipPeer
+	list   *memberlist.Memberlist
+	// 集群中的其它节点，key为节点名称
+	peers map[string]GossipPeer
+	// 与当前节点冲突的节点
+	conflicts []GossipPeer
+	// 已释放相同workerId的节点中，最新的时间戳
+	handoffTimestamp int64
+	// 等待交接当前节点workerId的新实例
+	successorCh chan GossipPeer
+	closeCh     chan struct{}
+	lock        sync.RWMutex
+}
+
+// NewWorkerIdConflictDetector 创建WorkerIdConflictDetector
+func NewWorkerIdConflictDetector(config GossipConfig, self GossipPeer) (*WorkerIdConflictDetector, error) {
+	switch config.Policy {
+	case CONFLICT_POLICY_LOG, CONFLICT_POLICY_UNREADY, CONFLICT_POLICY_STOP:
+	default:
+		return nil, fmt.Errorf("conflict policy %q is wrong, valid policies: log, unready, stop", config.Policy)
+	}
+	if config.NodeName == "" {
+		config.NodeName = self.Addr
+	}
+	self.Node = config.NodeName
+	self.Datacenter = config.Datacenter
+	if self.Layout == "" {
+		self.Layout = LayoutName()
+	}
+	self.State = handoffStateActive
+	if config.HandoffTimeout > 0 {
+		self.State = handoffStateWaiting
+	}
+	return &WorkerIdConflictDetector{
+		config:      config,
+		self:        self,
+		peers:       make(map[string]GossipPeer),
+		conflicts:   make([]GossipPeer, 0),
+		successorCh: make(chan GossipPeer, 1),
+	}, nil
+}
+
+// Start 启动gossip，并加入种子节点所在的集群
+func (d *WorkerIdConflictDetector) Start() error {
+	mlConfig := memberlist.DefaultLANConfig()
+	mlConfig.Name = d.config.NodeName
+	mlConfig.BindAddr = d.config.BindAddr
+	mlConfig.BindPort = d.config.BindPort
+	mlConfig.AdvertisePort = d.config.BindPort
+	mlConfig.AdvertiseAddr = d.config.AdvertiseAddr
+	mlConfig.Delegate = d
+	mlConfig.Events = d
+	mlConfig.LogOutput = &gossipLogWriter{out: log.Writer()}
+	list, err := memberlist.Create(mlConfig)
+	if err != nil {
+		return fmt.Errorf("start gossip failed. %s", err.Error())
+	}
+	d.list = list
+	d.closeCh = make(chan struct{})
+	log.Printf("gossip started. node: %s, bind: %s:%d, seeds: %s", d.config.NodeName, d.config.BindAddr, d.config.BindPort, strings.Join(d.config.Seeds, ","))
+	if len(d.config.Seeds) > 0 {
+		d.join()
+		go d.scheduledJoin()
+	}
+	return nil
+}
+
+// join 加入种子节点所在的集群
+func (d *WorkerIdConflictDetector) join() {
+	n, err := d.list.Join(d.config.Seeds)
+	if err != nil && n == 0 {
+		log.Printf("gossip join seeds failed, retry later. %s", err.Error())
+	}
+}
+
+// scheduledJoin 未发现其它节点时（e.g. 种子节点晚于当前节点启动），定时重新加入
+func (d *WorkerIdConflictDetector) scheduledJoin() {
+	ticker := time.NewTicker(10 * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-d.closeCh:
+			return
+		case <-ticker.C:
+			if d.list.NumMembers() <= 1 {
+				d.join()
+			}
+		}
+	}
+}
+
+// NodeMeta 广播当前节点的信息
+func (d *WorkerIdConflictDetector) NodeMeta(limit int) []byte {
+	d.lock.RLock()
+	meta, _ := json.Marshal(d.self)
+	d.lock.RUnlock()
+	if len(meta) > limit {
+		log.Printf("gossip node meta is too long. %d > %d", len(meta), limit)
+		return nil
+	}
+	return meta
+}
+
+func (d *WorkerIdConflictDetector) NotifyMsg([]byte) {}
+
+func (d *WorkerIdConflictDetector) GetBroadcasts(overhead, limit int) [][]byte {
+	return nil
+}
+
+func (d *WorkerIdConflictDetector) LocalState(join bool) []byte {
+	return nil
+}
+
+func (d *WorkerIdConflictDetector) MergeRemoteState(buf []byte, join bool) {}
+
+// NotifyJoin 节点加入
+//
+// 在memberlist内部加锁时调用，不能调用memberlist的方法
+func (d *WorkerIdConflictDetector) NotifyJoin(node *memberlist.Node) {
+	d.updatePeer(node)
+}
+
+// NotifyUpdate 节点信息更新
+func (d *WorkerIdConflictDetector) NotifyUpdate(node *memberlist.Node) {
+	d.updatePeer(node)
+}
+
+// NotifyLeave 节点离开或失联
+func (d *WorkerIdConflictDetector) NotifyLeave(node *memberlist.Node) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	delete(d.peers, node.Name)
+	d.checkConflicts()
+}
+
+func (d *WorkerIdConflictDetector) updatePeer(node *memberlist.Node) {
+	if node.Name == d.config.NodeName {
+		return
+	}
+	var peer GossipPeer
+	if err := json.Unmarshal(node.Meta, &peer); err != nil {
+		log.Printf("gossip node %s meta is wrong. %s", node.Name, err.Error())
+		return
+	}
+	peer.Node = node.Name
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.peers[node.Name] = peer
+	d.checkConflicts()
+}
+
+// checkConflicts 重新计算与当前节点冲突的节点，调用前需要加锁
+func (d *WorkerIdConflictDetector) checkConflicts() {
+	conflicts := make([]GossipPeer, 0)
+	for _, peer := range d.peers {
+		if peer.AppName != d.self.AppName {
+			continue
+		}
+		if peer.Layout != d.self.Layout {
+			log.Printf("gossip node %s uses layout %s, but this node uses %s", peer.Node, peer.Layout, d.self.Layout)
+			continue
+		}
+		if peer.WorkerId != d.self.WorkerId {
+			continue
+		}
+		switch {
+		case peer.State == handoffStateReleased:
+			if peer.LastTimestamp > d.handoffTimestamp {
+				d.handoffTimestamp = peer.LastTimestamp
+			}
+		case peer.State == handoffStateWaiting:
+			if d.self.active() && d.config.HandoffTimeout > 0 {
+				select {
+				case d.successorCh <- peer:
+				default:
+				}
+			}
+		case d.self.active():
+			conflicts = append(conflicts, peer)
+		}
+	}
+	sort.Slice(conflicts, func(i, j int) bool {
+		return conflicts[i].Node < conflicts[j].Node
+	})
+	for _, peer := range conflicts {
+		if !containsGossipPeer(d.conflicts, peer.Node) {
+			workerIdConflictsDetected.Inc()
+			log.Printf("worker id conflict detected, policy: %s. workerId %d is also used by node %s (%s, datacenter: %s)",
+				d.config.Policy, d.self.WorkerId, peer.Node, peer.Addr, peer.Datacenter)
+		}
+	}
+	if len(d.conflicts) > 0 && len(conflicts) == 0 {
+		log.Printf("worker id conflict resolved. workerId: %d", d.self.WorkerId)
+	}
+	d.conflicts = conflicts
+	workerIdConflicts.Set(float64(len(conflicts)))
+	gossipMembers.Set(float64(len(d.peers) + 1))
+}
+
+func containsGossipPeer(peers []GossipPeer, node string) bool {
+	for _, peer := range peers {
+		if peer.Node == node {
+			return true
+		}
+	}
+	return false
+}
+
+// Conflicts 与当前节点workerId冲突的节点
+func (d *WorkerIdConflictDetector) Conflicts() []GossipPeer {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+	conflicts := make([]GossipPeer, len(d.conflicts))
+	copy(conflicts, d.conflicts)
+	return conflicts
+}
+
+// Peers 集群中的其它节点
+func (d *WorkerIdConflictDetector) Peers() []GossipPeer {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+	peers := make([]GossipPeer, 0, len(d.peers))
+	for _, peer := range d.peers {
+		peers = append(peers, peer)
+	}
+	sort.Slice(peers, func(i, j int) bool {
+		return peers[i].Node < peers[j].Node
+	})
+	return peers
+}
+
+// Policy workerId冲突时的处理策略
+func (d *WorkerIdConflictDetector) Policy() string {
+	return d.config.Policy
+}
+
+// Check 存在冲突且策略不为log时返回error，用于就绪检查
+func (d *WorkerIdConflictDetector) Check() error {
+	if d.config.Policy == CONFLICT_POLICY_LOG {
+		return nil
+	}
+	conflicts := d.Conflicts()
+	if len(conflicts) == 0 {
+		return nil
+	}
+	nodes := make([]string, 0, len(conflicts))
+	for _, peer := range conflicts {
+		nodes = append(nodes, peer.Node)
+	}
+	return fmt.Errorf("%w: %s", ErrWorkerIdConflict, strings.Join(nodes, ","))
+}
+
+// Successors 等待交接当前节点workerId的新实例
+func (d *WorkerIdConflictDetector) Successors() <-chan GossipPeer {
+	return d.successorCh
+}
+
+// Done 停止gossip时关闭
+func (d *WorkerIdConflictDetector) Done() <-chan struct{} {
+	return d.closeCh
+}
+
+// WaitHandoff 当前节点为waiting状态时，等待其它使用相同workerId的节点释放，最长等待HandoffTimeout，然后广播active状态
+//
+// 返回已释放相同workerId的节点中最新的时间戳，当前节点需要等待时间超过该时间戳后再发放id
+func (d *WorkerIdConflictDetector) WaitHandoff() int64 {
+	d.lock.RLock()
+	waiting := d.self.State == handoffStateWaiting
+	d.lock.RUnlock()
+	if !waiting {
+		return 0
+	}
+	deadline := time.Now().Add(d.config.HandoffTimeout)
+	for {
+		holders := d.holders()
+		if len(holders) == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			log.Printf("wait for handoff of workerId %d timeout, it is still used by %s", d.self.WorkerId, strings.Join(holders, ","))
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	d.lock.Lock()
+	d.self.State = handoffStateActive
+	handoffTimestamp := d.handoffTimestamp
+	d.checkConflicts()
+	d.lock.Unlock()
+	d.updateNode()
+	return handoffTimestamp
+}
+
+// holders 正在使用当前节点workerId的节点
+func (d *WorkerIdConflictDetector) holders() []string {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+	holders := make([]string, 0)
+	for _, peer := range d.peers {
+		if peer.AppName == d.self.AppName && peer.Layout == d.self.Layout && peer.WorkerId == d.self.WorkerId && peer.active() {
+			holders = append(holders, peer.Node)
+		}
+	}
+	sort.Strings(holders)
+	return holders
+}
+
+// Release 广播released状态及已发放id的最新时间戳，等待交接的新实例可以开始发放id
+func (d *WorkerIdConflictDetector) Release(lastTimestamp int64) {
+	d.lock.Lock()
+	if d.self.State == handoffStateReleased {
+		d.lock.Unlock()
+		return
+	}
+	d.self.State = handoffStateReleased
+	d.self.LastTimestamp = lastTimestamp
+	d.checkConflicts()
+	d.lock.Unlock()
+	d.updateNode()
+}
+
+// updateNode 广播当前节点的信息
+func (d *WorkerIdConflictDetector) updateNode() {
+	if d.list == nil {
+		return
+	}
+	if err := d.list.UpdateNode(time.Second); err != nil {
+		log.Printf("gossip update node failed. %s", err.Error())
+	}
+}
+
+// Close 离开集群并停止gossip
+func (d *WorkerIdConflictDetector) Close() {
+	if d.list == nil {
+		return
+	}
+	close(d.closeCh)
+	if err := d.list.Leave(time.Second); err != nil {
+		log.Printf("gossip leave failed. %s", err.Error())
+	}
+	d.list.Shutdown()
+	d.list = nil
+}
+
+// newWorkerIdConflictDetectorFromConfig 根据配置创建WorkerIdConflictDetector，未启用时返回nil
+func newWorkerIdConflictDetectorFromConfig(self GossipPeer) (*WorkerIdConflictDetector, error) {
+	if !conf.Gossip.Enabled {
+		return nil, nil
+	}
+	seeds := make([]string, 0)
+	for _, seed := range strings.Split(conf.Gossip.Seeds, ",") {
+		seed = strings.TrimSpace(seed)
+		if seed == "" {
+			continue
+		}
+		// 未指定端口时，使用GOSSIP_BIND_PORT
+		if _, _, err := net.SplitHostPort(seed); err != nil {
+			seed = net.JoinHostPort(seed, strconv.FormatInt(conf.Gossip.BindPort, 10))
+		}
+		seeds = append(seeds, seed)
+	}
+	advertiseAddr := conf.Gossip.AdvertiseAddr
+	if advertiseAddr == "" {
+		advertiseAddr, _, _ = net.SplitHostPort(self.Addr)
+	}
+	return NewWorkerIdConflictDetector(GossipConfig{
+		BindAddr:       conf.Gossip.BindAddr,
+		BindPort:       int(conf.Gossip.BindPort),
+		AdvertiseAddr:  advertiseAddr,
+		Seeds:          seeds,
+		Datacenter:     conf.Gossip.Datacenter,
+		Policy:         conf.Gossip.ConflictPolicy,
+		HandoffTimeout: time.Duration(conf.HandoffTimeout) * time.Millisecond,
+	}, self)
+}
+
+// gossipLogWriter 过滤memberlist的DEBUG日志
+type gossipLogWriter struct {
+	out io.Writer
+}
+
+func (w *gossipLogWriter) Write(p []byte) (int, error) {
+	if bytes.Contains(p, []byte("[DEBUG]")) {
+		return len(p), nil
+	}
+	return w.out.Write(p)
+}
@@ -0,0 +1,135 @@
+package snowflake
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+)
+
+// freeGossipPort 获取tcp及udp都空闲的本机端口
+func freeGossipPort(t *testing.T) int {
+	t.Helper()
+	for i := 0; i < 10; i++ {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		port := l.Addr().(*net.TCPAddr).Port
+		u, err := net.ListenPacket("udp", fmt.Sprintf("127.0.0.1:%d", port))
+		l.Close()
+		if err != nil {
+			continue
+		}
+		u.Close()
+		return port
+	}
+	t.Fatal("no free port for gossip")
+	return 0
+}
+
+// startGossipNode 在本机启动WorkerIdConflictDetector，seed为空时不加入其它节点
+func startGossipNode(t *testing.T, name, policy string, workerId int64, seed string) (*WorkerIdConflictDetector, string) {
+	t.Helper()
+	port := freeGossipPort(t)
+	var seeds []string
+	if seed != "" {
+		seeds = []string{seed}
+	}
+	d, err := NewWorkerIdConflictDetector(GossipConfig{
+		NodeName:      name,
+		BindAddr:      "127.0.0.1",
+		BindPort:      port,
+		AdvertiseAddr: "127.0.0.1",
+		Seeds:         seeds,
+		Policy:        policy,
+	}, GossipPeer{AppName: "gossip-test", Addr: "127.0.0.1:8074", WorkerId: workerId})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = d.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(d.Close)
+	return d, fmt.Sprintf("127.0.0.1:%d", port)
+}
+
+// waitConflicts 等待检测到n个冲突的节点
+func waitConflicts(t *testing.T, d *WorkerIdConflictDetector, n int) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for len(d.Conflicts()) != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("node %s: got %d conflicts, want %d", d.config.NodeName, len(d.Conflicts()), n)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// initializedGenerator 使用detector的IdGenerator，仅用于检查就绪状态
+func initializedGenerator(d *WorkerIdConflictDetector) *IdGenerator {
+	sig := &IdGenerator{conflictDetector: d}
+	sig.initFlag.Store(true)
+	return sig
+}
+
+func TestGossipDetectsConflictOnLoopback(t *testing.T) {
+	logNode, seed := startGossipNode(t, "log", CONFLICT_POLICY_LOG, 7, "")
+	unreadyNode, _ := startGossipNode(t, "unready", CONFLICT_POLICY_UNREADY, 7, seed)
+	stopNode, _ := startGossipNode(t, "stop", CONFLICT_POLICY_STOP, 7, seed)
+	otherNode, _ := startGossipNode(t, "other", CONFLICT_POLICY_STOP, 8, seed)
+	for _, d := range []*WorkerIdConflictDetector{logNode, unreadyNode, stopNode} {
+		waitConflicts(t, d, 2)
+	}
+	// workerId不同的节点不冲突
+	waitConflicts(t, otherNode, 0)
+	if len(otherNode.Peers()) != 3 {
+		t.Fatalf("got %d peers, want 3", len(otherNode.Peers()))
+	}
+
+	// log：仅记录，就绪且继续发放id
+	sig := initializedGenerator(logNode)
+	if err := sig.ConflictCheck(); err != nil {
+		t.Fatalf("log policy: readiness check should pass, got %v", err)
+	}
+	if err := sig.Ready(); err != nil {
+		t.Fatalf("log policy: should keep issuing ids, got %v", err)
+	}
+	// unready：就绪检查失败，但继续发放id
+	sig = initializedGenerator(unreadyNode)
+	if err := sig.ConflictCheck(); !errors.Is(err, ErrWorkerIdConflict) {
+		t.Fatalf("unready policy: readiness check should fail, got %v", err)
+	}
+	if err := sig.Ready(); err != nil {
+		t.Fatalf("unready policy: should keep issuing ids, got %v", err)
+	}
+	// stop：就绪检查失败，并停止发放id
+	sig = initializedGenerator(stopNode)
+	if err := sig.ConflictCheck(); !errors.Is(err, ErrWorkerIdConflict) {
+		t.Fatalf("stop policy: readiness check should fail, got %v", err)
+	}
+	if _, err := sig.GetId(); !errors.Is(err, ErrWorkerIdConflict) {
+		t.Fatalf("stop policy: should stop issuing ids, got %v", err)
+	}
+}
+
+func TestGossipConflictResolvedAfterRelease(t *testing.T) {
+	first, seed := startGossipNode(t, "first", CONFLICT_POLICY_STOP, 9, "")
+	second, _ := startGossipNode(t, "second", CONFLICT_POLICY_STOP, 9, seed)
+	waitConflicts(t, first, 1)
+	waitConflicts(t, second, 1)
+	// 释放workerId后不再冲突，并记录释放时的时间戳供交接
+	lastTimestamp := timeGen()
+	first.Release(lastTimestamp)
+	waitConflicts(t, second, 0)
+	if err := initializedGenerator(second).Ready(); err != nil {
+		t.Fatalf("conflict should be resolved after release, got %v", err)
+	}
+	second.lock.RLock()
+	handoffTimestamp := second.handoffTimestamp
+	second.lock.RUnlock()
+	if handoffTimestamp != lastTimestamp {
+		t.Fatalf("got handoff timestamp %d, want %d", handoffTimestamp, lastTimestamp)
+	}
+}
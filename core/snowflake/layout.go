@@ -0,0 +1,189 @@
+package snowflake
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AnyWorker 计算id范围时不限制workerId
+const AnyWorker int64 = -1
+
+// LAYOUT_JS_SAFE JsSafeLayout的名称，可用于ParseLayout
+const LAYOUT_JS_SAFE = "js-safe"
+
+// Layout id的位分配方式，最高位为符号位，其余依次为时间戳、workerId、序列号，位数之和不超过63
+type Layout struct {
+	TimestampBits int64
+	WorkerIdBits  int64
+	SequenceBits  int64
+	// 起始时间戳，单位ms
+	Epoch int64
+	// 时间戳的单位，为0时为ms
+	Unit time.Duration
+}
+
+// DefaultLayout IdGenerator使用的位分配方式
+var DefaultLayout = Layout{
+	TimestampBits: 63 - timestampLeftShift,
+	WorkerIdBits:  workerIdBits,
+	SequenceBits:  sequenceBits,
+	Epoch:         twepoch,
+}
+
+// JsSafeLayout 不超过 2^53-1 的id的位分配方式，可以在JavaScript中作为数字使用而不丢失精度
+//
+// 时间戳单位为秒，可使用约68年，最多128个workerId，每个workerId每秒最多生成32768个id
+var JsSafeLayout = Layout{
+	TimestampBits: 31,
+	WorkerIdBits:  7,
+	SequenceBits:  15,
+	Epoch:         twepoch,
+	Unit:          time.Second,
+}
+
+// IdParts id的各部分
+type IdParts struct {
+	Id int64 `json:"id,string"`
+	// 生成id的时间戳，单位ms，时间戳单位为秒时为该秒的开始
+	Timestamp int64 `json:"timestamp"`
+	WorkerId  int64 `json:"workerId"`
+	Sequence  int64 `json:"sequence"`
+}
+
+// ParseLayout 解析位分配方式，格式为 时间戳位数-workerId位数-序列号位数，e.g. 41-10-12，
+// 时间戳单位为秒时时间戳位数带上后缀s，e.g. 31s-7-15，各部分位数之和不能超过63，也可以为 js-safe
+func ParseLayout(name string, epoch int64) (Layout, error) {
+	if name == LAYOUT_JS_SAFE {
+		layout := JsSafeLayout
+		layout.Epoch = epoch
+		return layout, nil
+	}
+	parts := strings.Split(name, "-")
+	if len(parts) != 3 {
+		return Layout{}, fmt.Errorf("layout %q must be <timestamp bits>-<worker id bits>-<sequence bits> or %s, e.g. %s", name, LAYOUT_JS_SAFE, DefaultLayout.Name())
+	}
+	layout := Layout{Epoch: epoch}
+	if strings.HasSuffix(parts[0], "s") {
+		parts[0] = strings.TrimSuffix(parts[0], "s")
+		layout.Unit = time.Second
+	}
+	bits := make([]int64, 3)
+	for i, part := range parts {
+		n, err := strconv.ParseInt(part, 10, 64)
+		if err != nil || n < 1 {
+			return Layout{}, fmt.Errorf("layout %q: bits must be positive integers", name)
+		}
+		bits[i] = n
+	}
+	if bits[0]+bits[1]+bits[2] > 63 {
+		return Layout{}, fmt.Errorf("layout %q: sum of bits can't be greater than 63", name)
+	}
+	layout.TimestampBits, layout.WorkerIdBits, layout.SequenceBits = bits[0], bits[1], bits[2]
+	return layout, nil
+}
+
+// Name 格式为 时间戳位数-workerId位数-序列号位数，e.g. 41-10-12，时间戳单位为秒时为 31s-7-15
+func (l Layout) Name() string {
+	unit := ""
+	if l.Unit == time.Second {
+		unit = "s"
+	}
+	return fmt.Sprintf("%d%s-%d-%d", l.TimestampBits, unit, l.WorkerIdBits, l.SequenceBits)
+}
+
+// MaxWorkerId 最大的workerId
+func (l Layout) MaxWorkerId() int64 {
+	return -1 ^ (-1 << l.WorkerIdBits)
+}
+
+// MaxIdValue 能表示的最大id
+func (l Layout) MaxIdValue() int64 {
+	return -1 ^ (-1 << (l.TimestampBits + l.WorkerIdBits + l.SequenceBits))
+}
+
+// unitMillis 时间戳单位的毫秒数
+func (l Layout) unitMillis() int64 {
+	if l.Unit <= time.Millisecond {
+		return 1
+	}
+	return l.Unit.Milliseconds()
+}
+
+// tick 当前时间，单位为时间戳的单位
+func (l Layout) tick() int64 {
+	return timeGen() / l.unitMillis()
+}
+
+func (l Layout) sequenceMask() int64 {
+	return -1 ^ (-1 << l.SequenceBits)
+}
+
+// compose 组合id，timestamp为时间戳的单位表示的时间
+func (l Layout) compose(timestamp, workerId, sequence int64) int64 {
+	return (timestamp-l.Epoch/l.unitMillis())<<(l.WorkerIdBits+l.SequenceBits) | workerId<<l.SequenceBits | sequence
+}
+
+// Decompose 将id拆分为时间戳、workerId、序列号
+func (l Layout) Decompose(id int64) (IdParts, error) {
+	if id < 0 {
+		return IdParts{}, errors.New("id can't be negative")
+	}
+	if id > l.MaxIdValue() {
+		return IdParts{}, fmt.Errorf("id is greater than the max id %d of layout %s", l.MaxIdValue(), l.Name())
+	}
+	return IdParts{
+		Id:        id,
+		Timestamp: (id>>(l.WorkerIdBits+l.SequenceBits) + l.Epoch/l.unitMillis()) * l.unitMillis(),
+		WorkerId:  id >> l.SequenceBits & l.MaxWorkerId(),
+		Sequence:  id & l.sequenceMask(),
+	}, nil
+}
+
+// MaxTimestamp id能表示的最大时间戳，单位ms
+func (l Layout) MaxTimestamp() int64 {
+	return (l.Epoch/l.unitMillis()+(-1^(-1<<l.TimestampBits)))*l.unitMillis() + l.unitMillis() - 1
+}
+
+// MinId 时间t所在毫秒（时间戳单位为秒时为所在秒）内生成的最小id，workerId不为AnyWorker时为该workerId生成的最小id
+//
+// t早于起始时间戳时为起始时间戳的最小id，晚于最大时间戳时为最大时间戳的最小id
+func (l Layout) MinId(t time.Time, workerId int64) int64 {
+	if workerId == AnyWorker {
+		workerId = 0
+	}
+	return l.compose(l.clamp(t), workerId, 0)
+}
+
+// MaxId 时间t所在毫秒（时间戳单位为秒时为所在秒）内生成的最大id，workerId不为AnyWorker时为该workerId生成的最大id
+//
+// t早于起始时间戳时为起始时间戳的最大id，晚于最大时间戳时为最大时间戳的最大id
+func (l Layout) MaxId(t time.Time, workerId int64) int64 {
+	if workerId == AnyWorker {
+		workerId = l.MaxWorkerId()
+	}
+	return l.compose(l.clamp(t), workerId, l.sequenceMask())
+}
+
+// clamp 时间t在时间戳单位下的值，超出范围时取最近的边界
+func (l Layout) clamp(t time.Time) int64 {
+	timestamp := t.UnixMilli()
+	if timestamp < l.Epoch {
+		timestamp = l.Epoch
+	} else if timestamp > l.MaxTimestamp() {
+		timestamp = l.MaxTimestamp()
+	}
+	return timestamp / l.unitMillis()
+}
+
+// MinIdForTime 时间t所在毫秒内生成的最小id，与MaxIdForTime一起用于按时间范围查询，e.g. WHERE id BETWEEN MinIdForTime(from) AND MaxIdForTime(to)
+func MinIdForTime(t time.Time) int64 {
+	return DefaultLayout.MinId(t, AnyWorker)
+}
+
+// MaxIdForTime 时间t所在毫秒内生成的最大id
+func MaxIdForTime(t time.Time) int64 {
+	return DefaultLayout.MaxId(t, AnyWorker)
+}
@@ -0,0 +1,158 @@
+package snowflake
+
+import (
+	"testing"
+	"time"
+)
+
+// js中可以精确表示的最大整数
+const maxSafeInteger = 1<<53 - 1
+
+func TestJsSafeLayout(t *testing.T) {
+	if name := JsSafeLayout.Name(); name != "31s-7-15" {
+		t.Fatalf("got layout name %s, want 31s-7-15", name)
+	}
+	if max := JsSafeLayout.MaxWorkerId(); max != 127 {
+		t.Fatalf("got max worker id %d, want 127", max)
+	}
+	if max := JsSafeLayout.MaxIdValue(); max != maxSafeInteger {
+		t.Fatalf("got max id %d, want %d", max, int64(maxSafeInteger))
+	}
+	for _, name := range []string{LAYOUT_JS_SAFE, "31s-7-15"} {
+		layout, err := ParseLayout(name, twepoch)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if layout != JsSafeLayout {
+			t.Fatalf("%s: got %+v, want %+v", name, layout, JsSafeLayout)
+		}
+	}
+	// 可使用约68年
+	if years := time.UnixMilli(JsSafeLayout.MaxTimestamp()).Sub(time.UnixMilli(twepoch)).Hours() / 24 / 365; years < 68 {
+		t.Fatalf("js-safe ids can only be used for %.1f years", years)
+	}
+}
+
+func TestJsSafeSnowflakeDecompose(t *testing.T) {
+	sf := NewLayoutSnowflake(JsSafeLayout.MaxWorkerId(), JsSafeLayout)
+	before := timeGen() / 1000 * 1000
+	var last int64
+	for i := 0; i < 1000; i++ {
+		id, err := sf.GetId()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id > maxSafeInteger || id <= last {
+			t.Fatalf("got id %d after %d", id, last)
+		}
+		last = id
+		parts, err := JsSafeLayout.Decompose(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// 时间戳单位为秒，为所在秒的开始
+		if parts.WorkerId != JsSafeLayout.MaxWorkerId() || parts.Timestamp%1000 != 0 || parts.Timestamp < before || parts.Timestamp > timeGen() {
+			t.Fatalf("got %+v", parts)
+		}
+		if JsSafeLayout.compose(parts.Timestamp/1000, parts.WorkerId, parts.Sequence) != id {
+			t.Fatalf("compose %+v: want %d", parts, id)
+		}
+	}
+	if _, err := JsSafeLayout.Decompose(-1); err == nil {
+		t.Fatal("decompose negative id should fail")
+	}
+	if _, err := JsSafeLayout.Decompose(maxSafeInteger + 1); err == nil {
+		t.Fatal("decompose id greater than 2^53-1 should fail")
+	}
+	parts, err := JsSafeLayout.Decompose(maxSafeInteger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parts.Timestamp != JsSafeLayout.MaxTimestamp()-999 || parts.WorkerId != 127 || parts.Sequence != 1<<15-1 {
+		t.Fatalf("got %+v for the max js-safe id", parts)
+	}
+}
+
+func TestLayoutIdRange(t *testing.T) {
+	at := time.UnixMilli(twepoch + 123456)
+	if got, want := MinIdForTime(at), int64(123456)<<22; got != want {
+		t.Fatalf("MinIdForTime: got %d, want %d", got, want)
+	}
+	if got, want := MaxIdForTime(at), int64(123456)<<22|1023<<12|4095; got != want {
+		t.Fatalf("MaxIdForTime: got %d, want %d", got, want)
+	}
+	// 限定workerId
+	if got, want := DefaultLayout.MinId(at, 5), int64(123456)<<22|5<<12; got != want {
+		t.Fatalf("MinId of worker 5: got %d, want %d", got, want)
+	}
+	if got, want := DefaultLayout.MaxId(at, 5), int64(123456)<<22|5<<12|4095; got != want {
+		t.Fatalf("MaxId of worker 5: got %d, want %d", got, want)
+	}
+	// 早于起始时间戳时取起始时间戳，晚于最大时间戳时取最大时间戳
+	before := time.UnixMilli(twepoch - 1000)
+	if got := MinIdForTime(before); got != 0 {
+		t.Fatalf("MinIdForTime before epoch: got %d, want 0", got)
+	}
+	if got, want := MaxIdForTime(before), int64(1023<<12|4095); got != want {
+		t.Fatalf("MaxIdForTime before epoch: got %d, want %d", got, want)
+	}
+	after := time.UnixMilli(DefaultLayout.MaxTimestamp() + 1000)
+	if got := MaxIdForTime(after); got != DefaultLayout.MaxIdValue() {
+		t.Fatalf("MaxIdForTime after max timestamp: got %d, want %d", got, DefaultLayout.MaxIdValue())
+	}
+	if got, want := MinIdForTime(after), DefaultLayout.MaxIdValue()&^(1<<22-1); got != want {
+		t.Fatalf("MinIdForTime after max timestamp: got %d, want %d", got, want)
+	}
+}
+
+func TestJsSafeLayoutIdRangeTruncatesToSecond(t *testing.T) {
+	// 按自然秒截断，起始时间戳所在秒为0
+	second := (twepoch/1000 + 5) * 1000
+	start := time.UnixMilli(second)
+	end := time.UnixMilli(second + 999)
+	// 同一秒内的时间范围相同
+	for _, at := range []time.Time{start, end} {
+		if got, want := JsSafeLayout.MinId(at, AnyWorker), int64(5)<<22; got != want {
+			t.Fatalf("MinId at %d: got %d, want %d", at.UnixMilli(), got, want)
+		}
+		if got, want := JsSafeLayout.MaxId(at, AnyWorker), int64(5)<<22|127<<15|(1<<15-1); got != want {
+			t.Fatalf("MaxId at %d: got %d, want %d", at.UnixMilli(), got, want)
+		}
+	}
+	if got, want := JsSafeLayout.MinId(end, 3), int64(5)<<22|3<<15; got != want {
+		t.Fatalf("MinId of worker 3: got %d, want %d", got, want)
+	}
+	if got, want := JsSafeLayout.MinId(time.UnixMilli(second+1000), AnyWorker), int64(6)<<22; got != want {
+		t.Fatalf("MinId of the next second: got %d, want %d", got, want)
+	}
+	if got := JsSafeLayout.MaxId(time.UnixMilli(JsSafeLayout.MaxTimestamp()+1000), AnyWorker); got != maxSafeInteger {
+		t.Fatalf("MaxId after max timestamp: got %d, want %d", got, int64(maxSafeInteger))
+	}
+}
+
+func TestGeneratedIdWithinIdRange(t *testing.T) {
+	for _, layout := range []Layout{DefaultLayout, JsSafeLayout} {
+		sf := NewLayoutSnowflake(7, layout)
+		for i := 0; i < 100; i++ {
+			id, err := sf.GetId()
+			if err != nil {
+				t.Fatal(err)
+			}
+			parts, err := layout.Decompose(id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			at := time.UnixMilli(parts.Timestamp)
+			if id < layout.MinId(at, AnyWorker) || id > layout.MaxId(at, AnyWorker) {
+				t.Fatalf("%s: id %d is out of [%d, %d]", layout.Name(), id, layout.MinId(at, AnyWorker), layout.MaxId(at, AnyWorker))
+			}
+			if id < layout.MinId(at, 7) || id > layout.MaxId(at, 7) {
+				t.Fatalf("%s: id %d is out of the range of worker 7 [%d, %d]", layout.Name(), id, layout.MinId(at, 7), layout.MaxId(at, 7))
+			}
+			// 其它workerId的范围不包括该id
+			if id >= layout.MinId(at, 6) && id <= layout.MaxId(at, 6) {
+				t.Fatalf("%s: id %d is in the range of worker 6", layout.Name(), id)
+			}
+		}
+	}
+}
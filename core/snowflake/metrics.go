@@ -0,0 +1,76 @@
+package snowflake
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// workerIdGauge 当前使用的workerId
+//
+// provider 提供workerId的WorkerIdProvider名称
+//
+// source workerId的来源，provider 或 local
+var workerIdGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "sfgo_worker_id",
+	Help: "The worker id in use and where it comes from.",
+}, []string{"provider", "source"})
+
+// providerAttempts 组合使用WorkerIdProvider时，各WorkerIdProvider获取workerId的次数
+//
+// result 为 succeeded failed timeout
+var providerAttempts = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "sfgo_worker_id_provider_attempts_total",
+	Help: "Attempts to get the worker id from each provider of a chained worker id provider.",
+}, []string{"provider", "result"})
+
+// workerIdConflicts 与当前节点workerId冲突的节点数，大于0时需要告警
+var workerIdConflicts = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "sfgo_worker_id_conflicts",
+	Help: "Number of gossip members using the same worker id as this node.",
+})
+
+// workerIdConflictsDetected 发现workerId冲突的次数
+var workerIdConflictsDetected = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "sfgo_worker_id_conflicts_detected_total",
+	Help: "Times a gossip member using the same worker id as this node was detected.",
+})
+
+// gossipMembers gossip集群中的节点数，包括当前节点
+var gossipMembers = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "sfgo_gossip_members",
+	Help: "Number of known gossip members, including this node.",
+})
+
+// leaseRenewals workerId租约的续约次数
+//
+// result 为 succeeded failed lost
+var leaseRenewals = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "sfgo_worker_id_lease_renewals_total",
+	Help: "Renewals of the worker id lease.",
+}, []string{"result"})
+
+// leaseExpiry workerId租约的到期时间，单位s，为0时表示不会到期
+var leaseExpiry = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "sfgo_worker_id_lease_expiry_timestamp_seconds",
+	Help: "Expiry time of the worker id lease in unix seconds, 0 if it never expires.",
+})
+
+// activeWorkerIdGauge 当前用于生成id的workerId，时钟回拨期间为备用workerId
+var activeWorkerIdGauge = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "sfgo_active_worker_id",
+	Help: "The worker id currently used to generate ids, a spare worker id while the clock is behind.",
+})
+
+// spareWorkerIds 备用workerId的数量
+var spareWorkerIds = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "sfgo_spare_worker_ids",
+	Help: "Number of spare worker ids claimed for clock rollback.",
+})
+
+// spareSwitches 时钟回拨时换成备用workerId，以及换回workerId的次数
+//
+// to 为 spare primary
+var spareSwitches = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "sfgo_spare_worker_id_switches_total",
+	Help: "Switches to a spare worker id on clock rollback and back to the primary worker id.",
+}, []string{"to"})
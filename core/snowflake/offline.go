@@ -0,0 +1,148 @@
+package snowflake
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultOfflineWindow OfflineGenerator默认的乱序窗口
+const DefaultOfflineWindow = 10 * time.Minute
+
+// OfflineGenerator 离线生成id，时间戳由调用方指定，用于数据迁移时按历史时间生成id
+//
+// 使用为迁移保留的workerId，不经过WorkerIdProvider分配，每毫秒依次使用各workerId的全部序列号，
+// 不同的迁移任务需要使用不同的workerId。
+//
+// 时间戳可以在窗口内乱序，按窗口内每毫秒记录已生成的数量，保证生成的id不重复，内存占用固定为每毫秒12字节，
+// 与输入的行数无关，默认窗口10分钟约7MB。早于已出现的最大时间戳超过窗口的时间戳，其计数可能已被覆盖，返回错误
+type OfflineGenerator struct {
+	workerIds []int64
+	// 环形缓冲区，timestamp对应的槽位为 timestamp%窗口毫秒数，槽位的时间戳不同时计数为0
+	timestamps []int64
+	// 各毫秒已生成的id的数量，第n个id使用第 n/4096 个workerId的第 n%4096 个序列号
+	counts []int32
+	// 已出现的最大时间戳，-1表示还没有生成id
+	maxTimestamp int64
+}
+
+// NewOfflineGenerator 创建离线生成器，workerIds 为保留给迁移使用的workerId，不能与运行中的实例相同，乱序窗口为DefaultOfflineWindow
+func NewOfflineGenerator(workerIds []int64) (*OfflineGenerator, error) {
+	return NewOfflineGeneratorWithWindow(workerIds, DefaultOfflineWindow)
+}
+
+// NewOfflineGeneratorWithWindow 创建离线生成器，时间戳可以比已出现的最大时间戳早window以内，至少为1ms，输入已排序时可以设置为1ms
+func NewOfflineGeneratorWithWindow(workerIds []int64, window time.Duration) (*OfflineGenerator, error) {
+	if len(workerIds) == 0 {
+		return nil, errors.New("worker ids can't be empty")
+	}
+	if window < time.Millisecond {
+		return nil, fmt.Errorf("window must be at least 1ms, got %s", window)
+	}
+	seen := make(map[int64]bool, len(workerIds))
+	for _, workerId := range workerIds {
+		if workerId < 0 || workerId > maxWorkerId {
+			return nil, fmt.Errorf("worker id must between 0 and %d, got %d", maxWorkerId, workerId)
+		}
+		if seen[workerId] {
+			return nil, fmt.Errorf("duplicated worker id %d", workerId)
+		}
+		seen[workerId] = true
+	}
+	size := window.Milliseconds()
+	return &OfflineGenerator{
+		workerIds:    workerIds,
+		timestamps:   make([]int64, size),
+		counts:       make([]int32, size),
+		maxTimestamp: -1,
+	}, nil
+}
+
+// Generate 生成时间戳为timestamp的id，timestamp单位为ms，不需要按顺序提供，但不能比已出现的最大时间戳早超过窗口
+func (g *OfflineGenerator) Generate(timestamp int64) (int64, error) {
+	maxTimestamp := DefaultLayout.MaxTimestamp()
+	if timestamp < twepoch || timestamp > maxTimestamp {
+		return 0, fmt.Errorf("timestamp %d is out of range, must between %s and %s", timestamp,
+			time.UnixMilli(twepoch).Format(time.RFC3339), time.UnixMilli(maxTimestamp).Format(time.RFC3339))
+	}
+	size := int64(len(g.counts))
+	if g.maxTimestamp >= 0 && timestamp <= g.maxTimestamp-size {
+		return 0, fmt.Errorf("timestamp %d is earlier than the max timestamp %d by more than the window %s, sort the input or use a larger window",
+			timestamp, g.maxTimestamp, time.Duration(size)*time.Millisecond)
+	}
+	slot := timestamp % size
+	var count int64
+	if g.timestamps[slot] == timestamp {
+		count = int64(g.counts[slot])
+	}
+	// 当前workerId的序列号用完后换下一个workerId
+	index := count / (sequenceMask + 1)
+	if index >= int64(len(g.workerIds)) {
+		return 0, fmt.Errorf("too many ids at timestamp %d, at most %d ids per millisecond with %d worker ids", timestamp, int64(len(g.workerIds))*(sequenceMask+1), len(g.workerIds))
+	}
+	g.timestamps[slot] = timestamp
+	g.counts[slot] = int32(count + 1)
+	if timestamp > g.maxTimestamp {
+		g.maxTimestamp = timestamp
+	}
+	sequence := count & sequenceMask
+	return ((timestamp - twepoch) << timestampLeftShift) | (g.workerIds[index] << workerIdShift) | sequence, nil
+}
+
+// ParseWorkerIds 解析workerId列表，格式为 workerId 或 最小值-最大值，多个用 , 分隔，e.g. 1000-1023 或 5,7,10-12
+func ParseWorkerIds(s string) ([]int64, error) {
+	workerIds := make([]int64, 0)
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		from, to, isRange := strings.Cut(item, "-")
+		min, err := strconv.ParseInt(from, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid worker id %q", item)
+		}
+		max := min
+		if isRange {
+			if max, err = strconv.ParseInt(to, 10, 64); err != nil || max < min {
+				return nil, fmt.Errorf("invalid worker id range %q", item)
+			}
+		}
+		if min < 0 || max > maxWorkerId {
+			return nil, fmt.Errorf("worker id must between 0 and %d, got %q", maxWorkerId, item)
+		}
+		for workerId := min; workerId <= max; workerId++ {
+			workerIds = append(workerIds, workerId)
+		}
+	}
+	return workerIds, nil
+}
+
+// CheckWorkerIdsNotAllocated 确认workerIds没有被provider分配给appName的实例，用于离线生成id前的检查
+//
+// provider不支持列出分配记录时返回错误，无法确认workerId未被使用
+func CheckWorkerIdsNotAllocated(provider WorkerIdProvider, appName string, workerIds []int64) error {
+	recycler, ok := provider.(WorkerIdRecycler)
+	if !ok {
+		return fmt.Errorf("the worker id provider %s doesn't support listing allocations, can't check whether the worker ids are in use", GetProviderName(provider))
+	}
+	allocations, err := recycler.ListAllocations(appName)
+	if err != nil {
+		return fmt.Errorf("list allocations failed. %w", err)
+	}
+	wanted := make(map[int64]bool, len(workerIds))
+	for _, workerId := range workerIds {
+		wanted[workerId] = true
+	}
+	used := make([]string, 0)
+	for _, allocation := range allocations {
+		if wanted[allocation.WorkerId] {
+			used = append(used, fmt.Sprintf("%d (%s)", allocation.WorkerId, allocation.Owner))
+		}
+	}
+	if len(used) > 0 {
+		sort.Strings(used)
+		return fmt.Errorf("worker ids %s are allocated by the worker id provider, reserve worker ids for migrations instead", strings.Join(used, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package snowflake
+
+import (
+	"testing"
+	"time"
+)
+
+func TestOfflineGeneratorAcceptsUnsortedTimestamps(t *testing.T) {
+	generator, err := NewOfflineGenerator([]int64{1000, 1001})
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := twepoch + 1_000_000
+	timestamps := []int64{base + 5, base, base + 5, base - 3, base, base + 5, base}
+	seen := make(map[int64]bool, len(timestamps))
+	for _, timestamp := range timestamps {
+		id, err := generator.Generate(timestamp)
+		if err != nil {
+			t.Fatalf("timestamp %d: %v", timestamp, err)
+		}
+		if seen[id] {
+			t.Fatalf("timestamp %d: duplicated id %d", timestamp, id)
+		}
+		seen[id] = true
+		parts, _ := DefaultLayout.Decompose(id)
+		if parts.Timestamp != timestamp {
+			t.Fatalf("got timestamp %d, want %d", parts.Timestamp, timestamp)
+		}
+	}
+}
+
+func TestOfflineGeneratorSwitchesWorkerIdWhenSequenceExhausted(t *testing.T) {
+	generator, err := NewOfflineGenerator([]int64{1000, 1001})
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := twepoch + 1_000_000
+	perMillisecond := 2 * (sequenceMask + 1)
+	for i := int64(0); i < perMillisecond; i++ {
+		// 穿插其它毫秒，不影响当前毫秒的计数
+		if _, err = generator.Generate(base + 1 + i%3); err != nil {
+			t.Fatal(err)
+		}
+		id, err := generator.Generate(base)
+		if err != nil {
+			t.Fatalf("id %d: %v", i, err)
+		}
+		parts, _ := DefaultLayout.Decompose(id)
+		wantWorkerId := int64(1000)
+		if i > sequenceMask {
+			wantWorkerId = 1001
+		}
+		if parts.WorkerId != wantWorkerId || parts.Sequence != i&sequenceMask {
+			t.Fatalf("id %d: got worker %d sequence %d", i, parts.WorkerId, parts.Sequence)
+		}
+	}
+	if _, err = generator.Generate(base); err == nil {
+		t.Fatal("expected error when all sequences of the millisecond are used")
+	}
+}
+
+func TestOfflineGeneratorRejectsTimestampsOutsideWindow(t *testing.T) {
+	generator, err := NewOfflineGeneratorWithWindow([]int64{1000}, 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(generator.counts) != 10 {
+		t.Fatalf("got %d slots, want 10", len(generator.counts))
+	}
+	base := twepoch + 1_000_000
+	seen := make(map[int64]bool)
+	// 窗口内乱序，包括与窗口外的时间戳占用相同槽位的时间戳
+	for _, timestamp := range []int64{base, base + 9, base + 1, base + 10, base + 1, base + 20, base + 11, base + 11} {
+		id, err := generator.Generate(timestamp)
+		if err != nil {
+			t.Fatalf("timestamp %d: %v", timestamp-base, err)
+		}
+		if seen[id] {
+			t.Fatalf("timestamp %d: duplicated id %d", timestamp-base, id)
+		}
+		seen[id] = true
+	}
+	// 槽位已被base+20覆盖，base+10的计数已丢失
+	if _, err = generator.Generate(base + 10); err == nil {
+		t.Fatal("timestamp earlier than the max timestamp by the window should fail")
+	}
+	// 跳到很远的时间戳后不需要清空计数
+	far := base + 1_000_000_000
+	id, err := generator.Generate(far)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parts, _ := DefaultLayout.Decompose(id); parts.Sequence != 0 || parts.Timestamp != far {
+		t.Fatalf("got %+v", parts)
+	}
+	if _, err = NewOfflineGeneratorWithWindow([]int64{1000}, 0); err == nil {
+		t.Fatal("window less than 1ms should fail")
+	}
+}
@@ -0,0 +1,57 @@
+package snowflake
+
+import (
+	"fmt"
+	"sfgo/core/idcodec"
+	"strings"
+)
+
+// ParsedId 解析任意形式的id的结果
+type ParsedId struct {
+	// 输入的id
+	Input string `json:"input"`
+	// 输入的编码方式，e.g. decimal base62
+	Encoding string `json:"encoding"`
+	IdParts
+}
+
+// ParseAny 解析十进制、base62、base32、base58形式的id，encoding 为空时识别编码方式，见 idcodec.DecodeAny
+//
+// 输入有多种可能的编码方式时，排除不在位分配方式范围内或时间戳晚于当前时间的结果，仍有多个时全部返回
+func (l Layout) ParseAny(s, encoding string) ([]ParsedId, error) {
+	s = strings.TrimSpace(s)
+	var candidates []idcodec.Candidate
+	if encoding == "" {
+		var err error
+		if candidates, err = idcodec.DecodeAny(s); err != nil {
+			return nil, err
+		}
+	} else {
+		e, ok := idcodec.ByName(encoding)
+		if !ok {
+			return nil, fmt.Errorf("unknown encoding %q, valid encodings: %s", encoding, strings.Join(idcodec.Names(), ", "))
+		}
+		id, err := e.Decode(s)
+		if err != nil {
+			return nil, err
+		}
+		candidates = []idcodec.Candidate{{Encoding: e, Id: id}}
+	}
+	parsed := make([]ParsedId, 0, len(candidates))
+	var err error
+	for _, c := range candidates {
+		var parts IdParts
+		if parts, err = l.Decompose(c.Id); err != nil {
+			continue
+		}
+		if len(candidates) > 1 && parts.Timestamp > timeGen() {
+			err = fmt.Errorf("id %q is generated in the future", s)
+			continue
+		}
+		parsed = append(parsed, ParsedId{Input: s, Encoding: c.Encoding.Name(), IdParts: parts})
+	}
+	if len(parsed) == 0 {
+		return nil, err
+	}
+	return parsed, nil
+}
@@ -0,0 +1,369 @@
+package snowflake
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/hashicorp/raft"
+)
+
+// raft命令类型
+const (
+	raftOpAllocate  = "allocate"
+	raftOpHeartbeat = "heartbeat"
+	raftOpRelease   = "release"
+	raftOpExpire    = "expire"
+	raftOpList      = "list"
+	// 管理接口释放其它节点占用的workerId
+	raftOpEvict     = "evict"
+	raftOpReserve   = "reserve"
+	raftOpUnreserve = "unreserve"
+)
+
+// raft命令失败的原因，用于还原为对应的error
+const (
+	raftErrNotFound    = "notFound"
+	raftErrNotStale    = "notStale"
+	raftErrInUse       = "inUse"
+	raftErrNotReserved = "notReserved"
+	// 命令未通过认证，不会被执行
+	raftErrUnauthorized = "unauthorized"
+)
+
+// raftCommand 通过raft复制的命令
+type raftCommand struct {
+	Op string `json:"op"`
+	// 占用者，即raft节点ID
+	Owner string `json:"owner,omitempty"`
+	// 占用者的 ip:port
+	Addr     string `json:"addr,omitempty"`
+	WorkerId int64  `json:"workerId,omitempty"`
+	// 发起命令时的时间戳，心跳时为上报的时间戳
+	Timestamp int64 `json:"timestamp"`
+	// 超过该时长（ms）未上报时间戳的workerId将被回收，小于等于0时不回收
+	RecycleAfter int64 `json:"recycleAfter,omitempty"`
+	// 分配的workerId取值范围
+	MinWorkerId int64 `json:"minWorkerId,omitempty"`
+	MaxWorkerId int64 `json:"maxWorkerId,omitempty"`
+	// 保留workerId的原因
+	Reason string `json:"reason,omitempty"`
+	// 释放workerId时，是否不判断其是否长时间未上报时间戳
+	Force bool `json:"force,omitempty"`
+	// 是否已被转发过，避免循环转发
+	Forwarded bool `json:"forwarded,omitempty"`
+	// 通过命令端口发送时的共享密钥，即RaftConfig.Secret，校验后清除，不会写入raft日志
+	Secret string `json:"secret,omitempty"`
+}
+
+// raftAllocation workerId分配记录
+type raftAllocation struct {
+	WorkerId  int64  `json:"workerId"`
+	Owner     string `json:"owner"`
+	Addr      string `json:"addr"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+// raftReservation workerId保留记录
+type raftReservation struct {
+	WorkerId  int64  `json:"workerId"`
+	Reason    string `json:"reason"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+// raftCommandResult 命令的执行结果
+type raftCommandResult struct {
+	WorkerId int64 `json:"workerId"`
+	// workerId上一个占用者的最新时间戳，新的占用者需要等待时间超过该时间戳
+	PreviousTimestamp int64             `json:"previousTimestamp"`
+	Allocations       []raftAllocation  `json:"allocations,omitempty"`
+	Reservations      []raftReservation `json:"reservations,omitempty"`
+	Error             string            `json:"error,omitempty"`
+	// 失败的原因，见 raftErrNotFound 等
+	ErrorKind string `json:"errorKind,omitempty"`
+}
+
+// err 执行失败时返回error，可用errors.Is判断原因
+func (r *raftCommandResult) err() error {
+	if r.Error == "" {
+		return nil
+	}
+	var kind error
+	switch r.ErrorKind {
+	case raftErrNotFound:
+		kind = ErrAllocationNotFound
+	case raftErrNotStale:
+		kind = ErrAllocationNotStale
+	case raftErrInUse:
+		kind = ErrWorkerIdInUse
+	case raftErrNotReserved:
+		kind = ErrWorkerIdNotReserved
+	default:
+		return errors.New(r.Error)
+	}
+	return fmt.Errorf("%w: %s", kind, r.Error)
+}
+
+// workerIdFSM 在raft节点间复制的workerId分配表
+type workerIdFSM struct {
+	lock        sync.RWMutex
+	allocations map[int64]*raftAllocation
+	// workerId被释放或回收时的最新时间戳
+	released map[int64]int64
+	// 保留的workerId，不会被分配
+	reserved map[int64]*raftReservation
+}
+
+// workerIdFSMSnapshot 分配表快照
+type workerIdFSMSnapshot struct {
+	Allocations map[int64]*raftAllocation  `json:"allocations"`
+	Released    map[int64]int64            `json:"released"`
+	Reserved    map[int64]*raftReservation `json:"reserved,omitempty"`
+}
+
+func newWorkerIdFSM() *workerIdFSM {
+	return &workerIdFSM{
+		allocations: make(map[int64]*raftAllocation),
+		released:    make(map[int64]int64),
+		reserved:    make(map[int64]*raftReservation),
+	}
+}
+
+// Apply 执行已提交的命令，结果为 *raftCommandResult
+func (f *workerIdFSM) Apply(l *raft.Log) interface{} {
+	var cmd raftCommand
+	if err := json.Unmarshal(l.Data, &cmd); err != nil {
+		return &raftCommandResult{Error: fmt.Sprintf("unmarshal raft command failed. %s", err.Error())}
+	}
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	switch cmd.Op {
+	case raftOpAllocate:
+		return f.allocate(&cmd)
+	case raftOpHeartbeat:
+		return f.heartbeat(&cmd)
+	case raftOpRelease:
+		return f.release(&cmd)
+	case raftOpExpire:
+		return &raftCommandResult{Allocations: f.expire(cmd.Timestamp, cmd.RecycleAfter, cmd.Owner)}
+	case raftOpEvict:
+		return f.evict(&cmd)
+	case raftOpReserve:
+		return f.reserve(&cmd)
+	case raftOpUnreserve:
+		return f.unreserve(&cmd)
+	default:
+		return &raftCommandResult{Error: fmt.Sprintf("unknown raft command %s", cmd.Op)}
+	}
+}
+
+// allocate 分配workerId，占用者已有范围内的workerId时直接返回，否则先回收长时间未上报时间戳的workerId，再分配最小的空闲workerId
+//
+// 占用者已有的workerId超出范围时（e.g. 启用js-safe后）释放后重新分配
+func (f *workerIdFSM) allocate(cmd *raftCommand) *raftCommandResult {
+	for _, a := range f.allocations {
+		if a.Owner != cmd.Owner {
+			continue
+		}
+		if a.WorkerId >= cmd.MinWorkerId && a.WorkerId <= cmd.MaxWorkerId {
+			a.Addr = cmd.Addr
+			return &raftCommandResult{WorkerId: a.WorkerId, PreviousTimestamp: a.Timestamp}
+		}
+		f.releaseLocked(a, cmd.Timestamp)
+		break
+	}
+	f.expire(cmd.Timestamp, cmd.RecycleAfter, cmd.Owner)
+	for workerId := cmd.MinWorkerId; workerId <= cmd.MaxWorkerId; workerId++ {
+		if _, used := f.allocations[workerId]; used {
+			continue
+		}
+		if _, reserved := f.reserved[workerId]; reserved {
+			continue
+		}
+		f.allocations[workerId] = &raftAllocation{
+			WorkerId:  workerId,
+			Owner:     cmd.Owner,
+			Addr:      cmd.Addr,
+			Timestamp: cmd.Timestamp,
+		}
+		return &raftCommandResult{WorkerId: workerId, PreviousTimestamp: f.released[workerId]}
+	}
+	return &raftCommandResult{Error: fmt.Sprintf("no free workerId, all workerIds between %d and %d are in use", cmd.MinWorkerId, cmd.MaxWorkerId)}
+}
+
+// heartbeat 更新workerId的时间戳，workerId已不属于占用者时返回错误
+func (f *workerIdFSM) heartbeat(cmd *raftCommand) *raftCommandResult {
+	a, ok := f.allocations[cmd.WorkerId]
+	if !ok || a.Owner != cmd.Owner {
+		return &raftCommandResult{Error: fmt.Sprintf("workerId %d is not owned by %s", cmd.WorkerId, cmd.Owner)}
+	}
+	if cmd.Timestamp > a.Timestamp {
+		a.Timestamp = cmd.Timestamp
+	}
+	return &raftCommandResult{WorkerId: a.WorkerId}
+}
+
+// release 释放workerId，记录其最新时间戳
+func (f *workerIdFSM) release(cmd *raftCommand) *raftCommandResult {
+	a, ok := f.allocations[cmd.WorkerId]
+	if !ok || a.Owner != cmd.Owner {
+		return &raftCommandResult{Error: fmt.Sprintf("workerId %d is not owned by %s", cmd.WorkerId, cmd.Owner)}
+	}
+	f.releaseLocked(a, cmd.Timestamp)
+	return &raftCommandResult{WorkerId: a.WorkerId}
+}
+
+func (f *workerIdFSM) releaseLocked(a *raftAllocation, timestamp int64) {
+	if a.Timestamp > timestamp {
+		timestamp = a.Timestamp
+	}
+	if timestamp > f.released[a.WorkerId] {
+		f.released[a.WorkerId] = timestamp
+	}
+	delete(f.allocations, a.WorkerId)
+}
+
+// expire 回收超过recycleAfter未上报时间戳的workerId，except的workerId不回收
+func (f *workerIdFSM) expire(curTimestamp, recycleAfter int64, except string) []raftAllocation {
+	expired := make([]raftAllocation, 0)
+	if recycleAfter <= 0 {
+		return expired
+	}
+	for _, a := range f.allocations {
+		if a.Owner != except && curTimestamp-a.Timestamp >= recycleAfter {
+			expired = append(expired, *a)
+			f.releaseLocked(a, a.Timestamp)
+		}
+	}
+	sortRaftAllocations(expired)
+	return expired
+}
+
+// evict 释放其它节点占用的workerId，Force为false时仅释放超过RecycleAfter未上报时间戳的workerId
+func (f *workerIdFSM) evict(cmd *raftCommand) *raftCommandResult {
+	a, ok := f.allocations[cmd.WorkerId]
+	if !ok {
+		return &raftCommandResult{Error: fmt.Sprintf("workerId %d", cmd.WorkerId), ErrorKind: raftErrNotFound}
+	}
+	if !cmd.Force && (cmd.RecycleAfter <= 0 || cmd.Timestamp-a.Timestamp < cmd.RecycleAfter) {
+		return &raftCommandResult{Error: fmt.Sprintf("workerId %d owned by %s was updated at %d", cmd.WorkerId, a.Owner, a.Timestamp), ErrorKind: raftErrNotStale}
+	}
+	evicted := *a
+	f.releaseLocked(a, a.Timestamp)
+	return &raftCommandResult{WorkerId: evicted.WorkerId, Allocations: []raftAllocation{evicted}}
+}
+
+// reserve 保留workerId，已保留时更新原因
+func (f *workerIdFSM) reserve(cmd *raftCommand) *raftCommandResult {
+	if a, ok := f.allocations[cmd.WorkerId]; ok {
+		return &raftCommandResult{Error: fmt.Sprintf("workerId %d is owned by %s", cmd.WorkerId, a.Owner), ErrorKind: raftErrInUse}
+	}
+	f.reserved[cmd.WorkerId] = &raftReservation{
+		WorkerId:  cmd.WorkerId,
+		Reason:    cmd.Reason,
+		Timestamp: cmd.Timestamp,
+	}
+	return &raftCommandResult{WorkerId: cmd.WorkerId}
+}
+
+// unreserve 取消保留workerId
+func (f *workerIdFSM) unreserve(cmd *raftCommand) *raftCommandResult {
+	if _, ok := f.reserved[cmd.WorkerId]; !ok {
+		return &raftCommandResult{Error: fmt.Sprintf("workerId %d", cmd.WorkerId), ErrorKind: raftErrNotReserved}
+	}
+	delete(f.reserved, cmd.WorkerId)
+	return &raftCommandResult{WorkerId: cmd.WorkerId}
+}
+
+// reservations 保留记录
+func (f *workerIdFSM) reservations() []raftReservation {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+	reservations := make([]raftReservation, 0, len(f.reserved))
+	for _, r := range f.reserved {
+		reservations = append(reservations, *r)
+	}
+	sort.Slice(reservations, func(i, j int) bool {
+		return reservations[i].WorkerId < reservations[j].WorkerId
+	})
+	return reservations
+}
+
+// list 分配记录
+func (f *workerIdFSM) list() []raftAllocation {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+	allocations := make([]raftAllocation, 0, len(f.allocations))
+	for _, a := range f.allocations {
+		allocations = append(allocations, *a)
+	}
+	sortRaftAllocations(allocations)
+	return allocations
+}
+
+func sortRaftAllocations(allocations []raftAllocation) {
+	sort.Slice(allocations, func(i, j int) bool {
+		return allocations[i].WorkerId < allocations[j].WorkerId
+	})
+}
+
+// Snapshot 生成分配表快照
+func (f *workerIdFSM) Snapshot() (raft.FSMSnapshot, error) {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+	snapshot := &workerIdFSMSnapshot{
+		Allocations: make(map[int64]*raftAllocation, len(f.allocations)),
+		Released:    make(map[int64]int64, len(f.released)),
+		Reserved:    make(map[int64]*raftReservation, len(f.reserved)),
+	}
+	for workerId, a := range f.allocations {
+		copied := *a
+		snapshot.Allocations[workerId] = &copied
+	}
+	for workerId, timestamp := range f.released {
+		snapshot.Released[workerId] = timestamp
+	}
+	for workerId, r := range f.reserved {
+		copied := *r
+		snapshot.Reserved[workerId] = &copied
+	}
+	return snapshot, nil
+}
+
+// Restore 从快照恢复分配表
+func (f *workerIdFSM) Restore(rc io.ReadCloser) error {
+	defer rc.Close()
+	var snapshot workerIdFSMSnapshot
+	if err := json.NewDecoder(rc).Decode(&snapshot); err != nil {
+		return err
+	}
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.allocations = snapshot.Allocations
+	f.released = snapshot.Released
+	f.reserved = snapshot.Reserved
+	if f.allocations == nil {
+		f.allocations = make(map[int64]*raftAllocation)
+	}
+	if f.released == nil {
+		f.released = make(map[int64]int64)
+	}
+	if f.reserved == nil {
+		f.reserved = make(map[int64]*raftReservation)
+	}
+	return nil
+}
+
+func (s *workerIdFSMSnapshot) Persist(sink raft.SnapshotSink) error {
+	err := json.NewEncoder(sink).Encode(s)
+	if err != nil {
+		sink.Cancel()
+		return err
+	}
+	return sink.Close()
+}
+
+func (s *workerIdFSMSnapshot) Release() {}
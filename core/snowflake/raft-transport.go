@@ -0,0 +1,224 @@
+package snowflake
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/raft"
+)
+
+// 连接的第1个字节表示连接类型，raft通信与命令转发共用1个端口
+const (
+	raftConnTypeRaft byte = 'R'
+	raftConnTypeRPC  byte = 'C'
+)
+
+// 设置共享密钥时，连接建立后监听方发送随机数，连接方返回以共享密钥计算的HMAC，校验失败时关闭连接
+const raftConnNonceSize = 32
+
+var errRaftStreamLayerClosed = errors.New("raft stream layer is closed")
+
+// raftStreamLayer 实现raft.StreamLayer，按连接类型将连接分发给raft或命令处理函数
+type raftStreamLayer struct {
+	listener  net.Listener
+	advertise net.Addr
+	raftConns chan net.Conn
+	// 处理命令连接
+	rpcHandler func(net.Conn)
+	// 共享密钥，不为空时raft连接及命令连接都需要通过认证
+	secret    string
+	closeCh   chan struct{}
+	closeOnce sync.Once
+}
+
+// newRaftStreamLayer 监听bindAddr，advertiseAddr为其它节点访问本节点的地址，为空时使用监听地址，
+// secret为空时不认证连接，需要通过网络隔离保证只有集群节点能访问该端口
+func newRaftStreamLayer(bindAddr, advertiseAddr, secret string, rpcHandler func(net.Conn)) (*raftStreamLayer, error) {
+	listener, err := net.Listen("tcp", bindAddr)
+	if err != nil {
+		return nil, err
+	}
+	var advertise net.Addr = listener.Addr()
+	if advertiseAddr != "" {
+		advertise, err = net.ResolveTCPAddr("tcp", advertiseAddr)
+		if err != nil {
+			listener.Close()
+			return nil, err
+		}
+	}
+	s := &raftStreamLayer{
+		listener:   listener,
+		advertise:  advertise,
+		raftConns:  make(chan net.Conn),
+		rpcHandler: rpcHandler,
+		secret:     secret,
+		closeCh:    make(chan struct{}),
+	}
+	go s.acceptLoop()
+	return s, nil
+}
+
+func (s *raftStreamLayer) acceptLoop() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			select {
+			case <-s.closeCh:
+				return
+			default:
+			}
+			log.Printf("raft stream layer accept failed. %s", err.Error())
+			time.Sleep(100 * time.Millisecond)
+			continue
+		}
+		go s.dispatch(conn)
+	}
+}
+
+// dispatch 读取连接类型并分发
+func (s *raftStreamLayer) dispatch(conn net.Conn) {
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	connType := make([]byte, 1)
+	if _, err := conn.Read(connType); err != nil {
+		conn.Close()
+		return
+	}
+	if s.secret != "" {
+		if err := acceptRaftConnAuth(conn, connType[0], s.secret); err != nil {
+			log.Printf("reject raft connection from %s. %s", conn.RemoteAddr().String(), err.Error())
+			conn.Close()
+			return
+		}
+	}
+	conn.SetDeadline(time.Time{})
+	switch connType[0] {
+	case raftConnTypeRaft:
+		select {
+		case s.raftConns <- conn:
+		case <-s.closeCh:
+			conn.Close()
+		}
+	case raftConnTypeRPC:
+		s.rpcHandler(conn)
+	default:
+		conn.Close()
+	}
+}
+
+// Accept 返回raft连接
+func (s *raftStreamLayer) Accept() (net.Conn, error) {
+	select {
+	case conn := <-s.raftConns:
+		return conn, nil
+	case <-s.closeCh:
+		return nil, errRaftStreamLayerClosed
+	}
+}
+
+func (s *raftStreamLayer) Close() error {
+	s.closeOnce.Do(func() {
+		close(s.closeCh)
+		s.listener.Close()
+	})
+	return nil
+}
+
+func (s *raftStreamLayer) Addr() net.Addr {
+	return s.advertise
+}
+
+// Dial 建立raft连接
+func (s *raftStreamLayer) Dial(address raft.ServerAddress, timeout time.Duration) (net.Conn, error) {
+	return dialRaftConn(string(address), raftConnTypeRaft, s.secret, timeout)
+}
+
+// dialRaftConn 建立连接并发送连接类型，secret不为空时完成认证
+func dialRaftConn(address string, connType byte, secret string, timeout time.Duration) (net.Conn, error) {
+	conn, err := net.DialTimeout("tcp", address, timeout)
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Now().Add(timeout))
+	if _, err = conn.Write([]byte{connType}); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if secret != "" {
+		nonce := make([]byte, raftConnNonceSize)
+		if _, err = io.ReadFull(conn, nonce); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("read raft auth nonce from %s failed. %s", address, err.Error())
+		}
+		if _, err = conn.Write(raftConnMac(secret, connType, nonce)); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	conn.SetDeadline(time.Time{})
+	return conn, nil
+}
+
+// acceptRaftConnAuth 发送随机数并校验连接方返回的HMAC
+func acceptRaftConnAuth(conn net.Conn, connType byte, secret string) error {
+	nonce := make([]byte, raftConnNonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	if _, err := conn.Write(nonce); err != nil {
+		return err
+	}
+	mac := make([]byte, sha256.Size)
+	if _, err := io.ReadFull(conn, mac); err != nil {
+		return err
+	}
+	if !hmac.Equal(mac, raftConnMac(secret, connType, nonce)) {
+		return errors.New("wrong raft secret")
+	}
+	return nil
+}
+
+// raftConnMac 以共享密钥计算连接类型及随机数的HMAC
+func raftConnMac(secret string, connType byte, nonce []byte) []byte {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte{connType})
+	h.Write(nonce)
+	return h.Sum(nil)
+}
+
+// sendRaftCommand 将命令发送至address处理，address为raft地址，secret为连接的共享密钥
+func sendRaftCommand(address, secret string, cmd *raftCommand, timeout time.Duration) (*raftCommandResult, error) {
+	conn, err := dialRaftConn(address, raftConnTypeRPC, secret, timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+	if err = json.NewEncoder(conn).Encode(cmd); err != nil {
+		return nil, err
+	}
+	var result raftCommandResult
+	if err = json.NewDecoder(conn).Decode(&result); err != nil {
+		return nil, fmt.Errorf("read raft command result from %s failed. %s", address, err.Error())
+	}
+	return &result, nil
+}
+
+// serveRaftCommand 读取命令，处理后返回结果，handle 的第1个参数为发送命令的地址，用于校验是否为集群节点
+func serveRaftCommand(conn net.Conn, timeout time.Duration, handle func(net.Addr, *raftCommand) *raftCommandResult) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+	var cmd raftCommand
+	if err := json.NewDecoder(conn).Decode(&cmd); err != nil {
+		return
+	}
+	json.NewEncoder(conn).Encode(handle(conn.RemoteAddr(), &cmd))
+}
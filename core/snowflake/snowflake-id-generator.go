@@ -1,26 +1,90 @@
 package snowflake
 
 import (
-	"errors"
 	"fmt"
+	"log"
+	"sfgo/core"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 var (
-	ErrInitExpected = errors.New("IdGenerator: must be initialized before using")
+	ErrInitExpected = core.NewError(core.ErrCodeNotInitialized, "IdGenerator: must be initialized before using", time.Second)
+	// ErrOwnershipUnconfirmed workerId的归属无法确认，停止发放id
+	ErrOwnershipUnconfirmed = core.NewError(core.ErrCodeWorkerOwnershipUnconfirmed, "IdGenerator: ownership of worker id can't be confirmed", time.Second)
+	// ErrWorkerIdReleased workerId已释放，e.g. 服务停止或已交接给新实例，停止发放id
+	ErrWorkerIdReleased = core.NewError(core.ErrCodeWorkerIdReleased, "IdGenerator: worker id released", 0)
+	// ErrJsSafeDisabled 未启用js-safe的id
+	ErrJsSafeDisabled = core.NewError(core.ErrCodeJsSafeDisabled, "IdGenerator: js-safe ids are disabled, set SNOWFLAKE_JS_SAFE=true to enable", 0)
 )
 
 // singleton
 var sl *Snowflake
 var once sync.Once
 
+// 当前进程使用的workerId，初始化前为-1
+var localWorkerId int64 = -1
+
+// LocalWorkerId 当前进程使用的workerId，id生成器未初始化时返回false
+func LocalWorkerId() (int64, bool) {
+	workerId := atomic.LoadInt64(&localWorkerId)
+	return workerId, workerId >= 0
+}
+
 // IdGenerator 基本雪花算法的id生成器
 type IdGenerator struct {
 	ip               string
 	port             string
 	appName          string
 	workerIdProvider WorkerIdProvider
-	initFlag         bool
+	// 不为nil时，发放id前确认workerId的归属
+	ownershipVerifier OwnershipVerifier
+	// 不为nil时，定时续约，发放id前确认租约有效
+	leaseKeeper *leaseKeeper
+	// 保存workerId及已发放id的最新时间戳
+	workerIdHolder *WorkerIdHolder
+	// 不为nil时，检测其它节点是否使用了相同的workerId
+	conflictDetector *WorkerIdConflictDetector
+	// 不为nil时，使用JsSafeLayout及相同的workerId生成不超过 2^53-1 的id
+	jsSafe *Snowflake
+	// 备用workerId，时钟回拨时临时使用
+	spares []*spareWorkerId
+	// 由Init、release写入，Ready等在其它goroutine中读取
+	initFlag atomic.Bool
+	// workerId是否已释放
+	released atomic.Bool
+	closed   bool
+	// 发放id时加读锁，释放workerId时加写锁，保证释放后不再发放id
+	issueLock sync.RWMutex
+	closeLock sync.Mutex
+	workerId  int64
+	// 提供workerId的WorkerIdProvider名称
+	providerName string
+	// workerId的来源，provider 或 local
+	source string
+}
+
+// WorkerInfo workerId信息
+type WorkerInfo struct {
+	AppName  string `json:"appName"`
+	IP       string `json:"ip"`
+	Port     string `json:"port"`
+	WorkerId int64  `json:"workerId"`
+	// 提供workerId的WorkerIdProvider名称
+	Provider string `json:"provider"`
+	// workerId的来源，provider 或 local，local表示从WorkerIdProvider获取失败，使用了本地文件中保存的workerId
+	Source string `json:"source"`
+	// 位分配方式
+	Layout string `json:"layout"`
+	// 启用js-safe时，js-safe的id的位分配方式
+	JsSafeLayout string `json:"jsSafeLayout,omitempty"`
+	// 当前用于生成id的workerId，时钟回拨期间为备用workerId
+	ActiveWorkerId int64 `json:"activeWorkerId"`
+	// 备用workerId
+	SpareWorkerIds []int64 `json:"spareWorkerIds,omitempty"`
+	// 启用gossip时，与当前节点workerId冲突的节点
+	Conflicts []GossipPeer `json:"conflicts,omitempty"`
 }
 
 // NewIdGenerator 创建IdGenerator
@@ -31,16 +95,18 @@ type IdGenerator struct {
 //
 // appName 应用名称，用于区分不同应用
 //
-// WorkerIdProvider 需要提供WorkerIdProvider
-func NewIdGenerator(ip, port, appName string) *IdGenerator {
-	workerIdProvider := GetWorkerProvider()
+// WorkerIdProvider 根据 WOKER_ID_PROVIDER 创建，无效时返回error
+func NewIdGenerator(ip, port, appName string) (*IdGenerator, error) {
+	workerIdProvider, err := GetWorkerProvider()
+	if err != nil {
+		return nil, err
+	}
 	return &IdGenerator{
 		ip:               ip,
 		port:             port,
 		appName:          appName,
 		workerIdProvider: workerIdProvider,
-		initFlag:         false,
-	}
+	}, nil
 }
 
 // Init 获取workerId，进行初始化
@@ -54,22 +120,180 @@ func (sig *IdGenerator) Init() {
 	if workerId < 0 || workerId > MaxWorkerId() {
 		panic(fmt.Sprintf("workerId must between 0 and %d", MaxWorkerId()))
 	}
+	if conf.JsSafe {
+		sig.jsSafe = newJsSafeSnowflake(sig.workerIdProvider, workerId)
+	}
 	once.Do(func() {
 		sl = NewSnowflake(workerId)
+		atomic.StoreInt64(&localWorkerId, workerId)
 	})
-	sig.initFlag = true
+	sig.workerIdHolder = workerIdHolder
+	workerIdHolder.startSync(sig.lastTimestamp)
+	// 让WorkerIdProvider可以获取已发放id的最新时间戳
+	if p, ok := sig.workerIdProvider.(IssuedTimestampAware); ok {
+		p.SetIssuedTimestampFunc(sig.lastTimestamp)
+	}
+	// workerId来自本地文件时，WorkerIdProvider未初始化，无法确认归属
+	if lease := workerIdHolder.Lease(); lease != nil {
+		sig.leaseKeeper = newLeaseKeeper(lease, sig.lastTimestamp)
+		sig.leaseKeeper.start()
+	}
+	// 以租约方式提供workerId时也可以确认归属，e.g. zookeeper会话断开时不必等到租约到期即停止发放id
+	if v, ok := sig.workerIdProvider.(OwnershipVerifier); ok && workerIdHolder.FromProvider() {
+		sig.ownershipVerifier = v
+	}
+	sig.workerId = workerId
+	sig.providerName = GetProviderName(sig.workerIdProvider)
+	sig.source = "local"
+	if workerIdHolder.FromProvider() {
+		sig.source = "provider"
+	}
+	workerIdGauge.WithLabelValues(sig.providerName, sig.source).Set(float64(workerId))
+	activeWorkerIdGauge.Set(float64(workerId))
+	sig.claimSpares()
+	sig.startConflictDetector()
+	sig.waitHandoff()
+	log.Printf("IdGenerator initialized. workerId: %d, provider: %s, source: %s", workerId, sig.providerName, sig.source)
+	sig.initFlag.Store(true)
+}
+
+// newJsSafeSnowflake 使用JsSafeLayout及workerId创建实例，workerId超出JsSafeLayout的取值范围时无法启动
+//
+// WorkerIdProvider声明的取值范围超出时，集群扩容后可能分配到超出范围的workerId，记录警告
+func newJsSafeSnowflake(provider WorkerIdProvider, workerId int64) *Snowflake {
+	max := JsSafeLayout.MaxWorkerId()
+	if workerId > max {
+		panic(fmt.Sprintf("workerId %d exceeds the max workerId %d of js-safe layout %s, at most %d instances can be deployed with SNOWFLAKE_JS_SAFE=true", workerId, max, JsSafeLayout.Name(), max+1))
+	}
+	if _, hi := getWorkerIdRange(provider); hi > max {
+		log.Printf("warning: worker id provider %s may allocate workerId up to %d, but the max workerId of js-safe layout %s is %d, instances with larger workerId will fail to start", GetProviderName(provider), hi, JsSafeLayout.Name(), max)
+	}
+	return NewLayoutSnowflake(workerId, JsSafeLayout)
+}
+
+// waitHandoff 启用gossip时，等待其它使用相同workerId的实例释放，并等待时间超过其已发放id的最新时间戳
+//
+// 之后有新实例等待交接当前workerId时，停止发放id并释放workerId
+func (sig *IdGenerator) waitHandoff() {
+	if sig.conflictDetector == nil {
+		return
+	}
+	handoffTimestamp := sig.conflictDetector.WaitHandoff()
+	if err := waitPastTimestamp(handoffTimestamp, fmt.Sprintf("workerId %d previous holder", sig.workerId)); err != nil {
+		panic(err.Error())
+	}
+	go sig.watchSuccessor(sig.conflictDetector)
+}
+
+// watchSuccessor 有新实例等待交接当前workerId时，释放workerId
+func (sig *IdGenerator) watchSuccessor(detector *WorkerIdConflictDetector) {
+	select {
+	case <-detector.Done():
+	case successor := <-detector.Successors():
+		log.Printf("hand off workerId %d to node %s (%s)", sig.workerId, successor.Node, successor.Addr)
+		sig.closeLock.Lock()
+		defer sig.closeLock.Unlock()
+		sig.release()
+	}
+}
+
+// startConflictDetector 启用gossip时，广播workerId并检测冲突
+func (sig *IdGenerator) startConflictDetector() {
+	detector, err := newWorkerIdConflictDetectorFromConfig(GossipPeer{
+		AppName:  sig.appName,
+		Addr:     sig.ip + ":" + sig.port,
+		WorkerId: sig.workerId,
+	})
+	if err == nil && detector != nil {
+		err = detector.Start()
+	}
+	if err != nil {
+		panic("worker id conflict detector is wrong. " + err.Error())
+	}
+	sig.conflictDetector = detector
+}
+
+// ConflictCheck 启用gossip且存在workerId冲突时返回error，冲突处理策略为log时不返回error，用于就绪检查
+func (sig *IdGenerator) ConflictCheck() error {
+	if sig.conflictDetector == nil {
+		return nil
+	}
+	return sig.conflictDetector.Check()
+}
+
+// Info 获取workerId信息
+func (sig *IdGenerator) Info() WorkerInfo {
+	info := WorkerInfo{
+		AppName:  sig.appName,
+		IP:       sig.ip,
+		Port:     sig.port,
+		WorkerId: sig.workerId,
+		Provider: sig.providerName,
+		Source:   sig.source,
+		Layout:   LayoutName(),
+		// 未初始化时为workerId
+		ActiveWorkerId: sig.workerId,
+		SpareWorkerIds: sig.spareWorkerIdList(),
+	}
+	if sig.initFlag.Load() || sig.released.Load() {
+		info.ActiveWorkerId = sl.ActiveWorkerId()
+	}
+	if sig.jsSafe != nil {
+		info.JsSafeLayout = JsSafeLayout.Name()
+	}
+	if sig.conflictDetector != nil {
+		info.Conflicts = sig.conflictDetector.Conflicts()
+	}
+	return info
+}
+
+// WorkerIdProvider 提供workerId的WorkerIdProvider，用于管理接口
+func (sig *IdGenerator) WorkerIdProvider() WorkerIdProvider {
+	return sig.workerIdProvider
+}
+
+// AppName 应用名称
+func (sig *IdGenerator) AppName() string {
+	return sig.appName
+}
+
+// Ready 是否可以发放id，不可以时返回原因
+func (sig *IdGenerator) Ready() error {
+	if sig.released.Load() {
+		return ErrWorkerIdReleased
+	}
+	if !sig.initFlag.Load() {
+		return ErrInitExpected
+	}
+	if sig.leaseKeeper != nil {
+		if err := sig.leaseKeeper.Valid(); err != nil {
+			return err
+		}
+	}
+	if sig.ownershipVerifier != nil && !sig.ownershipVerifier.OwnershipConfirmed() {
+		return ErrOwnershipUnconfirmed
+	}
+	// 冲突处理策略为stop时，停止发放id
+	if sig.conflictDetector != nil && sig.conflictDetector.Policy() == CONFLICT_POLICY_STOP {
+		return sig.conflictDetector.Check()
+	}
+	return nil
 }
 
 func (sig *IdGenerator) GetId() (int64, error) {
-	if !sig.initFlag {
-		return 0, ErrInitExpected
+	sig.issueLock.RLock()
+	defer sig.issueLock.RUnlock()
+	if err := sig.Ready(); err != nil {
+		return 0, err
 	}
 	return sl.GetId()
 }
 
 func (sig *IdGenerator) GetIds(n int) ([]int64, error) {
-	if !sig.initFlag {
-		return nil, ErrInitExpected
+	sig.issueLock.RLock()
+	defer sig.issueLock.RUnlock()
+	if err := sig.Ready(); err != nil {
+		return nil, err
 	}
 	result := make([]int64, 0, n)
 	if n <= 1 {
@@ -84,3 +308,76 @@ func (sig *IdGenerator) GetIds(n int) ([]int64, error) {
 	}
 	return result, nil
 }
+
+// GetJsSafeIds 获取n个使用JsSafeLayout生成的id，不超过 2^53-1，未启用时返回ErrJsSafeDisabled
+func (sig *IdGenerator) GetJsSafeIds(n int) ([]int64, error) {
+	sig.issueLock.RLock()
+	defer sig.issueLock.RUnlock()
+	if err := sig.Ready(); err != nil {
+		return nil, err
+	}
+	if sig.jsSafe == nil {
+		return nil, ErrJsSafeDisabled
+	}
+	if n <= 1 {
+		n = 1
+	}
+	result := make([]int64, 0, n)
+	for i := 0; i < n; i++ {
+		v, err := sig.jsSafe.GetId()
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, v)
+	}
+	return result, nil
+}
+
+// lastTimestamp 已发放id的最新时间戳，启用js-safe时取两种id中最新的，单位ms
+func (sig *IdGenerator) lastTimestamp() int64 {
+	lastTimestamp := sl.LastTimestamp()
+	if sig.jsSafe != nil {
+		if t := sig.jsSafe.LastTimestamp(); t > lastTimestamp {
+			lastTimestamp = t
+		}
+	}
+	return lastTimestamp
+}
+
+// Close 停止发放id，释放workerId，关闭WorkerIdProvider
+func (sig *IdGenerator) Close() {
+	sig.closeLock.Lock()
+	defer sig.closeLock.Unlock()
+	if sig.workerIdHolder == nil || sig.closed {
+		return
+	}
+	sig.closed = true
+	sig.release()
+	if sig.conflictDetector != nil {
+		sig.conflictDetector.Close()
+	}
+	sig.closeSpares()
+	closeProvider(sig.workerIdProvider)
+	log.Printf("IdGenerator closed. workerId: %d", sig.workerId)
+}
+
+// release 停止发放id，等待正在进行的发放完成后，将已发放id的最新时间戳上报给WorkerIdProvider并释放workerId，调用前需要加closeLock
+func (sig *IdGenerator) release() {
+	if sig.released.Load() {
+		return
+	}
+	sig.issueLock.Lock()
+	sig.released.Store(true)
+	sig.initFlag.Store(false)
+	lastTimestamp := sig.lastTimestamp()
+	sig.issueLock.Unlock()
+	sig.releaseSpares()
+	if sig.leaseKeeper != nil {
+		sig.leaseKeeper.release()
+	}
+	sig.workerIdHolder.close(lastTimestamp)
+	if sig.conflictDetector != nil {
+		sig.conflictDetector.Release(lastTimestamp)
+	}
+	log.Printf("workerId %d released, last timestamp: %d", sig.workerId, lastTimestamp)
+}
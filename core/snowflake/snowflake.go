@@ -1,13 +1,20 @@
 package snowflake
 
 import (
-	"errors"
+	"log"
 	"math/rand"
+	"sfgo/core"
 	"sync"
 	"time"
 )
 
-var ErrCurrentTime = errors.New("snowflake: current time error")
+var ErrCurrentTime = core.NewError(core.ErrCodeClockBackwards, "snowflake: current time error", 0)
+
+// ErrSequenceExhausted 当前毫秒的序列号已用完，且时钟停滞或回拨，未能在maxSequenceWait内等到下一毫秒
+var ErrSequenceExhausted = core.NewError(core.ErrCodeSequenceExhausted, "snowflake: sequence exhausted", time.Millisecond)
+
+// 序列号用完时，等待下一毫秒的最长时间
+const maxSequenceWait = 5 * time.Millisecond
 
 // 起始时间戳，用于用当前时间戳减去这个时间戳，算出偏移量
 const twepoch int64 = 1288834974657
@@ -31,78 +38,214 @@ const timestampLeftShift int64 = sequenceBits + workerIdBits
 const sequenceMask int64 = -1 ^ (-1 << sequenceBits)
 
 type Snowflake struct {
+	// 位分配方式
+	layout Layout
 	// 保存该节点的workId
 	workerId int64
 	// 序列号
 	sequence int64
-	// 上一次请求id时所用的时间戳
+	// 上一次请求id时所用的时间戳，单位为layout的时间戳单位
 	lastTimestamp int64
+	// 备用workerId，时钟回拨超过5ms时临时使用
+	spares []*spareWorker
+	// 正在使用的备用workerId，为nil时使用workerId
+	active *spareWorker
 	// 锁
 	lock sync.Mutex
 }
 
-// NewSnowflake 创建实例
+// spareWorker 备用workerId，各自记录序列号及所用的最新时间戳，保证与回拨前生成的id不重复
+type spareWorker struct {
+	workerId      int64
+	sequence      int64
+	lastTimestamp int64
+	// 不为nil时，返回error表示不能使用，e.g. 租约已丢失
+	available func() error
+}
+
+// NewSnowflake 创建实例，使用DefaultLayout
 func NewSnowflake(workerId int64) *Snowflake {
+	return NewLayoutSnowflake(workerId, DefaultLayout)
+}
+
+// NewLayoutSnowflake 使用指定的位分配方式创建实例，workerId需要在位分配方式的取值范围内
+func NewLayoutSnowflake(workerId int64, layout Layout) *Snowflake {
 	return &Snowflake{
+		layout:        layout,
 		workerId:      workerId,
 		sequence:      0,
 		lastTimestamp: -1,
 	}
 }
 
+// AddSpare 添加备用workerId，仅使用时间戳大于等于since的部分，since之前的时间可能已被该workerId的上一个占用者使用
+func (s *Snowflake) AddSpare(workerId, since int64, available func() error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.spares = append(s.spares, &spareWorker{
+		workerId:      workerId,
+		lastTimestamp: since,
+		available:     available,
+	})
+}
+
+// ActiveWorkerId 当前用于生成id的workerId，时钟回拨期间为备用workerId
+func (s *Snowflake) ActiveWorkerId() int64 {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.active != nil {
+		return s.active.workerId
+	}
+	return s.workerId
+}
+
 func MaxWorkerId() int64 {
 	return maxWorkerId
 }
 
+// allocatableMaxWorkerId 分配workerId的WorkerIdProvider可以分配的最大值，启用js-safe时为JsSafeLayout的最大值
+func allocatableMaxWorkerId() int64 {
+	if conf.JsSafe {
+		return JsSafeLayout.MaxWorkerId()
+	}
+	return maxWorkerId
+}
+
+// LayoutName 位分配方式，格式为 时间戳位数-workerId位数-序列号位数，e.g. 41-10-12
+func LayoutName() string {
+	return DefaultLayout.Name()
+}
+
+// LastTimestamp 上一次生成id所用的时间戳，单位ms，使用过备用workerId时，取各workerId所用时间戳中最大的
+//
+// 时间戳单位为秒时为该秒的最后一毫秒，重启后需要等待时间超过该时间戳，才能保证与之前生成的id不重复
+func (s *Snowflake) LastTimestamp() int64 {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	lastTimestamp := s.lastTimestamp
+	for _, spare := range s.spares {
+		if spare.lastTimestamp > lastTimestamp {
+			lastTimestamp = spare.lastTimestamp
+		}
+	}
+	if unit := s.layout.unitMillis(); unit > 1 && lastTimestamp >= 0 {
+		return lastTimestamp*unit + unit - 1
+	}
+	return lastTimestamp
+}
+
 // GetId 获取id
 //
 // 生成id号需要的时间戳和序列号
 // 1. 时间戳要求大于等于上一次用的时间戳（主要解决机器工作时NTP时间同步问题）
 // 2. 序列号在时间戳相等的情况下要递增，大于的情况下回到起点
+// 3. 时间回退超过5ms时，使用时间戳未被占用的备用workerId，时间超过回退前的时间戳后再换回workerId
+//
+// 时间戳单位为秒时，时间回退即使用备用workerId，没有备用workerId时返回错误
 func (s *Snowflake) GetId() (int64, error) {
 	rand.Seed(time.Now().UnixNano())
 	s.lock.Lock()
 	defer s.lock.Unlock()
+	unit := s.layout.unitMillis()
 	// 获取当前时间戳，timestamp用于记录生成id的时间戳
-	timestamp := timeGen()
+	timestamp := s.layout.tick()
+	// 时间已超过回退前的时间戳，换回workerId
+	if s.active != nil && timestamp > s.lastTimestamp {
+		s.switchTo(nil, timestamp)
+	}
+	workerId, sequence, lastTimestamp := s.current()
 	// 如果比上一次记录的时间戳早，也就是NTP造成时间回退了
-	if timestamp < s.lastTimestamp {
-		offset := s.lastTimestamp - timestamp
-		if offset <= 5 {
+	if timestamp < *lastTimestamp {
+		offset := *lastTimestamp - timestamp
+		if unit == 1 && offset <= 5 {
 			// 等待 2*offset ms就可以唤醒重新尝试获取锁继续执行。当然，在这段时间内lastTimestamp很可能又被更新了
 			time.Sleep(time.Duration(offset<<1) * time.Millisecond)
 			// 重新获取当前时间戳，理论上这次应该比上一次记录的时间戳迟了
 			timestamp = timeGen()
 			// 如果还是早，这绝对是有问题的
-			if timestamp < s.lastTimestamp {
-				return 0, ErrCurrentTime
+			if timestamp < *lastTimestamp {
+				return 0, ErrCurrentTime.WithRetryAfter(time.Duration(*lastTimestamp-timestamp) * time.Millisecond)
 			}
 		} else {
-			return 0, ErrCurrentTime
+			// 换成时间戳未被占用的备用workerId
+			spare := s.selectSpare(timestamp)
+			if spare == nil {
+				return 0, ErrCurrentTime.WithRetryAfter(time.Duration(offset*unit) * time.Millisecond)
+			}
+			s.switchTo(spare, timestamp)
+			workerId, sequence, lastTimestamp = s.current()
 		}
 	}
 	// 如果从上一个逻辑分支产生的timestamp仍然和lastTimestamp相等
-	if s.lastTimestamp == timestamp {
+	if *lastTimestamp == timestamp {
 		// 自增序列+1然后取后12位的值
-		s.sequence = (s.sequence + 1) & sequenceMask
+		*sequence = (*sequence + 1) & s.layout.sequenceMask()
 		// seq 为0的时候表示当前毫秒12位自增序列用完了，应该用下一毫秒时间来区别，否则就重复了
-		if s.sequence == 0 {
-			// 对seq做随机作为起始，主要出于DB分表均匀的考虑
-			s.sequence = int64(rand.Int31n(100))
+		if *sequence == 0 {
 			// 生成比lastTimestamp滞后的时间戳
-			timestamp = tilNextMillis(s.lastTimestamp)
+			next, ok := s.waitNextTick(*lastTimestamp, maxSequenceWait)
+			if !ok {
+				// 保持序列号已用完的状态，下次请求继续等待下一毫秒
+				*sequence = s.layout.sequenceMask()
+				if unit > 1 {
+					return 0, ErrSequenceExhausted.WithRetryAfter(time.Duration((*lastTimestamp+1)*unit-timeGen()) * time.Millisecond)
+				}
+				return 0, ErrSequenceExhausted
+			}
+			// 对seq做随机作为起始，主要出于DB分表均匀的考虑
+			*sequence = int64(rand.Int31n(100))
+			timestamp = next
 		}
 	} else {
 		// 如果是新的ms开始，序列号要重新回到大致的起点
-		s.sequence = rand.Int63n(100)
+		*sequence = rand.Int63n(100)
 	}
 	// 记录这次请求id的时间戳，用于下一个请求进行比较
-	s.lastTimestamp = timestamp
+	*lastTimestamp = timestamp
 	// 利用生成的时间戳、序列号和workId组合成id
-	id := ((timestamp - twepoch) << timestampLeftShift) | (s.workerId << workerIdShift) | s.sequence
+	id := s.layout.compose(timestamp, workerId, *sequence)
 	return id, nil
 }
 
+// current 当前使用的workerId及其序列号、最新时间戳，调用前需要加锁
+func (s *Snowflake) current() (int64, *int64, *int64) {
+	if s.active != nil {
+		return s.active.workerId, &s.active.sequence, &s.active.lastTimestamp
+	}
+	return s.workerId, &s.sequence, &s.lastTimestamp
+}
+
+// selectSpare 选择可用且所用时间戳不晚于timestamp的备用workerId，调用前需要加锁
+func (s *Snowflake) selectSpare(timestamp int64) *spareWorker {
+	for _, spare := range s.spares {
+		if spare == s.active || spare.lastTimestamp > timestamp {
+			continue
+		}
+		if spare.available != nil {
+			if err := spare.available(); err != nil {
+				continue
+			}
+		}
+		return spare
+	}
+	return nil
+}
+
+// switchTo 换成备用workerId，spare为nil时换回workerId，调用前需要加锁
+func (s *Snowflake) switchTo(spare *spareWorker, timestamp int64) {
+	from, _, _ := s.current()
+	s.active = spare
+	if spare == nil {
+		log.Printf("time %d has passed last timestamp %d of workerId %d, switch back from spare workerId %d", timestamp, s.lastTimestamp, s.workerId, from)
+		activeWorkerIdGauge.Set(float64(s.workerId))
+		spareSwitches.WithLabelValues("primary").Inc()
+		return
+	}
+	log.Printf("clock moved backwards to %d, last timestamp of workerId %d is %d, switch from workerId %d to spare workerId %d", timestamp, s.workerId, s.lastTimestamp, from, spare.workerId)
+	activeWorkerIdGauge.Set(float64(spare.workerId))
+	spareSwitches.WithLabelValues("spare").Inc()
+}
+
 func tilNextMillis(lastTimestamp int64) int64 {
 	timestamp := timeGen()
 	for timestamp <= lastTimestamp {
@@ -112,6 +255,21 @@ func tilNextMillis(lastTimestamp int64) int64 {
 	return timestamp
 }
 
-func timeGen() int64 {
+// waitNextTick 等待时间超过lastTimestamp，单位为layout的时间戳单位，超过maxWait仍未等到时返回false
+func (s *Snowflake) waitNextTick(lastTimestamp int64, maxWait time.Duration) (int64, bool) {
+	start := time.Now()
+	timestamp := s.layout.tick()
+	for timestamp <= lastTimestamp {
+		if time.Since(start) > maxWait {
+			return timestamp, false
+		}
+		time.Sleep(100 * time.Microsecond)
+		timestamp = s.layout.tick()
+	}
+	return timestamp, true
+}
+
+// timeGen 当前时间戳，单位ms，测试中替换以模拟时钟回拨
+var timeGen = func() int64 {
 	return time.Now().UnixMilli()
 }
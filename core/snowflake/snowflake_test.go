@@ -0,0 +1,66 @@
+package snowflake
+
+import (
+	"sync/atomic"
+	"testing"
+)
+
+// setClock 将timeGen替换为返回clock的值，测试结束后恢复
+func setClock(t *testing.T, clock *int64) {
+	t.Helper()
+	prev := timeGen
+	timeGen = func() int64 {
+		return atomic.LoadInt64(clock)
+	}
+	t.Cleanup(func() { timeGen = prev })
+}
+
+func TestSnowflakeUsesSpareWhenClockMovesBackwards(t *testing.T) {
+	start := timeGen()
+	clock := start
+	setClock(t, &clock)
+	sf := NewSnowflake(1)
+	sf.AddSpare(2, 0, nil)
+	seen := make(map[int64]bool)
+	generate := func(wantWorkerId int64) {
+		t.Helper()
+		for i := 0; i < 10; i++ {
+			id, err := sf.GetId()
+			if err != nil {
+				t.Fatalf("time %d: %v", atomic.LoadInt64(&clock)-start, err)
+			}
+			if seen[id] {
+				t.Fatalf("time %d: id %d is reused", atomic.LoadInt64(&clock)-start, id)
+			}
+			seen[id] = true
+			parts, err := DefaultLayout.Decompose(id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if parts.WorkerId != wantWorkerId || parts.Timestamp != atomic.LoadInt64(&clock) {
+				t.Fatalf("time %d: got %+v, want worker id %d", atomic.LoadInt64(&clock)-start, parts, wantWorkerId)
+			}
+		}
+		if active := sf.ActiveWorkerId(); active != wantWorkerId {
+			t.Fatalf("time %d: got active worker id %d, want %d", atomic.LoadInt64(&clock)-start, active, wantWorkerId)
+		}
+	}
+	for ; clock < start+20; clock++ {
+		generate(1)
+	}
+	last := clock - 1
+	// 回拨100ms，在时间超过回拨前的时间戳之前一直使用备用workerId
+	for clock = last - 100; clock <= last; clock++ {
+		generate(2)
+	}
+	// 时间超过回拨前的时间戳后换回workerId
+	generate(1)
+	if got := sf.LastTimestamp(); got != last+1 {
+		t.Fatalf("got last timestamp %d, want %d", got, last+1)
+	}
+	// 再次回拨到备用workerId用过的时间内，备用workerId只使用时间戳不早于自己最新时间戳的部分
+	clock = last - 50
+	if _, err := sf.GetId(); err == nil {
+		t.Fatal("clock moved backwards into the time used by the spare should fail")
+	}
+}
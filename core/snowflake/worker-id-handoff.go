@@ -0,0 +1,29 @@
+package snowflake
+
+import (
+	"fmt"
+	"log"
+)
+
+/*
+ * workerId交接。滚动更新时新实例可能在旧实例停止前启动，并获得相同的workerId（e.g. hostname、SNOWFLAKE_WORKER_ID、
+ * zookeeper中被释放的workerId），新实例需要等待旧实例释放workerId，并等待时间超过旧实例已发放id的最新时间戳后再发放id
+ */
+
+// 上一个占用者已发放id的最新时间戳比当前时间晚的最大允许值，单位ms，超过时说明时钟回拨
+const maxHandoffClockSkew = 5000
+
+// waitPastTimestamp 等待时间超过上一个占用者已发放id的最新时间戳，时间戳比当前时间晚太多时返回error
+//
+// source 时间戳的来源，用于日志
+func waitPastTimestamp(previousTimestamp int64, source string) error {
+	curTimestamp := timeGen()
+	if previousTimestamp-curTimestamp > maxHandoffClockSkew {
+		return fmt.Errorf("init timestamp check error, %s timestamp %d gt this node time %d", source, previousTimestamp, curTimestamp)
+	}
+	if previousTimestamp >= curTimestamp {
+		log.Printf("wait until %s timestamp %d has passed, this node time %d", source, previousTimestamp, curTimestamp)
+		tilNextMillis(previousTimestamp)
+	}
+	return nil
+}
@@ -1,6 +1,7 @@
 package snowflake
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
@@ -8,20 +9,48 @@ import (
 	"path/filepath"
 	"sfgo/common/fileutil"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
 )
 
 /*
  * WorkerId 保持器。即，只要成功从WorkerIdProvider获取一次ID，就将id保存至本地文件，下次启动时，如果从WorkerIdProvider获取失败，则会读取本地文件
  */
 
-var propPath = filepath.Join(os.TempDir(), "snowflake-go", "%s", "conf", "%s", "workerId.properties")
+// 旧版本保存workerId的文件，内容仅为workerId
+var legacyPropPath = filepath.Join(os.TempDir(), "snowflake-go", "%s", "conf", "%s", "workerId.properties")
+
+// workerIdRecord 本地文件中保存的workerId信息
+type workerIdRecord struct {
+	AppName  string `json:"appName"`
+	IP       string `json:"ip"`
+	Port     string `json:"port"`
+	WorkerId int64  `json:"workerId"`
+	// 提供workerId的WorkerIdProvider名称
+	Provider string `json:"provider"`
+	// 位分配方式
+	Layout string `json:"layout"`
+	// 已发放id的最新时间戳
+	LastTimestamp int64 `json:"lastTimestamp"`
+	// 更新时间，unix毫秒
+	UpdatedAt int64 `json:"updatedAt"`
+}
 
 type WorkerIdHolder struct {
 	ip               string
 	port             string
 	appName          string
-	localPropPath    string
+	localPath        string
 	workerIdProvider WorkerIdProvider
+	// workerId是否由workerIdProvider提供
+	fromProvider bool
+	// workerIdProvider以租约方式提供workerId时，workerId的租约
+	lease Lease
+	// 最后一次写入本地文件的记录
+	record  *workerIdRecord
+	closeCh chan struct{}
+	lock    sync.Mutex
 }
 
 // NewWorkerIdHolder 创建WorkerId保持器
@@ -36,7 +65,7 @@ func newWorkerIdHolder(ip, port, appName string, workerIdProvider WorkerIdProvid
 		ip:               ip,
 		port:             port,
 		appName:          appName,
-		localPropPath:    fmt.Sprintf(propPath, appName, port),
+		localPath:        filepath.Join(conf.StateDir, appName, port, "worker-id.json"),
 		workerIdProvider: workerIdProvider,
 	}
 }
@@ -50,8 +79,15 @@ func (wih *WorkerIdHolder) GetWorkerId() (int64, error) {
 	}
 	workerId, err := wih.workerIdProvider.GetWorkerId()
 	if err == nil {
+		if err = wih.acquireLease(workerId); err != nil {
+			return 0, err
+		}
+		if err = wih.waitPreviousRun(workerId); err != nil {
+			return 0, err
+		}
 		// 获取成功，则保存到本地
-		wih.saveWorkerIdLocal(strconv.FormatInt(workerId, 10))
+		wih.saveWorkerIdLocal(workerId)
+		wih.fromProvider = true
 		return workerId, nil
 	} else {
 		// 获取失败，则尝试从本地获取
@@ -60,35 +96,189 @@ func (wih *WorkerIdHolder) GetWorkerId() (int64, error) {
 	}
 }
 
-func (wih *WorkerIdHolder) saveWorkerIdLocal(workerId string) {
-	os.MkdirAll(filepath.Dir(wih.localPropPath), 0666)
-	_, err := os.Create(wih.localPropPath)
+// acquireLease workerIdProvider支持租约时获取租约
+func (wih *WorkerIdHolder) acquireLease(workerId int64) error {
+	lp, ok := wih.workerIdProvider.(LeaseProvider)
+	if !ok {
+		return nil
+	}
+	lease, err := lp.Lease()
+	if errors.Is(err, ErrLeaseNotSupported) {
+		return nil
+	}
 	if err != nil {
-		log.Fatalln(err)
+		return fmt.Errorf("get lease of workerId failed. %s", err.Error())
+	}
+	if lease.WorkerId() != workerId {
+		return fmt.Errorf("lease is for workerId %d, but the workerId is %d", lease.WorkerId(), workerId)
+	}
+	wih.lease = lease
+	return nil
+}
+
+// waitPreviousRun 本地文件中为同一workerId时，等待时间超过上次运行时已发放id的最新时间戳，e.g. 使用持久化卷的实例重启
+func (wih *WorkerIdHolder) waitPreviousRun(workerId int64) error {
+	previous, err := wih.loadRecord()
+	if err != nil || previous.WorkerId != workerId {
+		return nil
+	}
+	return waitPastTimestamp(previous.LastTimestamp, "local file "+wih.localPath)
+}
+
+// Lease workerId的租约，workerIdProvider不支持租约或workerId来自本地文件时为nil
+func (wih *WorkerIdHolder) Lease() Lease {
+	return wih.lease
+}
+
+// FromProvider workerId是否由workerIdProvider提供，为false时，workerId来自本地文件
+func (wih *WorkerIdHolder) FromProvider() bool {
+	return wih.fromProvider
+}
+
+// saveWorkerIdLocal 保存workerId，本地文件中为同一workerId时，保留其已发放id的最新时间戳
+func (wih *WorkerIdHolder) saveWorkerIdLocal(workerId int64) {
+	record := &workerIdRecord{
+		AppName:  wih.appName,
+		IP:       wih.ip,
+		Port:     wih.port,
+		WorkerId: workerId,
+		Provider: GetProviderName(wih.workerIdProvider),
+		Layout:   LayoutName(),
+	}
+	if previous, err := wih.loadRecord(); err == nil && previous.WorkerId == workerId {
+		record.LastTimestamp = previous.LastTimestamp
+	}
+	if err := wih.writeRecord(record); err != nil {
+		// 本地文件仅在WorkerIdProvider不可用时使用，写入失败不影响启动
+		log.Printf("save workerId %d to local file %s failed. %s", workerId, wih.localPath, err.Error())
+		return
+	}
+	log.Printf("save workerId %d to local file %s", workerId, wih.localPath)
+}
+
+// writeRecord 原子地写入本地文件
+func (wih *WorkerIdHolder) writeRecord(record *workerIdRecord) error {
+	wih.lock.Lock()
+	defer wih.lock.Unlock()
+	record.UpdatedAt = time.Now().UnixMilli()
+	data, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(wih.localPath), 0755); err != nil {
+		return err
+	}
+	if err = fileutil.WriteFileAtomic(wih.localPath, data, 0644); err != nil {
+		return err
 	}
-	err = os.WriteFile(wih.localPropPath, []byte(workerId), 0666)
+	wih.record = record
+	return nil
+}
+
+// loadRecord 读取本地文件，并校验是否属于当前应用
+func (wih *WorkerIdHolder) loadRecord() (*workerIdRecord, error) {
+	b, err := os.ReadFile(wih.localPath)
 	if err != nil {
-		log.Fatalln(err)
+		return nil, err
+	}
+	var record workerIdRecord
+	if err = json.Unmarshal(b, &record); err != nil {
+		return nil, fmt.Errorf("local file %s is broken. %s", wih.localPath, err.Error())
+	}
+	if record.AppName != wih.appName || record.Port != wih.port {
+		return nil, fmt.Errorf("local file %s belongs to %s on port %s, not %s on port %s", wih.localPath, record.AppName, record.Port, wih.appName, wih.port)
 	}
-	log.Printf("save workerId %s to local file %s", workerId, wih.localPropPath)
+	if record.Layout != LayoutName() {
+		return nil, fmt.Errorf("local file %s was saved with layout %s, but the current layout is %s", wih.localPath, record.Layout, LayoutName())
+	}
+	if record.WorkerId < 0 || record.WorkerId > MaxWorkerId() {
+		return nil, fmt.Errorf("workerId %d in local file %s must between 0 and %d", record.WorkerId, wih.localPath, MaxWorkerId())
+	}
+	return &record, nil
 }
 
+// getWorkerIdLocal 读取本地文件中的workerId，并等待时间超过已发放id的最新时间戳
 func (wih *WorkerIdHolder) getWorkerIdLocal() (int64, error) {
-	if !fileutil.Exists(wih.localPropPath) {
-		return 0, fmt.Errorf("the prop file doesn't exists, %s", wih.localPropPath)
+	if !fileutil.Exists(wih.localPath) {
+		return wih.getWorkerIdLegacy()
 	}
-	b, err := os.ReadFile(wih.localPropPath)
+	record, err := wih.loadRecord()
 	if err != nil {
-		log.Fatalln(err)
+		return 0, err
+	}
+	if err = waitPastTimestamp(record.LastTimestamp, "local file "+wih.localPath); err != nil {
+		return 0, err
 	}
-	if len(b) != 0 {
-		id, err := strconv.ParseInt(string(b), 10, 64)
-		if err != nil {
-			log.Fatalln(err)
+	wih.lock.Lock()
+	wih.record = record
+	wih.lock.Unlock()
+	log.Printf("get workerId %d via local file %s, saved by provider %s", record.WorkerId, wih.localPath, record.Provider)
+	return record.WorkerId, nil
+}
+
+// getWorkerIdLegacy 读取旧版本保存的workerId，读取成功后保存为新的格式
+func (wih *WorkerIdHolder) getWorkerIdLegacy() (int64, error) {
+	legacyPath := fmt.Sprintf(legacyPropPath, wih.appName, wih.port)
+	b, err := os.ReadFile(legacyPath)
+	if os.IsNotExist(err) {
+		return 0, fmt.Errorf("the local file doesn't exists, %s", wih.localPath)
+	}
+	if err != nil {
+		return 0, err
+	}
+	workerId, err := strconv.ParseInt(strings.TrimSpace(string(b)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("the worker id in local file %s is wrong. %s", legacyPath, err.Error())
+	}
+	if workerId < 0 || workerId > MaxWorkerId() {
+		return 0, fmt.Errorf("workerId %d in local file %s must between 0 and %d", workerId, legacyPath, MaxWorkerId())
+	}
+	log.Printf("get workerId %d via legacy local file %s", workerId, legacyPath)
+	wih.saveWorkerIdLocal(workerId)
+	return workerId, nil
+}
+
+// startSync 定时将已发放id的最新时间戳写入本地文件
+func (wih *WorkerIdHolder) startSync(issuedTimestampFunc func() int64) {
+	// 间隔小于等于0时仅在关闭时写入
+	if conf.StateSyncInterval <= 0 {
+		return
+	}
+	wih.closeCh = make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(time.Duration(conf.StateSyncInterval) * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-wih.closeCh:
+				return
+			case <-ticker.C:
+				wih.saveLastTimestamp(issuedTimestampFunc())
+			}
 		}
-		log.Printf("get workerId via local file %s\n", wih.localPropPath)
-		return id, nil
-	} else {
-		return 0, errors.New("the worker id in local file is empty")
+	}()
+}
+
+// saveLastTimestamp 已发放id的最新时间戳有变化时写入本地文件
+func (wih *WorkerIdHolder) saveLastTimestamp(timestamp int64) {
+	wih.lock.Lock()
+	if wih.record == nil || timestamp <= wih.record.LastTimestamp {
+		wih.lock.Unlock()
+		return
+	}
+	record := *wih.record
+	wih.lock.Unlock()
+	record.LastTimestamp = timestamp
+	if err := wih.writeRecord(&record); err != nil {
+		log.Printf("save last timestamp to local file %s failed. %s", wih.localPath, err.Error())
+	}
+}
+
+// close 停止定时写入，并写入最后的时间戳
+func (wih *WorkerIdHolder) close(lastTimestamp int64) {
+	if wih.closeCh != nil {
+		close(wih.closeCh)
+		wih.closeCh = nil
 	}
+	wih.saveLastTimestamp(lastTimestamp)
 }
@@ -0,0 +1,185 @@
+package snowflake
+
+import (
+	"log"
+	"sfgo/core"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrLeaseExpired workerId的租约已到期，停止发放id
+	ErrLeaseExpired = core.NewError(core.ErrCodeWorkerLeaseExpired, "IdGenerator: lease of worker id expired", time.Second)
+	// ErrLeaseLost workerId的租约已丢失，停止发放id
+	ErrLeaseLost = core.NewError(core.ErrCodeWorkerLeaseLost, "IdGenerator: lease of worker id lost", 0)
+)
+
+// leaseState 租约的到期时间及丢失状态，供WorkerIdProvider实现Lease时使用
+type leaseState struct {
+	// 租约时长，小于等于0时不会到期
+	ttl      time.Duration
+	expiry   time.Time
+	lostCh   chan struct{}
+	lostOnce sync.Once
+	lock     sync.Mutex
+}
+
+func newLeaseState(ttl time.Duration) *leaseState {
+	return &leaseState{
+		ttl:    ttl,
+		lostCh: make(chan struct{}),
+	}
+}
+
+// extend 从当前时间开始延长租约，返回新的到期时间
+func (s *leaseState) extend() time.Time {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.ttl > 0 {
+		s.expiry = time.Now().Add(s.ttl)
+	}
+	return s.expiry
+}
+
+func (s *leaseState) Expiry() time.Time {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.expiry
+}
+
+func (s *leaseState) Lost() <-chan struct{} {
+	return s.lostCh
+}
+
+// markLost 租约丢失
+func (s *leaseState) markLost(workerId int64, reason string) {
+	s.lostOnce.Do(func() {
+		log.Printf("lease of workerId %d lost, stop issuing ids. %s", workerId, reason)
+		close(s.lostCh)
+	})
+}
+
+// latestTimestamp 当前时间戳与已发放id的最新时间戳中较大的
+func latestTimestamp(issuedTimestamp int64) int64 {
+	if timestamp := timeGen(); timestamp > issuedTimestamp {
+		return timestamp
+	}
+	return issuedTimestamp
+}
+
+// leaseKeeper 定时续约，租约到期或丢失时，IdGenerator停止发放id
+type leaseKeeper struct {
+	lease Lease
+	// 获取已发放id的最新时间戳
+	issuedTimestampFunc func() int64
+	expiry              time.Time
+	lost                bool
+	released            bool
+	// 是否为备用workerId的租约，不更新租约到期时间的监控指标
+	spare   bool
+	closeCh chan struct{}
+	lock    sync.Mutex
+}
+
+func newLeaseKeeper(lease Lease, issuedTimestampFunc func() int64) *leaseKeeper {
+	return &leaseKeeper{
+		lease:               lease,
+		issuedTimestampFunc: issuedTimestampFunc,
+		expiry:              lease.Expiry(),
+		closeCh:             make(chan struct{}),
+	}
+}
+
+// start 启动续约
+func (k *leaseKeeper) start() {
+	k.updateExpiryGauge()
+	go k.run()
+}
+
+func (k *leaseKeeper) run() {
+	ticker := time.NewTicker(k.lease.RenewInterval())
+	defer ticker.Stop()
+	for {
+		select {
+		case <-k.closeCh:
+			return
+		case <-k.lease.Lost():
+			k.lock.Lock()
+			k.lost = true
+			k.lock.Unlock()
+			leaseRenewals.WithLabelValues("lost").Inc()
+			return
+		case <-ticker.C:
+			k.renew()
+		}
+	}
+}
+
+// renew 续约，失败时保留原到期时间，下次继续尝试
+func (k *leaseKeeper) renew() {
+	expiry, err := k.lease.Renew(k.issuedTimestampFunc())
+	if err != nil {
+		leaseRenewals.WithLabelValues("failed").Inc()
+		log.Printf("renew lease of workerId %d failed, expiry: %s. %s", k.lease.WorkerId(), k.Expiry().Format(time.RFC3339Nano), err.Error())
+		return
+	}
+	leaseRenewals.WithLabelValues("succeeded").Inc()
+	k.lock.Lock()
+	k.expiry = expiry
+	k.lock.Unlock()
+	k.updateExpiryGauge()
+}
+
+func (k *leaseKeeper) updateExpiryGauge() {
+	if k.spare {
+		return
+	}
+	expiry := k.Expiry()
+	if expiry.IsZero() {
+		leaseExpiry.Set(0)
+		return
+	}
+	leaseExpiry.Set(float64(expiry.UnixMilli()) / 1000)
+}
+
+// Expiry 到期时间
+func (k *leaseKeeper) Expiry() time.Time {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+	return k.expiry
+}
+
+// Valid 租约是否有效，无效时返回原因
+func (k *leaseKeeper) Valid() error {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+	if k.lost || k.released {
+		return ErrLeaseLost
+	}
+	select {
+	case <-k.lease.Lost():
+		return ErrLeaseLost
+	default:
+	}
+	if !k.expiry.IsZero() && time.Now().After(k.expiry) {
+		return ErrLeaseExpired
+	}
+	return nil
+}
+
+// release 停止续约并释放租约
+func (k *leaseKeeper) release() {
+	k.lock.Lock()
+	if k.released {
+		k.lock.Unlock()
+		return
+	}
+	k.released = true
+	k.lock.Unlock()
+	close(k.closeCh)
+	if err := k.lease.Release(k.issuedTimestampFunc()); err != nil {
+		log.Printf("release lease of workerId %d failed. %s", k.lease.WorkerId(), err.Error())
+		return
+	}
+	log.Printf("lease of workerId %d released", k.lease.WorkerId())
+}
@@ -0,0 +1,338 @@
+package snowflake
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// chainedMember 组合中的一个WorkerIdProvider
+type chainedMember struct {
+	name     string
+	provider WorkerIdProvider
+	// 创建失败的原因
+	err     error
+	timeout time.Duration
+}
+
+// ChainedWorkerIdProvider 组合多个WorkerIdProvider，按顺序尝试，使用第一个成功提供workerId的WorkerIdProvider
+//
+// e.g. WOKER_ID_PROVIDER=zookeeper,hostname,envirnment
+type ChainedWorkerIdProvider struct {
+	members  []*chainedMember
+	selected *chainedMember
+	workerId int64
+	lock     sync.Mutex
+}
+
+// NewChainedWorkerIdProvider 创建ChainedWorkerIdProvider
+//
+// names WorkerIdProvider名称，按顺序尝试
+//
+// allowOverlap 是否允许组合中各WorkerIdProvider的workerId取值范围重叠，重叠时不同实例可能获得相同的workerId
+func NewChainedWorkerIdProvider(names []string, allowOverlap bool) (*ChainedWorkerIdProvider, error) {
+	if len(names) == 0 {
+		return nil, errors.New("worker id provider names can't be empty")
+	}
+	members := make([]*chainedMember, 0, len(names))
+	for _, name := range names {
+		if _, ok := ProviderOptions(name); !ok {
+			return nil, fmt.Errorf("unknown worker id provider %q, valid names: %s", name, strings.Join(ProviderNames(), ", "))
+		}
+		member := &chainedMember{
+			name:    name,
+			timeout: time.Duration(getProviderTimeout(name)) * time.Millisecond,
+		}
+		// 创建失败时，初始化时跳过
+		member.provider, member.err = NewWorkerProvider(name)
+		if member.err != nil {
+			log.Println(member.err.Error())
+		}
+		members = append(members, member)
+	}
+	if !allowOverlap {
+		if err := checkRangeOverlap(members); err != nil {
+			return nil, err
+		}
+	}
+	return &ChainedWorkerIdProvider{
+		members:  members,
+		workerId: -1,
+	}, nil
+}
+
+// checkRangeOverlap 检查各WorkerIdProvider的workerId取值范围是否重叠
+func checkRangeOverlap(members []*chainedMember) error {
+	for i := 0; i < len(members); i++ {
+		if members[i].provider == nil {
+			continue
+		}
+		min1, max1 := getWorkerIdRange(members[i].provider)
+		for j := i + 1; j < len(members); j++ {
+			if members[j].provider == nil {
+				continue
+			}
+			min2, max2 := getWorkerIdRange(members[j].provider)
+			if min1 <= max2 && min2 <= max1 {
+				return fmt.Errorf("worker id range of provider %s [%d, %d] overlaps with %s [%d, %d], different instances may get the same worker id. set WOKER_ID_PROVIDER_ALLOW_OVERLAP=true to allow it",
+					members[i].name, min1, max1, members[j].name, min2, max2)
+			}
+		}
+	}
+	return nil
+}
+
+// getWorkerIdRange 获取WorkerIdProvider的workerId取值范围，未声明时为全部范围
+func getWorkerIdRange(provider WorkerIdProvider) (int64, int64) {
+	if r, ok := provider.(WorkerIdRanger); ok {
+		return r.WorkerIdRange()
+	}
+	return 0, MaxWorkerId()
+}
+
+type providerResult struct {
+	workerId int64
+	err      error
+}
+
+// Init 按顺序初始化WorkerIdProvider，直到某个WorkerIdProvider在超时时间内成功提供workerId
+func (cwp *ChainedWorkerIdProvider) Init(ip, port, appName string) error {
+	failures := make([]string, 0, len(cwp.members))
+	for _, member := range cwp.members {
+		if member.err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %s", member.name, member.err.Error()))
+			providerAttempts.WithLabelValues(member.name, "failed").Inc()
+			continue
+		}
+		workerId, err := cwp.tryMember(member, ip, port, appName)
+		if err != nil {
+			log.Printf("get workerId via %s failed, try next. %s", member.name, err.Error())
+			failures = append(failures, fmt.Sprintf("%s: %s", member.name, err.Error()))
+			continue
+		}
+		log.Printf("get workerId via %s succeeded. workerId: %d", member.name, workerId)
+		cwp.lock.Lock()
+		cwp.selected = member
+		cwp.workerId = workerId
+		cwp.lock.Unlock()
+		return nil
+	}
+	return errors.New("all worker id providers failed. " + strings.Join(failures, "; "))
+}
+
+// tryMember 在超时时间内初始化WorkerIdProvider并获取workerId
+func (cwp *ChainedWorkerIdProvider) tryMember(member *chainedMember, ip, port, appName string) (int64, error) {
+	resultCh := make(chan providerResult, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				resultCh <- providerResult{err: fmt.Errorf("%v", r)}
+			}
+		}()
+		err := member.provider.Init(ip, port, appName)
+		if err != nil {
+			resultCh <- providerResult{err: err}
+			return
+		}
+		workerId, err := member.provider.GetWorkerId()
+		resultCh <- providerResult{workerId: workerId, err: err}
+	}()
+	timer := time.NewTimer(member.timeout)
+	defer timer.Stop()
+	select {
+	case result := <-resultCh:
+		if result.err != nil {
+			providerAttempts.WithLabelValues(member.name, "failed").Inc()
+		} else {
+			providerAttempts.WithLabelValues(member.name, "succeeded").Inc()
+		}
+		return result.workerId, result.err
+	case <-timer.C:
+		providerAttempts.WithLabelValues(member.name, "timeout").Inc()
+		// 超时后才初始化成功的，需要释放其占用的资源
+		go func() {
+			if result := <-resultCh; result.err == nil {
+				log.Printf("worker id provider %s finished after timeout, close it", member.name)
+				closeProvider(member.provider)
+			}
+		}()
+		return 0, fmt.Errorf("timeout after %s", member.timeout)
+	}
+}
+
+// GetWorkerId 获取选中的WorkerIdProvider提供的workerId
+func (cwp *ChainedWorkerIdProvider) GetWorkerId() (int64, error) {
+	cwp.lock.Lock()
+	defer cwp.lock.Unlock()
+	if cwp.selected == nil {
+		return 0, fmt.Errorf("worker id is wrong. Please check the provider")
+	}
+	return cwp.workerId, nil
+}
+
+// Selected 成功提供workerId的WorkerIdProvider的名称，未初始化或都失败时为空
+func (cwp *ChainedWorkerIdProvider) Selected() string {
+	cwp.lock.Lock()
+	defer cwp.lock.Unlock()
+	if cwp.selected == nil {
+		return ""
+	}
+	return cwp.selected.name
+}
+
+func (cwp *ChainedWorkerIdProvider) selectedProvider() WorkerIdProvider {
+	cwp.lock.Lock()
+	defer cwp.lock.Unlock()
+	if cwp.selected == nil {
+		return nil
+	}
+	return cwp.selected.provider
+}
+
+// ProviderName 名称，选中后为选中的WorkerIdProvider的名称
+func (cwp *ChainedWorkerIdProvider) ProviderName() string {
+	if selected := cwp.Selected(); selected != "" {
+		return selected
+	}
+	names := make([]string, 0, len(cwp.members))
+	for _, member := range cwp.members {
+		names = append(names, member.name)
+	}
+	return strings.Join(names, ",")
+}
+
+// WorkerIdRange 各WorkerIdProvider取值范围的并集
+func (cwp *ChainedWorkerIdProvider) WorkerIdRange() (int64, int64) {
+	var min, max int64 = MaxWorkerId(), 0
+	for _, member := range cwp.members {
+		if member.provider == nil {
+			continue
+		}
+		lo, hi := getWorkerIdRange(member.provider)
+		if lo < min {
+			min = lo
+		}
+		if hi > max {
+			max = hi
+		}
+	}
+	return min, max
+}
+
+// SetIssuedTimestampFunc 转交给选中的WorkerIdProvider
+func (cwp *ChainedWorkerIdProvider) SetIssuedTimestampFunc(fn func() int64) {
+	if p, ok := cwp.selectedProvider().(IssuedTimestampAware); ok {
+		p.SetIssuedTimestampFunc(fn)
+	}
+}
+
+// Lease 选中的WorkerIdProvider的租约，不支持时返回ErrLeaseNotSupported
+func (cwp *ChainedWorkerIdProvider) Lease() (Lease, error) {
+	if p, ok := cwp.selectedProvider().(LeaseProvider); ok {
+		return p.Lease()
+	}
+	return nil, ErrLeaseNotSupported
+}
+
+// NewSpare 由选中的WorkerIdProvider创建备用WorkerIdProvider
+func (cwp *ChainedWorkerIdProvider) NewSpare(index int) (WorkerIdProvider, error) {
+	if p, ok := cwp.selectedProvider().(SpareWorkerIdProvider); ok {
+		return p.NewSpare(index)
+	}
+	return nil, fmt.Errorf("worker id provider %s doesn't provide spare worker ids", cwp.ProviderName())
+}
+
+// OwnershipConfirmed 选中的WorkerIdProvider不能确认归属时，视为已确认
+func (cwp *ChainedWorkerIdProvider) OwnershipConfirmed() bool {
+	if v, ok := cwp.selectedProvider().(OwnershipVerifier); ok {
+		return v.OwnershipConfirmed()
+	}
+	return true
+}
+
+// ListAllocations 使用第一个支持的WorkerIdProvider列出workerId分配记录
+func (cwp *ChainedWorkerIdProvider) ListAllocations(appName string) ([]WorkerIdAllocation, error) {
+	recycler, err := cwp.firstRecycler()
+	if err != nil {
+		return nil, err
+	}
+	return recycler.ListAllocations(appName)
+}
+
+// ExpireStaleAllocations 使用第一个支持的WorkerIdProvider回收workerId
+func (cwp *ChainedWorkerIdProvider) ExpireStaleAllocations(appName string, olderThan time.Duration) ([]WorkerIdAllocation, error) {
+	recycler, err := cwp.firstRecycler()
+	if err != nil {
+		return nil, err
+	}
+	return recycler.ExpireStaleAllocations(appName, olderThan)
+}
+
+func (cwp *ChainedWorkerIdProvider) firstRecycler() (WorkerIdRecycler, error) {
+	for _, member := range cwp.members {
+		if recycler, ok := member.provider.(WorkerIdRecycler); ok {
+			return recycler, nil
+		}
+	}
+	return nil, errors.New("none of the worker id providers supports listing or expiring allocations")
+}
+
+// ReleaseAllocation 使用第一个支持的WorkerIdProvider释放workerId
+func (cwp *ChainedWorkerIdProvider) ReleaseAllocation(appName string, workerId int64, force bool) (WorkerIdAllocation, error) {
+	admin, err := cwp.firstAdmin()
+	if err != nil {
+		return WorkerIdAllocation{}, err
+	}
+	return admin.ReleaseAllocation(appName, workerId, force)
+}
+
+// ReserveWorkerId 使用第一个支持的WorkerIdProvider保留workerId
+func (cwp *ChainedWorkerIdProvider) ReserveWorkerId(appName string, workerId int64, reason string) error {
+	admin, err := cwp.firstAdmin()
+	if err != nil {
+		return err
+	}
+	return admin.ReserveWorkerId(appName, workerId, reason)
+}
+
+// UnreserveWorkerId 使用第一个支持的WorkerIdProvider取消保留workerId
+func (cwp *ChainedWorkerIdProvider) UnreserveWorkerId(appName string, workerId int64) error {
+	admin, err := cwp.firstAdmin()
+	if err != nil {
+		return err
+	}
+	return admin.UnreserveWorkerId(appName, workerId)
+}
+
+// ListReservations 使用第一个支持的WorkerIdProvider列出保留的workerId
+func (cwp *ChainedWorkerIdProvider) ListReservations(appName string) ([]WorkerIdReservation, error) {
+	admin, err := cwp.firstAdmin()
+	if err != nil {
+		return nil, err
+	}
+	return admin.ListReservations(appName)
+}
+
+func (cwp *ChainedWorkerIdProvider) firstAdmin() (WorkerIdAdmin, error) {
+	for _, member := range cwp.members {
+		if admin, ok := member.provider.(WorkerIdAdmin); ok {
+			return admin, nil
+		}
+	}
+	return nil, errors.New("none of the worker id providers supports releasing or reserving worker ids")
+}
+
+// Close 关闭选中的WorkerIdProvider
+func (cwp *ChainedWorkerIdProvider) Close() {
+	closeProvider(cwp.selectedProvider())
+}
+
+// closeProvider 关闭WorkerIdProvider，释放连接等资源
+func closeProvider(provider WorkerIdProvider) {
+	if c, ok := provider.(interface{ Close() }); ok {
+		c.Close()
+	}
+}
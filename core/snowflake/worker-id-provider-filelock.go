@@ -0,0 +1,278 @@
+package snowflake
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sfgo/common/fileutil"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const PROVIDER_FILELOCK = "filelock"
+
+// FileLockConfig FileLockWorkerIdProvider的配置
+type FileLockConfig struct {
+	// 锁文件所在的目录，同一主机上的各进程需要使用相同的目录
+	Dir string
+	// workerId的取值范围
+	MinWorkerId int64
+	MaxWorkerId int64
+	// 上报时间戳的间隔
+	HeartbeatInterval time.Duration
+}
+
+// FileLockWorkerIdProvider 基于文件锁实现
+//
+// 用于同一主机上运行多个进程的场景，按顺序尝试对 Dir/appName/workerId.lock 加排它锁，加锁成功则使用该workerId，进程退出时锁自动释放。
+// 占用者信息及最新时间戳原子地写入 Dir/appName/workerId.json，获取workerId后，等待时间超过上一个占用者的最新时间戳，避免生成重复的id
+type FileLockWorkerIdProvider struct {
+	dir               string
+	minWorkerId       int64
+	maxWorkerId       int64
+	heartbeatInterval time.Duration
+	ip                string
+	port              string
+	workerId          int64
+	lockFile          *os.File
+	// 保存占用者信息及最新时间戳的文件
+	dataPath string
+	// workerId的租约，持有文件锁期间不会丢失，也不会到期
+	*leaseState
+	lock sync.Mutex
+}
+
+// lockFileData 锁文件中保存的数据
+type lockFileData struct {
+	Pid       int    `json:"pid"`
+	IP        string `json:"ip"`
+	Port      string `json:"port"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+// NewFileLockWorkerIdProvider 创建FileLockWorkerIdProvider
+func NewFileLockWorkerIdProvider(config FileLockConfig) (*FileLockWorkerIdProvider, error) {
+	if config.Dir == "" {
+		return nil, errors.New("lock file directory can't be empty")
+	}
+	if config.MinWorkerId < 0 || config.MaxWorkerId > MaxWorkerId() || config.MinWorkerId > config.MaxWorkerId {
+		return nil, fmt.Errorf("workerId range [%d, %d] is wrong, must between 0 and %d", config.MinWorkerId, config.MaxWorkerId, MaxWorkerId())
+	}
+	if config.HeartbeatInterval <= 0 {
+		return nil, errors.New("heartbeat interval must be greater than 0")
+	}
+	return &FileLockWorkerIdProvider{
+		dir:               config.Dir,
+		minWorkerId:       config.MinWorkerId,
+		maxWorkerId:       config.MaxWorkerId,
+		heartbeatInterval: config.HeartbeatInterval,
+		workerId:          -1,
+	}, nil
+}
+
+// Init 按顺序尝试对锁文件加排它锁，直到成功
+func (fwp *FileLockWorkerIdProvider) Init(ip, port, appName string) error {
+	fwp.ip = ip
+	fwp.port = port
+	dir := filepath.Join(fwp.dir, appName)
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return fmt.Errorf("create lock file directory failed. %s", err.Error())
+	}
+	for workerId := fwp.minWorkerId; workerId <= fwp.maxWorkerId; workerId++ {
+		path := filepath.Join(dir, strconv.FormatInt(workerId, 10)+".lock")
+		f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+		if err != nil {
+			return fmt.Errorf("open lock file failed. %s", err.Error())
+		}
+		locked, err := tryLockFile(f)
+		if err != nil {
+			f.Close()
+			return fmt.Errorf("lock file %s failed. %s", path, err.Error())
+		}
+		if !locked {
+			f.Close()
+			continue
+		}
+		// 等待时间超过上一个占用者的最新时间戳
+		dataPath := filepath.Join(dir, strconv.FormatInt(workerId, 10)+".json")
+		if err = fwp.waitPreviousTimestamp(dataPath, f); err != nil {
+			f.Close()
+			return err
+		}
+		fwp.lockFile = f
+		fwp.dataPath = dataPath
+		fwp.workerId = workerId
+		if err = fwp.writeData(timeGen()); err != nil {
+			f.Close()
+			return err
+		}
+		log.Printf("get workerId via file lock. workerId: %d, path: %s", workerId, path)
+		fwp.leaseState = newLeaseState(0)
+		return nil
+	}
+	return fmt.Errorf("no free workerId, all workerIds between %d and %d are locked by other processes, dir: %s", fwp.minWorkerId, fwp.maxWorkerId, dir)
+}
+
+// waitPreviousTimestamp 等待时间超过上一个占用者的最新时间戳，时间戳比当前时间晚太多时，说明时钟回拨，返回error
+//
+// 数据文件不存在时，读取旧版本写在锁文件中的数据，均不存在时说明workerId未被使用过。
+// 数据为空或无法解析时，无法确定上一个占用者的最新时间戳，等待一个完整的上报间隔
+func (fwp *FileLockWorkerIdProvider) waitPreviousTimestamp(dataPath string, lockFile *os.File) error {
+	path := dataPath
+	b, err := os.ReadFile(dataPath)
+	if os.IsNotExist(err) {
+		path = lockFile.Name()
+		if b, err = os.ReadFile(path); err == nil && len(b) == 0 {
+			return nil
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("read lock file data %s failed. %s", path, err.Error())
+	}
+	var data lockFileData
+	if err = json.Unmarshal(b, &data); err != nil || data.Timestamp <= 0 {
+		log.Printf("lock file data %s is empty or invalid, wait %s for the previous holder", path, fwp.heartbeatInterval)
+		time.Sleep(fwp.heartbeatInterval)
+		return nil
+	}
+	return waitPastTimestamp(data.Timestamp, "lock file "+path)
+}
+
+// writeData 原子地写入数据文件，写入过程中进程退出不会留下不完整的文件
+func (fwp *FileLockWorkerIdProvider) writeData(timestamp int64) error {
+	data, _ := json.Marshal(lockFileData{
+		Pid:       os.Getpid(),
+		IP:        fwp.ip,
+		Port:      fwp.port,
+		Timestamp: timestamp,
+	})
+	if err := fileutil.WriteFileAtomic(fwp.dataPath, data, 0644); err != nil {
+		return fmt.Errorf("write lock file data %s failed. %s", fwp.dataPath, err.Error())
+	}
+	return nil
+}
+
+// Lease 文件锁的租约
+func (fwp *FileLockWorkerIdProvider) Lease() (Lease, error) {
+	if fwp.leaseState == nil {
+		return nil, errors.New("file lock worker id provider is not initialized")
+	}
+	return fwp, nil
+}
+
+// WorkerId 租约对应的workerId
+func (fwp *FileLockWorkerIdProvider) WorkerId() int64 {
+	return fwp.workerId
+}
+
+// RenewInterval 续约间隔，即往锁文件写入时间戳的间隔
+func (fwp *FileLockWorkerIdProvider) RenewInterval() time.Duration {
+	return fwp.heartbeatInterval
+}
+
+// Renew 将时间戳写入锁文件，时间戳不小于已发放id的最新时间戳
+func (fwp *FileLockWorkerIdProvider) Renew(issuedTimestamp int64) (time.Time, error) {
+	fwp.lock.Lock()
+	defer fwp.lock.Unlock()
+	if fwp.lockFile == nil {
+		return time.Time{}, errors.New("lock file is released")
+	}
+	if err := fwp.writeData(latestTimestamp(issuedTimestamp)); err != nil {
+		return time.Time{}, err
+	}
+	return fwp.extend(), nil
+}
+
+// Release 写入最后的时间戳，并释放锁
+func (fwp *FileLockWorkerIdProvider) Release(issuedTimestamp int64) error {
+	fwp.lock.Lock()
+	defer fwp.lock.Unlock()
+	if fwp.lockFile == nil {
+		return nil
+	}
+	err := fwp.writeData(latestTimestamp(issuedTimestamp))
+	// 关闭文件时，锁自动释放
+	fwp.lockFile.Close()
+	fwp.lockFile = nil
+	return err
+}
+
+func (fwp *FileLockWorkerIdProvider) GetWorkerId() (int64, error) {
+	if fwp.workerId < 0 {
+		return 0, fmt.Errorf("worker id is wrong. Please check the provider")
+	}
+	return fwp.workerId, nil
+}
+
+func (fwp *FileLockWorkerIdProvider) ProviderName() string {
+	return PROVIDER_FILELOCK
+}
+
+// WorkerIdRange 配置的workerId取值范围
+func (fwp *FileLockWorkerIdProvider) WorkerIdRange() (int64, int64) {
+	return fwp.minWorkerId, fwp.maxWorkerId
+}
+
+// NewSpare 使用相同配置的FileLockWorkerIdProvider，已被当前进程锁定的锁文件同样无法再次加锁，因此会获得其它workerId
+func (fwp *FileLockWorkerIdProvider) NewSpare(index int) (WorkerIdProvider, error) {
+	return NewFileLockWorkerIdProvider(FileLockConfig{
+		Dir:               fwp.dir,
+		MinWorkerId:       fwp.minWorkerId,
+		MaxWorkerId:       fwp.maxWorkerId,
+		HeartbeatInterval: fwp.heartbeatInterval,
+	})
+}
+
+// Close 未释放锁时，写入最后一次时间戳，并释放锁
+func (fwp *FileLockWorkerIdProvider) Close() {
+	if err := fwp.Release(timeGen()); err != nil {
+		log.Println(err.Error())
+	}
+}
+
+// newFileLockWorkerIdProviderFromConfig 根据配置项创建FileLockWorkerIdProvider
+func newFileLockWorkerIdProviderFromConfig(config map[string]string) (WorkerIdProvider, error) {
+	minWorkerId, err := configInt64(config, "FILELOCK_WORKER_ID_MIN")
+	if err != nil {
+		return nil, err
+	}
+	maxWorkerId, err := configInt64(config, "FILELOCK_WORKER_ID_MAX")
+	if err != nil {
+		return nil, err
+	}
+	heartbeatInterval, err := configInt64(config, "FILELOCK_HEARTBEAT_INTERVAL")
+	if err != nil {
+		return nil, err
+	}
+	// 启用js-safe时，workerId不能超过JsSafeLayout的最大值
+	if max := allocatableMaxWorkerId(); maxWorkerId > max {
+		if minWorkerId > max {
+			return nil, fmt.Errorf("FILELOCK_WORKER_ID_MIN %d exceeds the max workerId %d of js-safe layout %s", minWorkerId, max, JsSafeLayout.Name())
+		}
+		log.Printf("FILELOCK_WORKER_ID_MAX %d exceeds the max workerId %d of js-safe layout %s, use %d", maxWorkerId, max, JsSafeLayout.Name(), max)
+		maxWorkerId = max
+	}
+	return NewFileLockWorkerIdProvider(FileLockConfig{
+		Dir:               config["FILELOCK_DIR"],
+		MinWorkerId:       minWorkerId,
+		MaxWorkerId:       maxWorkerId,
+		HeartbeatInterval: time.Duration(heartbeatInterval) * time.Millisecond,
+	})
+}
+
+func init() {
+	RegisterProvider(PROVIDER_FILELOCK, ProviderFactory{
+		Options: []ConfigOption{
+			{Name: "FILELOCK_DIR", Default: filepath.Join(os.TempDir(), "snowflake-go", "locks"), Required: true, Description: "锁文件所在的目录，同一主机上的各进程需要使用相同的目录"},
+			{Name: "FILELOCK_WORKER_ID_MIN", Default: "0", Description: "workerId的最小值"},
+			{Name: "FILELOCK_WORKER_ID_MAX", Default: strconv.FormatInt(MaxWorkerId(), 10), Description: "workerId的最大值，启用js-safe时不超过127"},
+			{Name: "FILELOCK_HEARTBEAT_INTERVAL", Default: "1000", Description: "定时往锁文件写入时间戳的间隔，单位ms"},
+		},
+		New: newFileLockWorkerIdProviderFromConfig,
+	})
+}
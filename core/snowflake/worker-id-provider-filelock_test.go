@@ -0,0 +1,142 @@
+//go:build unix
+
+package snowflake
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 子进程使用的锁文件目录，不为空时 TestFileLockHelperProcess 作为子进程运行
+const fileLockHelperEnv = "SFGO_FILELOCK_HELPER_DIR"
+
+// TestFileLockHelperProcess 由 TestFileLockWorkerIdsAcrossProcesses 启动的子进程，获取workerId后输出，标准输入关闭后退出
+func TestFileLockHelperProcess(t *testing.T) {
+	dir := os.Getenv(fileLockHelperEnv)
+	if dir == "" {
+		t.Skip("helper process only")
+	}
+	provider, err := NewFileLockWorkerIdProvider(FileLockConfig{Dir: dir, MinWorkerId: 0, MaxWorkerId: 15, HeartbeatInterval: time.Second})
+	if err != nil {
+		fmt.Println("error:", err)
+		os.Exit(1)
+	}
+	if err = provider.Init("127.0.0.1", "8074", "filelock-test"); err != nil {
+		fmt.Println("error:", err)
+		os.Exit(1)
+	}
+	fmt.Println(provider.workerId)
+	// 持有锁直到父进程关闭标准输入
+	_, _ = io.Copy(io.Discard, os.Stdin)
+	provider.Close()
+	os.Exit(0)
+}
+
+func TestFileLockWorkerIdsAcrossProcesses(t *testing.T) {
+	dir := t.TempDir()
+	const processes = 6
+	workerIds := make(map[int64]int)
+	stdins := make([]io.WriteCloser, 0, processes)
+	cmds := make([]*exec.Cmd, 0, processes)
+	defer func() {
+		for i, cmd := range cmds {
+			stdins[i].Close()
+			_ = cmd.Wait()
+		}
+	}()
+	// 同时启动各子进程，竞争同一目录下的锁文件
+	stdouts := make([]*bufio.Reader, 0, processes)
+	for i := 0; i < processes; i++ {
+		cmd := exec.Command(os.Args[0], "-test.run=^TestFileLockHelperProcess$")
+		cmd.Env = append(os.Environ(), fileLockHelperEnv+"="+dir)
+		stdin, err := cmd.StdinPipe()
+		if err != nil {
+			t.Fatal(err)
+		}
+		stdout, err := cmd.StdoutPipe()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = cmd.Start(); err != nil {
+			t.Fatal(err)
+		}
+		cmds = append(cmds, cmd)
+		stdins = append(stdins, stdin)
+		stdouts = append(stdouts, bufio.NewReader(stdout))
+	}
+	for i, stdout := range stdouts {
+		line, err := stdout.ReadString('\n')
+		if err != nil {
+			t.Fatalf("process %d: read worker id failed. %v", i, err)
+		}
+		workerId, err := strconv.ParseInt(strings.TrimSpace(line), 10, 64)
+		if err != nil {
+			t.Fatalf("process %d: %s", i, line)
+		}
+		if previous, ok := workerIds[workerId]; ok {
+			t.Fatalf("process %d got worker id %d, which is held by process %d", i, workerId, previous)
+		}
+		workerIds[workerId] = i
+	}
+	if len(workerIds) != processes {
+		t.Fatalf("got %d distinct worker ids, want %d", len(workerIds), processes)
+	}
+}
+
+func TestFileLockWaitsForInvalidData(t *testing.T) {
+	dir := t.TempDir()
+	appDir := filepath.Join(dir, "filelock-test")
+	if err := os.MkdirAll(appDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	// 上一个占用者写入数据时进程退出，数据为空
+	if err := os.WriteFile(filepath.Join(appDir, "0.json"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	interval := 300 * time.Millisecond
+	provider, err := NewFileLockWorkerIdProvider(FileLockConfig{Dir: dir, MinWorkerId: 0, MaxWorkerId: 0, HeartbeatInterval: interval})
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	if err = provider.Init("127.0.0.1", "8074", "filelock-test"); err != nil {
+		t.Fatal(err)
+	}
+	defer provider.Close()
+	if elapsed := time.Since(start); elapsed < interval {
+		t.Fatalf("waited %s for invalid lock file data, want at least %s", elapsed, interval)
+	}
+	b, err := os.ReadFile(filepath.Join(appDir, "0.json"))
+	if err != nil || len(b) == 0 {
+		t.Fatalf("lock file data not written. %v", err)
+	}
+}
+
+func TestFileLockCapsWorkerIdWhenJsSafe(t *testing.T) {
+	enableJsSafe(t)
+	config := map[string]string{
+		"FILELOCK_DIR":                t.TempDir(),
+		"FILELOCK_WORKER_ID_MIN":      "0",
+		"FILELOCK_WORKER_ID_MAX":      strconv.FormatInt(MaxWorkerId(), 10),
+		"FILELOCK_HEARTBEAT_INTERVAL": "1000",
+	}
+	provider, err := newFileLockWorkerIdProviderFromConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, max := provider.(*FileLockWorkerIdProvider).WorkerIdRange(); max != JsSafeLayout.MaxWorkerId() {
+		t.Fatalf("got max workerId %d, want %d", max, JsSafeLayout.MaxWorkerId())
+	}
+	config["FILELOCK_WORKER_ID_MIN"] = "200"
+	if _, err = newFileLockWorkerIdProviderFromConfig(config); err == nil {
+		t.Fatal("expected error when FILELOCK_WORKER_ID_MIN exceeds the js-safe range")
+	}
+}
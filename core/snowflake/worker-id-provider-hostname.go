@@ -0,0 +1,254 @@
+package snowflake
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// 默认的hostname格式，第1个捕获组为序号
+const defaultHostNamePattern = `^.+-(\d+)$`
+
+// HostNameConfig HostNameWokerIdProvider的配置
+type HostNameConfig struct {
+	// hostname，为空时取系统hostname
+	HostName string
+	// hostname需要匹配的正则表达式，为空时为 ^.+-(\d+)$
+	Pattern string
+	// 序号所在的捕获组，默认为1
+	Group int
+	// workerId的偏移量，workerId = 偏移量 + 序号，同一id空间里有多个StatefulSet时，为每个StatefulSet设置不同的偏移量，避免冲突
+	Offset int64
+	// 最大副本数，大于0时，序号必须小于该值
+	MaxReplicas int64
+	// hostname与workerId的映射文件，每行格式为 hostname=workerId，# 开头为注释，hostname在文件中时，直接使用映射的workerId
+	MappingFile string
+}
+
+// HostNameWokerIdProvider 基于hostname实现
+//
+// 用于k8s里，采用statefulset部署时，获取hostname的序号
+type HostNameWokerIdProvider struct {
+	hostName string
+	workerId int64
+	// workerId的取值范围
+	minWorkerId int64
+	maxWorkerId int64
+}
+
+// NewHostNameWokerIdProvider 使用默认配置创建HostNameWokerIdProvider，hostname需要匹配 .+-\d+
+func NewHostNameWokerIdProvider() (*HostNameWokerIdProvider, error) {
+	return NewHostNameWokerIdProviderWithConfig(HostNameConfig{})
+}
+
+// NewHostNameWokerIdProviderWithConfig 创建HostNameWokerIdProvider
+func NewHostNameWokerIdProviderWithConfig(config HostNameConfig) (*HostNameWokerIdProvider, error) {
+	hostName := config.HostName
+	if hostName == "" {
+		var err error
+		hostName, err = os.Hostname()
+		if err != nil {
+			return nil, fmt.Errorf("hostName is wrong. err is %s", err.Error())
+		}
+	}
+	if hostName == "" {
+		return nil, errors.New("hostName is null")
+	}
+	if config.Offset < 0 {
+		return nil, fmt.Errorf("workerId offset must be greater than or equal to 0, but it is %d", config.Offset)
+	}
+	hwp := &HostNameWokerIdProvider{
+		hostName:    hostName,
+		workerId:    -1,
+		minWorkerId: config.Offset,
+		maxWorkerId: MaxWorkerId(),
+	}
+	if config.MaxReplicas > 0 {
+		hwp.maxWorkerId = config.Offset + config.MaxReplicas - 1
+	}
+	// 优先使用映射文件
+	if config.MappingFile != "" {
+		mapping, err := loadHostNameMapping(config.MappingFile)
+		if err != nil {
+			return nil, err
+		}
+		if err = checkMappingOverlap(mapping, config, hwp.maxWorkerId); err != nil {
+			return nil, err
+		}
+		for _, workerId := range mapping {
+			if workerId < hwp.minWorkerId {
+				hwp.minWorkerId = workerId
+			}
+			if workerId > hwp.maxWorkerId {
+				hwp.maxWorkerId = workerId
+			}
+		}
+		if workerId, ok := mapping[hostName]; ok {
+			hwp.workerId = workerId
+			log.Printf("hostname %s is found in mapping file %s, workerId: %d", hostName, config.MappingFile, workerId)
+		}
+	}
+	if hwp.workerId < 0 {
+		ordinal, err := parseHostNameOrdinal(hostName, config.Pattern, config.Group)
+		if err != nil {
+			return nil, err
+		}
+		if config.MaxReplicas > 0 && ordinal >= config.MaxReplicas {
+			return nil, fmt.Errorf("ordinal %d of hostname %s exceeds max replicas %d", ordinal, hostName, config.MaxReplicas)
+		}
+		hwp.workerId = config.Offset + ordinal
+	}
+	if hwp.workerId > MaxWorkerId() {
+		return nil, fmt.Errorf("workerId %d of hostname %s must between 0 and %d", hwp.workerId, hostName, MaxWorkerId())
+	}
+	if hwp.maxWorkerId > MaxWorkerId() {
+		hwp.maxWorkerId = MaxWorkerId()
+	}
+	return hwp, nil
+}
+
+// parseHostNameOrdinal 根据正则表达式的捕获组获取hostname的序号
+func parseHostNameOrdinal(hostName, pattern string, group int) (int64, error) {
+	if pattern == "" {
+		pattern = defaultHostNamePattern
+	}
+	if group <= 0 {
+		group = 1
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return 0, fmt.Errorf("hostname pattern %s is wrong. %s", pattern, err.Error())
+	}
+	if group > re.NumSubexp() {
+		return 0, fmt.Errorf("hostname pattern %s has no capture group %d", pattern, group)
+	}
+	match := re.FindStringSubmatch(hostName)
+	if match == nil {
+		return 0, fmt.Errorf(`os hostName is %s. hostname must match %s , e.g. id-server-1 order-server-2`, hostName, pattern)
+	}
+	ordinal, err := strconv.ParseInt(match[group], 10, 64)
+	if err != nil || ordinal < 0 {
+		return 0, fmt.Errorf("workerId is wrong. hostname is %s, capture group %d is %s", hostName, group, match[group])
+	}
+	return ordinal, nil
+}
+
+// checkMappingOverlap 映射文件中的workerId不能在按序号计算的workerId的范围 [偏移量, ordinalMax] 内，
+// 否则映射的hostname可能与按序号计算workerId的hostname使用相同的workerId。映射的workerId与该hostname按序号计算的workerId相同时除外
+func checkMappingOverlap(mapping map[string]int64, config HostNameConfig, ordinalMax int64) error {
+	hostNames := make([]string, 0, len(mapping))
+	for hostName := range mapping {
+		hostNames = append(hostNames, hostName)
+	}
+	sort.Strings(hostNames)
+	for _, hostName := range hostNames {
+		workerId := mapping[hostName]
+		if workerId < config.Offset || workerId > ordinalMax {
+			continue
+		}
+		if ordinal, err := parseHostNameOrdinal(hostName, config.Pattern, config.Group); err == nil && config.Offset+ordinal == workerId {
+			continue
+		}
+		return fmt.Errorf("hostname mapping file %s is wrong, workerId %d of %s overlaps with the workerIds [%d, %d] derived from hostname ordinals, "+
+			"map it out of the range or set HOSTNAME_WORKER_ID_OFFSET / HOSTNAME_MAX_REPLICAS", config.MappingFile, workerId, hostName, config.Offset, ordinalMax)
+	}
+	return nil
+}
+
+// loadHostNameMapping 读取hostname与workerId的映射文件
+func loadHostNameMapping(path string) (map[string]int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open hostname mapping file failed. %s", err.Error())
+	}
+	defer f.Close()
+	mapping := make(map[string]int64)
+	workerIds := make(map[int64]string)
+	scanner := bufio.NewScanner(f)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		kv := strings.SplitN(line, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("hostname mapping file %s line %d is wrong, must be hostname=workerId", path, lineNo)
+		}
+		hostName := strings.TrimSpace(kv[0])
+		workerId, err := strconv.ParseInt(strings.TrimSpace(kv[1]), 10, 64)
+		if err != nil || workerId < 0 || workerId > MaxWorkerId() {
+			return nil, fmt.Errorf("hostname mapping file %s line %d is wrong, workerId must between 0 and %d", path, lineNo, MaxWorkerId())
+		}
+		if other, ok := workerIds[workerId]; ok && other != hostName {
+			return nil, fmt.Errorf("hostname mapping file %s line %d is wrong, workerId %d is mapped to both %s and %s", path, lineNo, workerId, other, hostName)
+		}
+		mapping[hostName] = workerId
+		workerIds[workerId] = hostName
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read hostname mapping file failed. %s", err.Error())
+	}
+	return mapping, nil
+}
+
+// newHostNameWokerIdProviderFromConfig 根据配置项创建HostNameWokerIdProvider
+func newHostNameWokerIdProviderFromConfig(config map[string]string) (WorkerIdProvider, error) {
+	group, err := configInt64(config, "HOSTNAME_PATTERN_GROUP")
+	if err != nil {
+		return nil, err
+	}
+	offset, err := configInt64(config, "HOSTNAME_WORKER_ID_OFFSET")
+	if err != nil {
+		return nil, err
+	}
+	maxReplicas, err := configInt64(config, "HOSTNAME_MAX_REPLICAS")
+	if err != nil {
+		return nil, err
+	}
+	return NewHostNameWokerIdProviderWithConfig(HostNameConfig{
+		Pattern:     config["HOSTNAME_PATTERN"],
+		Group:       int(group),
+		Offset:      offset,
+		MaxReplicas: maxReplicas,
+		MappingFile: config["HOSTNAME_WORKER_ID_MAPPING_FILE"],
+	})
+}
+
+func init() {
+	RegisterProvider(PROVIDER_HOSTNAME, ProviderFactory{
+		Options: []ConfigOption{
+			{Name: "HOSTNAME_PATTERN", Default: defaultHostNamePattern, Description: "hostname需要匹配的正则表达式"},
+			{Name: "HOSTNAME_PATTERN_GROUP", Default: "1", Description: "序号所在的捕获组"},
+			{Name: "HOSTNAME_WORKER_ID_OFFSET", Default: "0", Description: "workerId的偏移量，workerId = 偏移量 + 序号"},
+			{Name: "HOSTNAME_MAX_REPLICAS", Default: "0", Description: "最大副本数，大于0时，序号必须小于该值"},
+			{Name: "HOSTNAME_WORKER_ID_MAPPING_FILE", Description: "hostname与workerId的映射文件，每行格式为 hostname=workerId"},
+		},
+		New: newHostNameWokerIdProviderFromConfig,
+	})
+}
+
+func (hwp *HostNameWokerIdProvider) Init(ip, port, appName string) error {
+	return nil
+}
+
+func (hwp *HostNameWokerIdProvider) GetWorkerId() (int64, error) {
+	log.Printf("get workerId via hostname. hostname: %s workerId: %d", hwp.hostName, hwp.workerId)
+	return hwp.workerId, nil
+}
+
+func (hwp *HostNameWokerIdProvider) ProviderName() string {
+	return PROVIDER_HOSTNAME
+}
+
+// WorkerIdRange 偏移量至偏移量+最大副本数-1，以及映射文件中的workerId，映射的workerId不连续时为包含它们的最小范围
+func (hwp *HostNameWokerIdProvider) WorkerIdRange() (int64, int64) {
+	return hwp.minWorkerId, hwp.maxWorkerId
+}
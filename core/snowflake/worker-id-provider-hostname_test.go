@@ -0,0 +1,60 @@
+package snowflake
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeHostNameMapping(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "mapping.txt")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestHostNameMappingRejectsOverlapWithOrdinals(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  HostNameConfig
+		mapping string
+		wantErr bool
+	}{
+		// id-server-0 至 id-server-9 按序号使用 100 至 109
+		{"mapped below offset", HostNameConfig{Offset: 100, MaxReplicas: 10}, "legacy-host=5\n", false},
+		{"mapped above ordinals", HostNameConfig{Offset: 100, MaxReplicas: 10}, "legacy-host=200\n", false},
+		{"mapped into ordinals", HostNameConfig{Offset: 100, MaxReplicas: 10}, "legacy-host=103\n", true},
+		// 映射的workerId与该hostname按序号计算的workerId相同
+		{"mapped to own ordinal", HostNameConfig{Offset: 100, MaxReplicas: 10}, "id-server-3=103\n", false},
+		{"mapped to other ordinal", HostNameConfig{Offset: 100, MaxReplicas: 10}, "id-server-3=104\n", true},
+		// 未限制最大副本数时，偏移量之后的workerId均可能按序号使用
+		{"unbounded ordinals", HostNameConfig{Offset: 100}, "legacy-host=900\n", true},
+	}
+	for _, tt := range tests {
+		config := tt.config
+		config.HostName = "id-server-1"
+		config.MappingFile = writeHostNameMapping(t, tt.mapping)
+		_, err := NewHostNameWokerIdProviderWithConfig(config)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: got error %v, want error %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestHostNameMappingWorkerId(t *testing.T) {
+	path := writeHostNameMapping(t, "# 旧主机\nlegacy-host=5\n")
+	for hostName, want := range map[string]int64{"legacy-host": 5, "id-server-2": 102} {
+		hwp, err := NewHostNameWokerIdProviderWithConfig(HostNameConfig{HostName: hostName, Offset: 100, MaxReplicas: 10, MappingFile: path})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if workerId, _ := hwp.GetWorkerId(); workerId != want {
+			t.Fatalf("%s: got workerId %d, want %d", hostName, workerId, want)
+		}
+		if min, max := hwp.WorkerIdRange(); min != 5 || max != 109 {
+			t.Fatalf("%s: got range [%d, %d], want [5, 109]", hostName, min, max)
+		}
+	}
+}
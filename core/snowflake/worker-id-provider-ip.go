@@ -0,0 +1,271 @@
+package snowflake
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const PROVIDER_IP = "ip"
+
+// WorkerIdRegistry 记录各实例workerId的注册中心，用于检查workerId是否已被其它实例使用
+type WorkerIdRegistry interface {
+	// WorkerIdOwners 使用该workerId的实例，格式为 ip:port
+	WorkerIdOwners(appName string, workerId int64) ([]string, error)
+}
+
+var workerIdRegistries = make(map[string]WorkerIdRegistry)
+var workerIdRegistriesLock sync.RWMutex
+
+// SetWorkerIdRegistry 设置名称为name的注册中心，供 IP_CONFLICT_CHECK=name 使用，e.g. nacos
+func SetWorkerIdRegistry(name string, registry WorkerIdRegistry) {
+	workerIdRegistriesLock.Lock()
+	defer workerIdRegistriesLock.Unlock()
+	workerIdRegistries[name] = registry
+}
+
+// getWorkerIdRegistry 获取注册中心，zookeeper未设置时根据 ZOOKEEPER_* 环境变量创建
+func getWorkerIdRegistry(name string) (WorkerIdRegistry, error) {
+	workerIdRegistriesLock.RLock()
+	registry, ok := workerIdRegistries[name]
+	workerIdRegistriesLock.RUnlock()
+	if ok {
+		return registry, nil
+	}
+	if name == PROVIDER_ZOOKEEPER {
+		provider, err := NewWorkerProvider(PROVIDER_ZOOKEEPER)
+		if err != nil {
+			return nil, err
+		}
+		return provider.(WorkerIdRegistry), nil
+	}
+	return nil, fmt.Errorf("worker id registry %s is not available", name)
+}
+
+// IPConfig IPWorkerIdProvider的配置
+type IPConfig struct {
+	// 用于计算workerId的ip，为空时取Interface的地址，Interface也为空时使用应用监听的ip
+	Address string
+	// 网卡名称，e.g. eth0
+	Interface string
+	// 从网卡获取地址时使用的地址族，ipv4 或 ipv6
+	Family string
+	// 子网掩码，可以为前缀长度（e.g. 22）或IPv4的点分形式（e.g. 255.255.252.0），为空时取ip的低位，位数与workerId相同
+	SubnetMask string
+	// 检查workerId冲突的注册中心名称，e.g. zookeeper nacos，为空时不检查
+	ConflictCheck string
+}
+
+// IPWorkerIdProvider 基于ip实现
+//
+// 取ip在子网掩码之外的部分（主机号）作为workerId，适用于子网内ip唯一的环境，e.g. /22 子网中主机号为10位，正好是workerId的位数
+type IPWorkerIdProvider struct {
+	config   IPConfig
+	ip       net.IP
+	workerId int64
+	// 主机号的位数
+	hostBits int
+}
+
+// NewIPWorkerIdProvider 创建IPWorkerIdProvider
+func NewIPWorkerIdProvider(config IPConfig) (*IPWorkerIdProvider, error) {
+	if config.Family == "" {
+		config.Family = "ipv4"
+	}
+	if config.Family != "ipv4" && config.Family != "ipv6" {
+		return nil, fmt.Errorf("ip family %q is wrong, valid families: ipv4, ipv6", config.Family)
+	}
+	iwp := &IPWorkerIdProvider{config: config, workerId: -1}
+	if config.Address != "" {
+		iwp.ip = net.ParseIP(config.Address)
+		if iwp.ip == nil {
+			return nil, fmt.Errorf("ip address %s is wrong", config.Address)
+		}
+	} else if config.Interface != "" {
+		ip, err := interfaceIP(config.Interface, config.Family)
+		if err != nil {
+			return nil, err
+		}
+		iwp.ip = ip
+	}
+	return iwp, nil
+}
+
+// interfaceIP 获取网卡的第一个非回环、非链路本地的地址
+func interfaceIP(name, family string) (net.IP, error) {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return nil, fmt.Errorf("get network interface %s failed. %s", name, err.Error())
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil, fmt.Errorf("get addresses of network interface %s failed. %s", name, err.Error())
+	}
+	for _, addr := range addrs {
+		ipnet, ok := addr.(*net.IPNet)
+		if !ok || ipnet.IP.IsLoopback() || ipnet.IP.IsLinkLocalUnicast() {
+			continue
+		}
+		if (ipnet.IP.To4() != nil) == (family == "ipv4") {
+			return ipnet.IP, nil
+		}
+	}
+	return nil, fmt.Errorf("network interface %s has no %s address", name, family)
+}
+
+// parseSubnetMask 解析子网掩码，返回前缀长度，bits为ip的位数
+func parseSubnetMask(value string, bits int) (int, error) {
+	value = strings.TrimPrefix(strings.TrimSpace(value), "/")
+	if value == "" {
+		return bits - int(workerIdBits), nil
+	}
+	if strings.Contains(value, ".") {
+		maskIP := net.ParseIP(value).To4()
+		if maskIP == nil || bits != 32 {
+			return 0, fmt.Errorf("subnet mask %s is wrong, dotted mask is only valid for ipv4", value)
+		}
+		ones, maskBits := net.IPMask(maskIP).Size()
+		if maskBits == 0 {
+			return 0, fmt.Errorf("subnet mask %s is not contiguous", value)
+		}
+		return ones, nil
+	}
+	prefix, err := strconv.Atoi(value)
+	if err != nil || prefix < 0 || prefix > bits {
+		return 0, fmt.Errorf("subnet mask %s is wrong, prefix length must between 0 and %d", value, bits)
+	}
+	return prefix, nil
+}
+
+// deriveWorkerId 取ip在前缀之外的部分作为workerId，返回workerId及主机号的位数
+func deriveWorkerId(ip net.IP, subnetMask string) (int64, int, error) {
+	bits := 128
+	if ip4 := ip.To4(); ip4 != nil {
+		ip, bits = ip4, 32
+	}
+	prefix, err := parseSubnetMask(subnetMask, bits)
+	if err != nil {
+		return 0, 0, err
+	}
+	hostBits := bits - prefix
+	if hostBits >= 64 {
+		return 0, 0, fmt.Errorf("host part of %s/%d has %d bits, too many for a workerId", ip, prefix, hostBits)
+	}
+	// 主机号不超过63位，只需要ip的最后8字节
+	var low uint64
+	if bits == 32 {
+		low = uint64(binary.BigEndian.Uint32(ip))
+	} else {
+		low = binary.BigEndian.Uint64(ip[8:])
+	}
+	workerId := int64(low & (1<<hostBits - 1))
+	if workerId > MaxWorkerId() {
+		return 0, 0, fmt.Errorf("host part of %s/%d is %d, must between 0 and %d, use a longer subnet mask", ip, prefix, workerId, MaxWorkerId())
+	}
+	return workerId, hostBits, nil
+}
+
+// Init 计算workerId，配置了注册中心时，检查workerId是否已被其它实例使用
+func (iwp *IPWorkerIdProvider) Init(ip, port, appName string) error {
+	if iwp.ip == nil {
+		iwp.ip = net.ParseIP(ip)
+		if iwp.ip == nil {
+			return fmt.Errorf("ip address %s is wrong", ip)
+		}
+	}
+	workerId, hostBits, err := deriveWorkerId(iwp.ip, iwp.config.SubnetMask)
+	if err != nil {
+		return err
+	}
+	if iwp.config.ConflictCheck != "" {
+		if err = iwp.checkConflict(appName, ip+":"+port, workerId); err != nil {
+			return err
+		}
+	}
+	iwp.workerId = workerId
+	iwp.hostBits = hostBits
+	return nil
+}
+
+// checkConflict 从注册中心获取使用该workerId的实例，存在当前实例之外的实例时返回error
+func (iwp *IPWorkerIdProvider) checkConflict(appName, self string, workerId int64) error {
+	registry, err := getWorkerIdRegistry(iwp.config.ConflictCheck)
+	if err != nil {
+		return err
+	}
+	owners, err := registry.WorkerIdOwners(appName, workerId)
+	if err != nil {
+		return fmt.Errorf("check workerId %d via %s failed. %s", workerId, iwp.config.ConflictCheck, err.Error())
+	}
+	others := make([]string, 0, len(owners))
+	for _, owner := range owners {
+		if owner != self {
+			others = append(others, owner)
+		}
+	}
+	if len(others) > 0 {
+		return fmt.Errorf("workerId %d derived from ip %s is used by %s, registered in %s", workerId, iwp.ip, strings.Join(others, ","), iwp.config.ConflictCheck)
+	}
+	return nil
+}
+
+func (iwp *IPWorkerIdProvider) GetWorkerId() (int64, error) {
+	if iwp.workerId < 0 {
+		return 0, errors.New("worker id is wrong. Please check the provider")
+	}
+	log.Printf("get workerId via ip. ip: %s workerId: %d", iwp.ip, iwp.workerId)
+	return iwp.workerId, nil
+}
+
+func (iwp *IPWorkerIdProvider) ProviderName() string {
+	return PROVIDER_IP
+}
+
+// WorkerIdRange 0至主机号的最大值，Init之前根据子网掩码计算
+func (iwp *IPWorkerIdProvider) WorkerIdRange() (int64, int64) {
+	hostBits := iwp.hostBits
+	if hostBits == 0 {
+		bits := 32
+		if iwp.config.Family == "ipv6" || (iwp.ip != nil && iwp.ip.To4() == nil) {
+			bits = 128
+		}
+		prefix, err := parseSubnetMask(iwp.config.SubnetMask, bits)
+		if err != nil {
+			return 0, MaxWorkerId()
+		}
+		hostBits = bits - prefix
+	}
+	if hostBits >= int(workerIdBits) {
+		return 0, MaxWorkerId()
+	}
+	return 0, 1<<hostBits - 1
+}
+
+// newIPWorkerIdProviderFromConfig 根据配置项创建IPWorkerIdProvider
+func newIPWorkerIdProviderFromConfig(config map[string]string) (WorkerIdProvider, error) {
+	return NewIPWorkerIdProvider(IPConfig{
+		Address:       config["IP_ADDRESS"],
+		Interface:     config["IP_INTERFACE"],
+		Family:        config["IP_FAMILY"],
+		SubnetMask:    config["IP_SUBNET_MASK"],
+		ConflictCheck: config["IP_CONFLICT_CHECK"],
+	})
+}
+
+func init() {
+	RegisterProvider(PROVIDER_IP, ProviderFactory{
+		Options: []ConfigOption{
+			{Name: "IP_ADDRESS", Description: "用于计算workerId的ip，为空时取IP_INTERFACE的地址，IP_INTERFACE也为空时使用应用的ip"},
+			{Name: "IP_INTERFACE", Description: "网卡名称，e.g. eth0"},
+			{Name: "IP_FAMILY", Default: "ipv4", Description: "从网卡获取地址时使用的地址族，ipv4 或 ipv6"},
+			{Name: "IP_SUBNET_MASK", Description: "子网掩码，可以为前缀长度（e.g. 22）或点分形式（e.g. 255.255.252.0），为空时取ip的低10位"},
+			{Name: "IP_CONFLICT_CHECK", Description: "检查workerId冲突的注册中心，值可以为 zookeeper nacos，为空时不检查"},
+		},
+		New: newIPWorkerIdProviderFromConfig,
+	})
+}
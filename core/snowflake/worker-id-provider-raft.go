@@ -0,0 +1,936 @@
+package snowflake
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/raft"
+	raftboltdb "github.com/hashicorp/raft-boltdb/v2"
+)
+
+const PROVIDER_RAFT = "raft"
+
+// raft命令的超时时间
+const raftCommandTimeout = 5 * time.Second
+
+// RaftPeerResolver 获取raft节点列表，key为节点ID，value为节点地址（host:port）
+//
+// selfId、selfAddr为当前节点的ID及地址，用于通过服务发现获取节点列表时注册自己
+type RaftPeerResolver func(selfId, selfAddr string) (map[string]string, error)
+
+var raftPeerResolver RaftPeerResolver
+var raftPeerResolverLock sync.RWMutex
+
+// SetRaftPeerResolver 设置获取raft节点列表的方法，未配置RAFT_PEERS时使用，e.g. 通过Nacos获取
+func SetRaftPeerResolver(resolver RaftPeerResolver) {
+	raftPeerResolverLock.Lock()
+	defer raftPeerResolverLock.Unlock()
+	raftPeerResolver = resolver
+}
+
+func getRaftPeerResolver() RaftPeerResolver {
+	raftPeerResolverLock.RLock()
+	defer raftPeerResolverLock.RUnlock()
+	return raftPeerResolver
+}
+
+// RaftConfig RaftWorkerIdProvider的配置
+type RaftConfig struct {
+	// 节点ID，集群内唯一
+	NodeId string
+	// raft监听地址，e.g. 0.0.0.0:8075
+	BindAddr string
+	// 其它节点访问本节点的地址，为空时使用BindAddr
+	AdvertiseAddr string
+	// 集群节点，key为节点ID，value为节点地址，为空时通过SetRaftPeerResolver设置的方法获取
+	Peers map[string]string
+	// 数据目录，保存raft日志及快照
+	DataDir string
+	// 上报时间戳的间隔
+	HeartbeatInterval time.Duration
+	// 超过该时长未上报时间戳的workerId可以被回收，必须大于3倍的HeartbeatInterval
+	RecycleAfter time.Duration
+	// 等待选出leader并分配workerId的超时时间
+	InitTimeout time.Duration
+	// 通过服务发现获取节点列表时，至少发现该数量的节点后才初始化集群
+	ExpectPeers int
+	// 初始化集群的节点ID，不为空时仅该节点初始化集群，通过服务发现获取节点列表时必填，
+	// 避免各节点发现的节点列表不同时，以不同的配置初始化出多个集群
+	BootstrapNode string
+	// 共享密钥，各节点及管理命令需要相同。设置后raft连接及命令连接都需要以该密钥通过认证；
+	// 为空时不认证连接，raft端口必须只允许集群节点访问，命令端口仅接受集群节点为自己申请、续约、释放workerId，
+	// 管理操作（回收、释放其它节点的workerId，保留workerId）只能通过leader的管理接口执行
+	Secret string
+}
+
+// RaftWorkerIdProvider 基于内嵌raft实现
+//
+// 多个实例组成raft集群，在集群内复制workerId分配表及各workerId上报的时间戳，不依赖ZooKeeper等外部服务。
+// 写入需要多数节点确认，3个节点的集群允许1个节点故障
+type RaftWorkerIdProvider struct {
+	config      RaftConfig
+	ip          string
+	port        string
+	workerId    int64
+	raft        *raft.Raft
+	fsm         *workerIdFSM
+	streamLayer *raftStreamLayer
+	transport   *raft.NetworkTransport
+	store       *raftboltdb.BoltStore
+	// 关闭时通知同步发现节点的协程退出
+	closeCh   chan struct{}
+	closeOnce sync.Once
+	// workerId的租约，Init成功后创建
+	*leaseState
+	released bool
+	closed   bool
+	lock     sync.Mutex
+}
+
+// NewRaftWorkerIdProvider 创建RaftWorkerIdProvider
+func NewRaftWorkerIdProvider(config RaftConfig) (*RaftWorkerIdProvider, error) {
+	if config.NodeId == "" {
+		return nil, errors.New("raft node id can't be empty")
+	}
+	if config.BindAddr == "" {
+		return nil, errors.New("raft bind address can't be empty")
+	}
+	if config.DataDir == "" {
+		return nil, errors.New("raft data directory can't be empty")
+	}
+	if config.HeartbeatInterval <= 0 {
+		return nil, errors.New("heartbeat interval must be greater than 0")
+	}
+	if config.RecycleAfter <= 3*config.HeartbeatInterval {
+		return nil, fmt.Errorf("recycle after %s must be greater than 3 times heartbeat interval %s", config.RecycleAfter, config.HeartbeatInterval)
+	}
+	if config.InitTimeout <= 0 {
+		return nil, errors.New("init timeout must be greater than 0")
+	}
+	if len(config.Peers) > 0 {
+		if _, ok := config.Peers[config.NodeId]; !ok {
+			return nil, fmt.Errorf("raft peers must contain this node %s", config.NodeId)
+		}
+		if _, ok := config.Peers[config.BootstrapNode]; config.BootstrapNode != "" && !ok {
+			return nil, fmt.Errorf("raft peers must contain the bootstrap node %s", config.BootstrapNode)
+		}
+	}
+	return &RaftWorkerIdProvider{
+		config:   config,
+		workerId: -1,
+		fsm:      newWorkerIdFSM(),
+		closeCh:  make(chan struct{}),
+	}, nil
+}
+
+// Init 启动raft节点，等待选出leader后申请workerId
+func (rwp *RaftWorkerIdProvider) Init(ip, port, appName string) error {
+	rwp.ip = ip
+	rwp.port = port
+	err := rwp.startRaft(appName)
+	if err != nil {
+		rwp.shutdown()
+		return err
+	}
+	curTimestamp := timeGen()
+	result, err := rwp.waitApply(&raftCommand{
+		Op:           raftOpAllocate,
+		Owner:        rwp.config.NodeId,
+		Addr:         ip + ":" + port,
+		Timestamp:    curTimestamp,
+		RecycleAfter: rwp.config.RecycleAfter.Milliseconds(),
+		MinWorkerId:  0,
+		MaxWorkerId:  allocatableMaxWorkerId(),
+	}, time.Now().Add(rwp.config.InitTimeout))
+	if err != nil {
+		rwp.shutdown()
+		return fmt.Errorf("allocate workerId via raft failed. %s", err.Error())
+	}
+	// 等待时间超过workerId上一个占用者的最新时间戳
+	err = waitPastTimestamp(result.PreviousTimestamp, fmt.Sprintf("workerId %d previous", result.WorkerId))
+	if err != nil {
+		rwp.shutdown()
+		return err
+	}
+	rwp.workerId = result.WorkerId
+	// 租约时长为3个上报间隔，无法连接多数节点时续约失败，workerId在RecycleAfter之后才可能被分配给其它节点
+	rwp.leaseState = newLeaseState(3 * rwp.config.HeartbeatInterval)
+	rwp.extend()
+	log.Printf("get workerId via raft. nodeId: %s workerId: %d", rwp.config.NodeId, result.WorkerId)
+	return nil
+}
+
+// startRaft 启动raft节点，没有历史数据时初始化集群
+func (rwp *RaftWorkerIdProvider) startRaft(appName string) error {
+	dir := filepath.Join(rwp.config.DataDir, appName)
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return fmt.Errorf("create raft data directory failed. %s", err.Error())
+	}
+	rwp.store, err = raftboltdb.NewBoltStore(filepath.Join(dir, "raft.db"))
+	if err != nil {
+		return fmt.Errorf("open raft store failed. %s", err.Error())
+	}
+	snapshots, err := raft.NewFileSnapshotStore(dir, 2, log.Writer())
+	if err != nil {
+		return fmt.Errorf("open raft snapshot store failed. %s", err.Error())
+	}
+	rwp.streamLayer, err = newRaftStreamLayer(rwp.config.BindAddr, rwp.config.AdvertiseAddr, rwp.config.Secret, func(conn net.Conn) {
+		serveRaftCommand(conn, raftCommandTimeout, rwp.handleRemoteCommand)
+	})
+	if err != nil {
+		return fmt.Errorf("listen on %s failed. %s", rwp.config.BindAddr, err.Error())
+	}
+	if rwp.config.Secret == "" {
+		log.Printf("raft secret is not set, %s accepts raft connections from anyone, make sure only cluster nodes can reach it or set RAFT_SECRET", rwp.config.BindAddr)
+	}
+	rwp.transport = raft.NewNetworkTransport(rwp.streamLayer, 3, 10*time.Second, log.Writer())
+
+	raftConfig := raft.DefaultConfig()
+	raftConfig.LocalID = raft.ServerID(rwp.config.NodeId)
+	raftConfig.LogOutput = log.Writer()
+	raftConfig.LogLevel = "WARN"
+	hasState, err := raft.HasExistingState(rwp.store, rwp.store, snapshots)
+	if err != nil {
+		return fmt.Errorf("check raft state failed. %s", err.Error())
+	}
+	rwp.raft, err = raft.NewRaft(raftConfig, rwp.fsm, rwp.store, rwp.store, snapshots, rwp.transport)
+	if err != nil {
+		return fmt.Errorf("start raft failed. %s", err.Error())
+	}
+	if len(rwp.config.Peers) == 0 {
+		if !hasState && rwp.config.BootstrapNode == "" {
+			return errors.New("raft bootstrap node must be set when raft peers are discovered, set RAFT_BOOTSTRAP_NODE")
+		}
+		// 所有节点都要注册，leader才能发现并添加为投票节点
+		if err = rwp.registerPeer(); err != nil {
+			return err
+		}
+		go rwp.syncDiscoveredPeers()
+	}
+	if hasState {
+		return nil
+	}
+	if rwp.config.BootstrapNode != "" && rwp.config.BootstrapNode != rwp.config.NodeId {
+		// 等待初始化集群的节点选为leader后将本节点添加到集群
+		log.Printf("wait for raft bootstrap node %s to bootstrap the cluster", rwp.config.BootstrapNode)
+		return nil
+	}
+	peers, err := rwp.resolvePeers()
+	if err != nil {
+		return err
+	}
+	servers := make([]raft.Server, 0, len(peers))
+	for id, addr := range peers {
+		servers = append(servers, raft.Server{ID: raft.ServerID(id), Address: raft.ServerAddress(addr)})
+	}
+	sort.Slice(servers, func(i, j int) bool {
+		return servers[i].ID < servers[j].ID
+	})
+	// 未指定初始化集群的节点时，各节点使用相同的静态节点列表初始化集群，重复初始化的错误可以忽略
+	log.Printf("bootstrap raft cluster. peers: %s", raftPeersString(peers))
+	err = rwp.raft.BootstrapCluster(raft.Configuration{Servers: servers}).Error()
+	if err != nil && err != raft.ErrCantBootstrap {
+		return fmt.Errorf("bootstrap raft cluster failed. %s", err.Error())
+	}
+	return nil
+}
+
+// resolvePeers 获取集群节点，未配置时通过RaftPeerResolver获取，直到发现ExpectPeers个节点
+func (rwp *RaftWorkerIdProvider) resolvePeers() (map[string]string, error) {
+	if len(rwp.config.Peers) > 0 {
+		return rwp.config.Peers, nil
+	}
+	resolver := getRaftPeerResolver()
+	if resolver == nil {
+		return nil, errors.New("raft peers are not configured, set RAFT_PEERS or enable raft peer discovery")
+	}
+	selfAddr := rwp.streamLayer.Addr().String()
+	deadline := time.Now().Add(rwp.config.InitTimeout)
+	for {
+		peers, err := resolver(rwp.config.NodeId, selfAddr)
+		if err == nil && len(peers) >= rwp.config.ExpectPeers {
+			if _, ok := peers[rwp.config.NodeId]; !ok {
+				peers[rwp.config.NodeId] = selfAddr
+			}
+			return peers, nil
+		}
+		if time.Now().After(deadline) {
+			if err != nil {
+				return nil, fmt.Errorf("resolve raft peers failed. %s", err.Error())
+			}
+			return nil, fmt.Errorf("only %d raft peers are found, expect %d", len(peers), rwp.config.ExpectPeers)
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+// registerPeer 通过RaftPeerResolver注册本节点，失败时重试直到InitTimeout
+func (rwp *RaftWorkerIdProvider) registerPeer() error {
+	resolver := getRaftPeerResolver()
+	if resolver == nil {
+		return errors.New("raft peers are not configured, set RAFT_PEERS or enable raft peer discovery")
+	}
+	selfAddr := rwp.streamLayer.Addr().String()
+	deadline := time.Now().Add(rwp.config.InitTimeout)
+	for {
+		_, err := resolver(rwp.config.NodeId, selfAddr)
+		if err == nil {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("register raft peer failed. %s", err.Error())
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+// syncDiscoveredPeers 当前节点是leader时，定期将发现的、不在集群配置中的节点添加为投票节点
+//
+// 仅添加不移除，节点下线后仍然保留在集群配置中，避免服务发现短暂异常时缩小集群
+func (rwp *RaftWorkerIdProvider) syncDiscoveredPeers() {
+	ticker := time.NewTicker(rwp.config.HeartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-rwp.closeCh:
+			return
+		case <-ticker.C:
+			if rwp.raft.State() == raft.Leader {
+				rwp.addDiscoveredPeers()
+			}
+		}
+	}
+}
+
+// addDiscoveredPeers 将发现的节点中不在集群配置或地址已变化的节点添加为投票节点
+func (rwp *RaftWorkerIdProvider) addDiscoveredPeers() {
+	resolver := getRaftPeerResolver()
+	if resolver == nil {
+		return
+	}
+	peers, err := resolver(rwp.config.NodeId, rwp.streamLayer.Addr().String())
+	if err != nil {
+		log.Printf("resolve raft peers failed. %s", err.Error())
+		return
+	}
+	future := rwp.raft.GetConfiguration()
+	if err = future.Error(); err != nil {
+		log.Printf("get raft configuration failed. %s", err.Error())
+		return
+	}
+	members := make(map[string]string)
+	for _, server := range future.Configuration().Servers {
+		members[string(server.ID)] = string(server.Address)
+	}
+	for id, addr := range peers {
+		if members[id] == addr || id == rwp.config.NodeId {
+			continue
+		}
+		log.Printf("add raft voter. id: %s addr: %s", id, addr)
+		if err = rwp.raft.AddVoter(raft.ServerID(id), raft.ServerAddress(addr), 0, raftCommandTimeout).Error(); err != nil {
+			log.Printf("add raft voter %s failed. %s", id, err.Error())
+			return
+		}
+	}
+}
+
+// waitApply 在deadline之前重复执行命令，直到成功，用于等待选出leader
+func (rwp *RaftWorkerIdProvider) waitApply(cmd *raftCommand, deadline time.Time) (*raftCommandResult, error) {
+	for {
+		result, err := rwp.apply(cmd)
+		if err == nil && result.Error == "" {
+			return result, nil
+		}
+		if err == nil {
+			// 命令已执行，但是结果为失败，e.g. 没有空闲的workerId，不再重试
+			return nil, errors.New(result.Error)
+		}
+		if time.Now().After(deadline) {
+			return nil, err
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+}
+
+// apply 执行命令，当前节点不是leader时转发给leader
+func (rwp *RaftWorkerIdProvider) apply(cmd *raftCommand) (*raftCommandResult, error) {
+	if rwp.raft.State() == raft.Leader {
+		local := *cmd
+		local.Secret = ""
+		data, err := json.Marshal(&local)
+		if err != nil {
+			return nil, err
+		}
+		future := rwp.raft.Apply(data, raftCommandTimeout)
+		if err = future.Error(); err != nil {
+			return nil, err
+		}
+		return future.Response().(*raftCommandResult), nil
+	}
+	if cmd.Forwarded {
+		return nil, fmt.Errorf("raft node %s is not the leader", rwp.config.NodeId)
+	}
+	leaderAddr, _ := rwp.raft.LeaderWithID()
+	if leaderAddr == "" {
+		return nil, errors.New("raft leader is unknown")
+	}
+	forwarded := *cmd
+	forwarded.Forwarded = true
+	forwarded.Secret = rwp.config.Secret
+	return sendRaftCommand(string(leaderAddr), rwp.config.Secret, &forwarded, raftCommandTimeout)
+}
+
+// handleRemoteCommand 处理通过命令端口发送的命令，e.g. 其它节点转发的命令、管理命令
+//
+// 带有正确的共享密钥时执行所有命令；否则仅接受集群节点为自己申请、续约、释放workerId及列出分配记录，
+// 管理操作需要共享密钥，避免能访问命令端口的任何人绕过管理接口的认证
+func (rwp *RaftWorkerIdProvider) handleRemoteCommand(remote net.Addr, cmd *raftCommand) *raftCommandResult {
+	authenticated := rwp.config.Secret != "" && subtle.ConstantTimeCompare([]byte(cmd.Secret), []byte(rwp.config.Secret)) == 1
+	cmd.Secret = ""
+	if !authenticated {
+		if err := rwp.authorizeMember(remote, cmd); err != nil {
+			log.Printf("reject raft command %s from %s. %s", cmd.Op, remote.String(), err.Error())
+			return &raftCommandResult{Error: err.Error(), ErrorKind: raftErrUnauthorized}
+		}
+	}
+	if cmd.Op == raftOpList {
+		return &raftCommandResult{Allocations: rwp.fsm.list(), Reservations: rwp.fsm.reservations()}
+	}
+	result, err := rwp.apply(cmd)
+	if err != nil {
+		return &raftCommandResult{Error: err.Error()}
+	}
+	return result
+}
+
+// authorizeMember 未认证的命令只能由集群节点发送，且只能操作自己或自己的备用workerId（节点ID#spareN）
+func (rwp *RaftWorkerIdProvider) authorizeMember(remote net.Addr, cmd *raftCommand) error {
+	switch cmd.Op {
+	case raftOpAllocate, raftOpHeartbeat, raftOpRelease, raftOpList:
+	default:
+		return fmt.Errorf("raft command %s requires the raft secret, use the admin api of the leader or set RAFT_SECRET", cmd.Op)
+	}
+	remoteHost, _, err := net.SplitHostPort(remote.String())
+	if err != nil {
+		return err
+	}
+	future := rwp.raft.GetConfiguration()
+	if err = future.Error(); err != nil {
+		return err
+	}
+	for _, server := range future.Configuration().Servers {
+		if !raftAddrHasIP(string(server.Address), remoteHost) {
+			continue
+		}
+		id := string(server.ID)
+		if cmd.Op == raftOpList || cmd.Owner == id || strings.HasPrefix(cmd.Owner, id+"#spare") {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s is not a member of the raft cluster or doesn't own %q", remoteHost, cmd.Owner)
+}
+
+// raftAddrHasIP 节点地址（host:port）的主机是否解析为ip
+func raftAddrHasIP(addr, ip string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == ip {
+		return true
+	}
+	ips, err := net.LookupHost(host)
+	if err != nil {
+		return false
+	}
+	for _, resolved := range ips {
+		if net.ParseIP(resolved).Equal(net.ParseIP(ip)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Lease workerId的租约
+func (rwp *RaftWorkerIdProvider) Lease() (Lease, error) {
+	if rwp.leaseState == nil {
+		return nil, errors.New("raft worker id provider is not initialized")
+	}
+	return rwp, nil
+}
+
+// WorkerId 租约对应的workerId
+func (rwp *RaftWorkerIdProvider) WorkerId() int64 {
+	return rwp.workerId
+}
+
+// RenewInterval 续约间隔，即上报时间戳的间隔
+func (rwp *RaftWorkerIdProvider) RenewInterval() time.Duration {
+	return rwp.config.HeartbeatInterval
+}
+
+// Renew 上报时间戳，时间戳不小于已发放id的最新时间戳。workerId已被回收时，租约丢失
+func (rwp *RaftWorkerIdProvider) Renew(issuedTimestamp int64) (time.Time, error) {
+	rwp.lock.Lock()
+	defer rwp.lock.Unlock()
+	if rwp.released {
+		return time.Time{}, errors.New("lease of workerId is released")
+	}
+	return rwp.heartbeat(rwp.config.NodeId, rwp.workerId, issuedTimestamp, rwp.leaseState)
+}
+
+// Release 上报最后的时间戳并释放workerId，释放后workerId可以分配给其它节点
+func (rwp *RaftWorkerIdProvider) Release(issuedTimestamp int64) error {
+	rwp.lock.Lock()
+	defer rwp.lock.Unlock()
+	if rwp.released {
+		return nil
+	}
+	rwp.released = true
+	return rwp.release(rwp.config.NodeId, rwp.workerId, issuedTimestamp)
+}
+
+// heartbeat 以owner的身份上报workerId的时间戳并延长租约，workerId已不属于owner时租约丢失
+func (rwp *RaftWorkerIdProvider) heartbeat(owner string, workerId, issuedTimestamp int64, state *leaseState) (time.Time, error) {
+	result, err := rwp.apply(&raftCommand{
+		Op:        raftOpHeartbeat,
+		Owner:     owner,
+		WorkerId:  workerId,
+		Timestamp: latestTimestamp(issuedTimestamp),
+	})
+	if err != nil {
+		return time.Time{}, fmt.Errorf("upload timestamp via raft failed. %s", err.Error())
+	}
+	if result.Error != "" {
+		state.markLost(workerId, result.Error)
+		return time.Time{}, errors.New(result.Error)
+	}
+	return state.extend(), nil
+}
+
+// release 以owner的身份上报最后的时间戳并释放workerId
+func (rwp *RaftWorkerIdProvider) release(owner string, workerId, issuedTimestamp int64) error {
+	result, err := rwp.apply(&raftCommand{
+		Op:        raftOpRelease,
+		Owner:     owner,
+		WorkerId:  workerId,
+		Timestamp: latestTimestamp(issuedTimestamp),
+	})
+	if err != nil {
+		return fmt.Errorf("release workerId %d via raft failed. %s", workerId, err.Error())
+	}
+	if result.Error != "" {
+		return errors.New(result.Error)
+	}
+	return nil
+}
+
+// NewSpare 在当前raft节点上以 节点ID#spareN 的身份申请备用workerId
+func (rwp *RaftWorkerIdProvider) NewSpare(index int) (WorkerIdProvider, error) {
+	if rwp.raft == nil {
+		return nil, errors.New("raft worker id provider is not initialized")
+	}
+	return &raftSpareWorkerIdProvider{
+		parent:   rwp,
+		owner:    fmt.Sprintf("%s#spare%d", rwp.config.NodeId, index),
+		workerId: -1,
+	}, nil
+}
+
+// raftSpareWorkerIdProvider 备用workerId，使用RaftWorkerIdProvider的raft节点申请、续约及释放
+type raftSpareWorkerIdProvider struct {
+	parent   *RaftWorkerIdProvider
+	owner    string
+	workerId int64
+	*leaseState
+	released bool
+	lock     sync.Mutex
+}
+
+// Init 申请workerId，并等待时间超过其上一个占用者的最新时间戳
+func (s *raftSpareWorkerIdProvider) Init(ip, port, appName string) error {
+	result, err := s.parent.waitApply(&raftCommand{
+		Op:           raftOpAllocate,
+		Owner:        s.owner,
+		Addr:         ip + ":" + port,
+		Timestamp:    timeGen(),
+		RecycleAfter: s.parent.config.RecycleAfter.Milliseconds(),
+		MinWorkerId:  0,
+		MaxWorkerId:  allocatableMaxWorkerId(),
+	}, time.Now().Add(s.parent.config.InitTimeout))
+	if err != nil {
+		return fmt.Errorf("allocate spare workerId via raft failed. %s", err.Error())
+	}
+	if err = waitPastTimestamp(result.PreviousTimestamp, fmt.Sprintf("workerId %d previous", result.WorkerId)); err != nil {
+		if errRelease := s.parent.release(s.owner, result.WorkerId, timeGen()); errRelease != nil {
+			log.Println(errRelease.Error())
+		}
+		return err
+	}
+	s.workerId = result.WorkerId
+	s.leaseState = newLeaseState(3 * s.parent.config.HeartbeatInterval)
+	s.extend()
+	log.Printf("get spare workerId via raft. owner: %s workerId: %d", s.owner, result.WorkerId)
+	return nil
+}
+
+func (s *raftSpareWorkerIdProvider) GetWorkerId() (int64, error) {
+	if s.workerId < 0 {
+		return 0, fmt.Errorf("worker id is wrong. Please check the provider")
+	}
+	return s.workerId, nil
+}
+
+func (s *raftSpareWorkerIdProvider) ProviderName() string {
+	return PROVIDER_RAFT
+}
+
+// Lease 备用workerId的租约
+func (s *raftSpareWorkerIdProvider) Lease() (Lease, error) {
+	if s.leaseState == nil {
+		return nil, errors.New("raft spare worker id provider is not initialized")
+	}
+	return s, nil
+}
+
+// WorkerId 租约对应的workerId
+func (s *raftSpareWorkerIdProvider) WorkerId() int64 {
+	return s.workerId
+}
+
+// RenewInterval 续约间隔，与当前workerId相同
+func (s *raftSpareWorkerIdProvider) RenewInterval() time.Duration {
+	return s.parent.config.HeartbeatInterval
+}
+
+// Renew 上报时间戳
+func (s *raftSpareWorkerIdProvider) Renew(issuedTimestamp int64) (time.Time, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.released {
+		return time.Time{}, errors.New("lease of spare workerId is released")
+	}
+	return s.parent.heartbeat(s.owner, s.workerId, issuedTimestamp, s.leaseState)
+}
+
+// Release 上报最后的时间戳并释放workerId
+func (s *raftSpareWorkerIdProvider) Release(issuedTimestamp int64) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.released || s.workerId < 0 {
+		return nil
+	}
+	s.released = true
+	return s.parent.release(s.owner, s.workerId, issuedTimestamp)
+}
+
+func (rwp *RaftWorkerIdProvider) GetWorkerId() (int64, error) {
+	if rwp.workerId < 0 {
+		return 0, fmt.Errorf("worker id is wrong. Please check the provider")
+	}
+	return rwp.workerId, nil
+}
+
+func (rwp *RaftWorkerIdProvider) ProviderName() string {
+	return PROVIDER_RAFT
+}
+
+// ListAllocations 列出workerId分配记录，未初始化时（e.g. 管理命令）从配置的节点获取
+func (rwp *RaftWorkerIdProvider) ListAllocations(appName string) ([]WorkerIdAllocation, error) {
+	if rwp.raft != nil {
+		return rwp.toAllocations(rwp.fsm.list()), nil
+	}
+	result, err := rwp.sendToPeers(&raftCommand{Op: raftOpList})
+	if err != nil {
+		return nil, err
+	}
+	return rwp.toAllocations(result.Allocations), nil
+}
+
+// ExpireStaleAllocations 回收超过olderThan未上报时间戳的workerId，olderThan小于等于0时使用RecycleAfter
+func (rwp *RaftWorkerIdProvider) ExpireStaleAllocations(appName string, olderThan time.Duration) ([]WorkerIdAllocation, error) {
+	if olderThan <= 0 {
+		olderThan = rwp.config.RecycleAfter
+	}
+	result, err := rwp.execute(&raftCommand{
+		Op:           raftOpExpire,
+		Timestamp:    timeGen(),
+		RecycleAfter: olderThan.Milliseconds(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rwp.toAllocations(result.Allocations), nil
+}
+
+// ReleaseAllocation 释放workerId，force为false时仅释放超过RecycleAfter未上报时间戳的workerId
+func (rwp *RaftWorkerIdProvider) ReleaseAllocation(appName string, workerId int64, force bool) (WorkerIdAllocation, error) {
+	result, err := rwp.execute(&raftCommand{
+		Op:           raftOpEvict,
+		WorkerId:     workerId,
+		Timestamp:    timeGen(),
+		RecycleAfter: rwp.config.RecycleAfter.Milliseconds(),
+		Force:        force,
+	})
+	if err != nil {
+		return WorkerIdAllocation{}, err
+	}
+	if len(result.Allocations) == 0 {
+		return WorkerIdAllocation{}, fmt.Errorf("release workerId %d via raft returned no allocation", workerId)
+	}
+	log.Printf("release workerId %d via raft", workerId)
+	return rwp.toAllocations(result.Allocations)[0], nil
+}
+
+// ReserveWorkerId 保留workerId，已保留时更新原因
+func (rwp *RaftWorkerIdProvider) ReserveWorkerId(appName string, workerId int64, reason string) error {
+	_, err := rwp.execute(&raftCommand{
+		Op:        raftOpReserve,
+		WorkerId:  workerId,
+		Timestamp: timeGen(),
+		Reason:    reason,
+	})
+	if err == nil {
+		log.Printf("reserve workerId %d via raft, reason: %s", workerId, reason)
+	}
+	return err
+}
+
+// UnreserveWorkerId 取消保留workerId
+func (rwp *RaftWorkerIdProvider) UnreserveWorkerId(appName string, workerId int64) error {
+	_, err := rwp.execute(&raftCommand{
+		Op:        raftOpUnreserve,
+		WorkerId:  workerId,
+		Timestamp: timeGen(),
+	})
+	if err == nil {
+		log.Printf("unreserve workerId %d via raft", workerId)
+	}
+	return err
+}
+
+// ListReservations 列出保留的workerId，未初始化时从配置的节点获取
+func (rwp *RaftWorkerIdProvider) ListReservations(appName string) ([]WorkerIdReservation, error) {
+	var raftReservations []raftReservation
+	if rwp.raft != nil {
+		raftReservations = rwp.fsm.reservations()
+	} else {
+		result, err := rwp.sendToPeers(&raftCommand{Op: raftOpList})
+		if err != nil {
+			return nil, err
+		}
+		raftReservations = result.Reservations
+	}
+	reservations := make([]WorkerIdReservation, 0, len(raftReservations))
+	for _, r := range raftReservations {
+		reservations = append(reservations, WorkerIdReservation{WorkerId: r.WorkerId, Reason: r.Reason, Timestamp: r.Timestamp})
+	}
+	return reservations, nil
+}
+
+// execute 执行命令，未初始化时（e.g. 管理命令）发送给配置的节点
+func (rwp *RaftWorkerIdProvider) execute(cmd *raftCommand) (*raftCommandResult, error) {
+	var result *raftCommandResult
+	var err error
+	if rwp.raft != nil {
+		result, err = rwp.apply(cmd)
+	} else {
+		result, err = rwp.sendToPeers(cmd)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = result.err(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// sendToPeers 按顺序发送命令给配置的节点，直到成功
+func (rwp *RaftWorkerIdProvider) sendToPeers(cmd *raftCommand) (*raftCommandResult, error) {
+	if len(rwp.config.Peers) == 0 {
+		return nil, errors.New("raft peers are not configured, set RAFT_PEERS")
+	}
+	ids := make([]string, 0, len(rwp.config.Peers))
+	for id := range rwp.config.Peers {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	authenticated := *cmd
+	authenticated.Secret = rwp.config.Secret
+	failures := make([]string, 0, len(ids))
+	for _, id := range ids {
+		result, err := sendRaftCommand(rwp.config.Peers[id], rwp.config.Secret, &authenticated, raftCommandTimeout)
+		// 命令已执行，但是结果为失败，e.g. workerId未分配，不再发送给其它节点
+		if err == nil && (result.Error == "" || result.ErrorKind != "") {
+			return result, nil
+		}
+		if err == nil {
+			err = errors.New(result.Error)
+		}
+		failures = append(failures, fmt.Sprintf("%s: %s", id, err.Error()))
+	}
+	return nil, errors.New("send raft command failed. " + strings.Join(failures, "; "))
+}
+
+func (rwp *RaftWorkerIdProvider) toAllocations(raftAllocations []raftAllocation) []WorkerIdAllocation {
+	curTimestamp := timeGen()
+	recycleAfter := rwp.config.RecycleAfter.Milliseconds()
+	allocations := make([]WorkerIdAllocation, 0, len(raftAllocations))
+	for _, a := range raftAllocations {
+		allocations = append(allocations, WorkerIdAllocation{
+			WorkerId:  a.WorkerId,
+			Owner:     a.Addr,
+			Path:      "raft/" + a.Owner,
+			Timestamp: a.Timestamp,
+			Stale:     curTimestamp-a.Timestamp >= recycleAfter,
+		})
+	}
+	return allocations
+}
+
+// Close 未释放workerId时先释放，然后关闭raft节点
+func (rwp *RaftWorkerIdProvider) Close() {
+	rwp.lock.Lock()
+	if rwp.closed || rwp.raft == nil {
+		rwp.lock.Unlock()
+		return
+	}
+	rwp.closed = true
+	rwp.lock.Unlock()
+	if rwp.leaseState != nil {
+		if err := rwp.Release(timeGen()); err != nil {
+			log.Println(err.Error())
+		}
+	}
+	// 当前节点是leader时，先转移leader，减少其它节点等待选举的时间
+	if rwp.raft.State() == raft.Leader {
+		if err := rwp.raft.LeadershipTransfer().Error(); err != nil {
+			log.Printf("transfer raft leadership failed. %s", err.Error())
+		}
+	}
+	rwp.shutdown()
+}
+
+// shutdown 关闭raft节点及存储
+func (rwp *RaftWorkerIdProvider) shutdown() {
+	rwp.closeOnce.Do(func() {
+		close(rwp.closeCh)
+	})
+	if rwp.raft != nil {
+		if err := rwp.raft.Shutdown().Error(); err != nil {
+			log.Printf("shutdown raft failed. %s", err.Error())
+		}
+	}
+	if rwp.transport != nil {
+		rwp.transport.Close()
+	}
+	if rwp.streamLayer != nil {
+		rwp.streamLayer.Close()
+	}
+	if rwp.store != nil {
+		rwp.store.Close()
+	}
+}
+
+// parseRaftPeers 解析节点列表，格式为 id1=host1:port1,id2=host2:port2
+func parseRaftPeers(value string) (map[string]string, error) {
+	peers := make(map[string]string)
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		idAddr := strings.SplitN(item, "=", 2)
+		if len(idAddr) != 2 || idAddr[0] == "" || idAddr[1] == "" {
+			return nil, fmt.Errorf("raft peer %q is wrong, the format is id=host:port", item)
+		}
+		if _, exists := peers[idAddr[0]]; exists {
+			return nil, fmt.Errorf("raft peer id %s is duplicated", idAddr[0])
+		}
+		peers[idAddr[0]] = idAddr[1]
+	}
+	return peers, nil
+}
+
+// newRaftWorkerIdProviderFromConfig 根据配置项创建RaftWorkerIdProvider
+func newRaftWorkerIdProviderFromConfig(config map[string]string) (WorkerIdProvider, error) {
+	peers, err := parseRaftPeers(config["RAFT_PEERS"])
+	if err != nil {
+		return nil, err
+	}
+	nodeId := config["RAFT_NODE_ID"]
+	if nodeId == "" {
+		// 默认使用主机名，StatefulSet中各Pod的主机名固定且唯一
+		nodeId, _ = os.Hostname()
+	}
+	heartbeatInterval, err := configInt64(config, "RAFT_HEARTBEAT_INTERVAL")
+	if err != nil {
+		return nil, err
+	}
+	recycleAfter, err := configInt64(config, "RAFT_RECYCLE_AFTER")
+	if err != nil {
+		return nil, err
+	}
+	initTimeout, err := configInt64(config, "RAFT_INIT_TIMEOUT")
+	if err != nil {
+		return nil, err
+	}
+	expectPeers, err := configInt64(config, "RAFT_BOOTSTRAP_EXPECT")
+	if err != nil {
+		return nil, err
+	}
+	return NewRaftWorkerIdProvider(RaftConfig{
+		NodeId:            nodeId,
+		BindAddr:          config["RAFT_BIND_ADDR"],
+		AdvertiseAddr:     config["RAFT_ADVERTISE_ADDR"],
+		Peers:             peers,
+		DataDir:           config["RAFT_DATA_DIR"],
+		HeartbeatInterval: time.Duration(heartbeatInterval) * time.Millisecond,
+		RecycleAfter:      time.Duration(recycleAfter) * time.Second,
+		InitTimeout:       time.Duration(initTimeout) * time.Millisecond,
+		ExpectPeers:       int(expectPeers),
+		BootstrapNode:     config["RAFT_BOOTSTRAP_NODE"],
+		Secret:            config["RAFT_SECRET"],
+	})
+}
+
+func init() {
+	RegisterProvider(PROVIDER_RAFT, ProviderFactory{
+		Options: []ConfigOption{
+			{Name: "RAFT_NODE_ID", Description: "raft节点ID，集群内唯一，默认为主机名"},
+			{Name: "RAFT_BIND_ADDR", Default: "0.0.0.0:8075", Required: true, Description: "raft监听地址"},
+			{Name: "RAFT_ADVERTISE_ADDR", Description: "其它节点访问本节点的地址，默认为RAFT_BIND_ADDR"},
+			{Name: "RAFT_PEERS", Description: "集群节点，格式为 id1=host1:port1,id2=host2:port2，为空时通过服务发现获取"},
+			{Name: "RAFT_DATA_DIR", Default: filepath.Join(os.TempDir(), "snowflake-go", "raft"), Required: true, Description: "raft数据目录"},
+			{Name: "RAFT_HEARTBEAT_INTERVAL", Default: "3000", Description: "上报时间戳的间隔，单位ms"},
+			{Name: "RAFT_RECYCLE_AFTER", Default: "86400", Description: "超过该时长未上报时间戳的workerId可以被回收，单位s"},
+			{Name: "RAFT_INIT_TIMEOUT", Default: "30000", Description: "等待选出leader并分配workerId的超时时间，单位ms"},
+			{Name: "RAFT_BOOTSTRAP_EXPECT", Default: "3", Description: "通过服务发现获取节点列表时，至少发现该数量的节点后才初始化集群"},
+			{Name: "RAFT_BOOTSTRAP_NODE", Description: "初始化集群的节点ID，仅该节点初始化集群，通过服务发现获取节点列表时必填"},
+			{Name: "RAFT_SECRET", Secret: true, Description: "raft端口的共享密钥，设置后raft连接及命令连接都需要认证；为空时raft端口必须只允许集群节点访问，管理操作只能通过leader的管理接口执行"},
+		},
+		New: newRaftWorkerIdProviderFromConfig,
+	})
+}
+
+// raftPeersString 节点列表转为 id=addr 格式，用于日志
+func raftPeersString(peers map[string]string) string {
+	items := make([]string, 0, len(peers))
+	for id, addr := range peers {
+		items = append(items, id+"="+addr)
+	}
+	sort.Strings(items)
+	return strings.Join(items, ",")
+}
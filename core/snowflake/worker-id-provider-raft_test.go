@@ -0,0 +1,341 @@
+package snowflake
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/raft"
+)
+
+// freeRaftAddrs 获取n个本机空闲地址
+func freeRaftAddrs(t *testing.T, n int) []string {
+	t.Helper()
+	addrs := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		addrs = append(addrs, l.Addr().String())
+		l.Close()
+	}
+	return addrs
+}
+
+// startRaftCluster 在本机启动n个节点的集群，并发初始化，返回各节点的RaftWorkerIdProvider
+func startRaftCluster(t *testing.T, n int, configure func(*RaftConfig)) []*RaftWorkerIdProvider {
+	t.Helper()
+	addrs := freeRaftAddrs(t, n)
+	peers := make(map[string]string, n)
+	for i, addr := range addrs {
+		peers[fmt.Sprintf("n%d", i+1)] = addr
+	}
+	providers := make([]*RaftWorkerIdProvider, n)
+	for i, addr := range addrs {
+		config := RaftConfig{
+			NodeId:            fmt.Sprintf("n%d", i+1),
+			BindAddr:          addr,
+			Peers:             peers,
+			DataDir:           t.TempDir(),
+			HeartbeatInterval: 200 * time.Millisecond,
+			RecycleAfter:      time.Minute,
+			InitTimeout:       20 * time.Second,
+		}
+		if configure != nil {
+			configure(&config)
+		}
+		p, err := NewRaftWorkerIdProvider(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		providers[i] = p
+	}
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i, p := range providers {
+		wg.Add(1)
+		go func(i int, p *RaftWorkerIdProvider) {
+			defer wg.Done()
+			errs[i] = p.Init("127.0.0.1", fmt.Sprintf("%d", 18080+i), "raft-test")
+		}(i, p)
+	}
+	wg.Wait()
+	t.Cleanup(func() {
+		for _, p := range providers {
+			p.Close()
+		}
+	})
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("init node n%d failed. %v", i+1, err)
+		}
+	}
+	return providers
+}
+
+func assertDistinctWorkerIds(t *testing.T, providers []*RaftWorkerIdProvider) {
+	t.Helper()
+	seen := make(map[int64]string)
+	for _, p := range providers {
+		workerId, err := p.GetWorkerId()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if owner, ok := seen[workerId]; ok {
+			t.Fatalf("worker id %d is allocated to both %s and %s", workerId, owner, p.config.NodeId)
+		}
+		seen[workerId] = p.config.NodeId
+	}
+}
+
+func TestRaftClusterOnLoopback(t *testing.T) {
+	providers := startRaftCluster(t, 3, nil)
+	assertDistinctWorkerIds(t, providers)
+	for _, p := range providers {
+		if _, err := p.Renew(timeGen()); err != nil {
+			t.Fatalf("renew lease of %s failed. %v", p.config.NodeId, err)
+		}
+	}
+	allocations, err := providers[0].ListAllocations("raft-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(allocations) != 3 {
+		t.Fatalf("got %d allocations, want 3", len(allocations))
+	}
+	// 释放未分配的workerId时返回错误，不会panic
+	if _, err = providers[1].ReleaseAllocation("raft-test", MaxWorkerId(), true); err == nil {
+		t.Fatal("release an unallocated worker id should fail")
+	}
+}
+
+// registryResolver 模拟服务发现，只返回已经调用过resolver（即已注册）的节点
+func registryResolver() RaftPeerResolver {
+	var lock sync.Mutex
+	registered := make(map[string]string)
+	return func(selfId, selfAddr string) (map[string]string, error) {
+		lock.Lock()
+		defer lock.Unlock()
+		registered[selfId] = selfAddr
+		peers := make(map[string]string, len(registered))
+		for id, addr := range registered {
+			peers[id] = addr
+		}
+		return peers, nil
+	}
+}
+
+// waitRaftServers 等待leader将发现的节点都添加到集群配置中
+func waitRaftServers(t *testing.T, p *RaftWorkerIdProvider, n int) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		servers := p.raft.GetConfiguration().Configuration().Servers
+		if len(servers) == n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("got %d raft servers, want %d", len(servers), n)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+func TestRaftClusterBootstrapsFromSeedOnly(t *testing.T) {
+	for _, expectPeers := range []int{1, 3} {
+		t.Run(fmt.Sprintf("expect%d", expectPeers), func(t *testing.T) {
+			// 初始化节点只使用已注册的节点初始化集群，之后注册的节点由leader添加为投票节点
+			SetRaftPeerResolver(registryResolver())
+			defer SetRaftPeerResolver(nil)
+			providers := startRaftCluster(t, 3, func(config *RaftConfig) {
+				config.Peers = nil
+				config.BootstrapNode = "n1"
+				config.ExpectPeers = expectPeers
+			})
+			assertDistinctWorkerIds(t, providers)
+			for _, p := range providers {
+				waitRaftServers(t, p, 3)
+			}
+		})
+	}
+}
+
+func TestRaftDiscoveryRequiresBootstrapNode(t *testing.T) {
+	p, err := NewRaftWorkerIdProvider(RaftConfig{
+		NodeId:            "n1",
+		BindAddr:          freeRaftAddrs(t, 1)[0],
+		DataDir:           t.TempDir(),
+		HeartbeatInterval: 200 * time.Millisecond,
+		RecycleAfter:      time.Minute,
+		InitTimeout:       time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = p.Init("127.0.0.1", "18080", "raft-test"); err == nil {
+		p.Close()
+		t.Fatal("init without peers and bootstrap node should fail")
+	}
+}
+
+// follower 集群中不是leader的节点
+func follower(t *testing.T, providers []*RaftWorkerIdProvider) *RaftWorkerIdProvider {
+	t.Helper()
+	for _, p := range providers {
+		if p.raft.State() != raft.Leader {
+			return p
+		}
+	}
+	t.Fatal("no follower")
+	return nil
+}
+
+func TestRaftCommandPortRejectsUnauthenticatedAdminCommands(t *testing.T) {
+	providers := startRaftCluster(t, 3, nil)
+	target, _ := providers[0].GetWorkerId()
+	for _, p := range providers {
+		addr := p.streamLayer.Addr().String()
+		for _, cmd := range []*raftCommand{
+			{Op: raftOpEvict, WorkerId: target, Timestamp: timeGen(), Force: true},
+			{Op: raftOpReserve, WorkerId: MaxWorkerId(), Timestamp: timeGen()},
+			{Op: raftOpUnreserve, WorkerId: MaxWorkerId(), Timestamp: timeGen()},
+			{Op: raftOpExpire, Timestamp: timeGen(), RecycleAfter: 1},
+			// 节点只能续约自己的workerId
+			{Op: raftOpHeartbeat, Owner: "intruder", WorkerId: target, Timestamp: timeGen()},
+		} {
+			result, err := sendRaftCommand(addr, "", cmd, time.Second)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.ErrorKind != raftErrUnauthorized {
+				t.Fatalf("%s sent to %s without secret: got %+v, want unauthorized", cmd.Op, p.config.NodeId, result)
+			}
+		}
+	}
+	// 未设置共享密钥时，follower的管理接口无法转发管理操作
+	if _, err := follower(t, providers).ReleaseAllocation("raft-test", target, true); err == nil {
+		t.Fatal("admin command forwarded without secret should be rejected")
+	}
+	if _, err := providers[0].Renew(timeGen()); err != nil {
+		t.Fatalf("lease of n1 should be kept. %v", err)
+	}
+}
+
+func TestRaftCommandPortAcceptsSecret(t *testing.T) {
+	providers := startRaftCluster(t, 3, func(config *RaftConfig) {
+		config.Secret = "s3cret"
+	})
+	f := follower(t, providers)
+	if err := f.ReserveWorkerId("raft-test", MaxWorkerId(), "test"); err != nil {
+		t.Fatalf("admin command forwarded with secret failed. %v", err)
+	}
+	// 各节点应用日志有延迟，从leader读取
+	var leader *RaftWorkerIdProvider
+	for _, p := range providers {
+		if p.raft.State() == raft.Leader {
+			leader = p
+		}
+	}
+	if leader == nil {
+		t.Fatal("no leader")
+	}
+	reservations, err := leader.ListReservations("raft-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reservations) != 1 || reservations[0].WorkerId != MaxWorkerId() {
+		t.Fatalf("got reservations %+v", reservations)
+	}
+	result, err := sendRaftCommand(f.streamLayer.Addr().String(), "s3cret", &raftCommand{Op: raftOpUnreserve, WorkerId: MaxWorkerId(), Timestamp: timeGen(), Secret: "wrong"}, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.ErrorKind != raftErrUnauthorized {
+		t.Fatalf("wrong secret: got %+v, want unauthorized", result)
+	}
+}
+
+// assertConnClosed 读取连接直到被对方关闭，超时未关闭时测试失败
+func assertConnClosed(t *testing.T, conn net.Conn, name string) {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 64)
+	for {
+		_, err := conn.Read(buf)
+		if err == nil {
+			continue
+		}
+		if ne, ok := err.(net.Error); ok && ne.Timeout() {
+			t.Fatalf("%s: connection is still open", name)
+		}
+		return
+	}
+}
+
+func TestRaftPortRejectsUnauthenticatedConnections(t *testing.T) {
+	providers := startRaftCluster(t, 3, func(config *RaftConfig) {
+		config.Secret = "s3cret"
+	})
+	addr := providers[0].streamLayer.Addr().String()
+	// 不做认证，直接发送raft消息
+	conn, err := net.DialTimeout("tcp", addr, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.Write(append([]byte{raftConnTypeRaft}, make([]byte, 64)...))
+	assertConnClosed(t, conn, "raft connection without auth")
+	// 以错误的密钥认证
+	wrong, err := dialRaftConn(addr, raftConnTypeRaft, "wrong", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wrong.Close()
+	assertConnClosed(t, wrong, "raft connection with wrong secret")
+	for _, secret := range []string{"", "wrong"} {
+		if result, err := sendRaftCommand(addr, secret, &raftCommand{Op: raftOpList}, time.Second); err == nil {
+			t.Fatalf("command with secret %q: got %+v, want connection rejected", secret, result)
+		}
+	}
+	// 认证通过的连接正常使用
+	if _, err = sendRaftCommand(addr, "s3cret", &raftCommand{Op: raftOpList}, time.Second); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// enableJsSafe 启用js-safe，测试结束后恢复
+func enableJsSafe(t *testing.T) {
+	t.Helper()
+	prev := conf.JsSafe
+	conf.JsSafe = true
+	t.Cleanup(func() { conf.JsSafe = prev })
+}
+
+func TestRaftAllocateCapsWorkerIdWhenJsSafe(t *testing.T) {
+	enableJsSafe(t)
+	f := newWorkerIdFSM()
+	now := timeGen()
+	// 启用js-safe之前分配的workerId超出范围
+	f.allocations[500] = &raftAllocation{WorkerId: 500, Owner: "n1", Timestamp: now}
+	for workerId := int64(0); workerId < JsSafeLayout.MaxWorkerId(); workerId++ {
+		f.allocations[workerId] = &raftAllocation{WorkerId: workerId, Owner: fmt.Sprintf("other-%d", workerId), Timestamp: now}
+	}
+	cmd := &raftCommand{Op: raftOpAllocate, Owner: "n1", Timestamp: now, RecycleAfter: time.Hour.Milliseconds(), MaxWorkerId: allocatableMaxWorkerId()}
+	result := f.allocate(cmd)
+	if result.Error != "" || result.WorkerId != JsSafeLayout.MaxWorkerId() {
+		t.Fatalf("got %+v, want workerId %d", result, JsSafeLayout.MaxWorkerId())
+	}
+	if _, ok := f.allocations[500]; ok {
+		t.Fatal("out of range workerId 500 should be released")
+	}
+	if f.released[500] != now {
+		t.Fatalf("got released timestamp %d of workerId 500, want %d", f.released[500], now)
+	}
+	cmd.Owner = "n2"
+	if result = f.allocate(cmd); result.Error == "" {
+		t.Fatalf("got %+v, want no free workerId", result)
+	}
+}
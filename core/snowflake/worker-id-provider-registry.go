@@ -0,0 +1,126 @@
+package snowflake
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ConfigOption WorkerIdProvider的配置项
+type ConfigOption struct {
+	// 配置项名称，同时也是读取配置值的环境变量名称，e.g. ZOOKEEPER_CONN_STRING
+	Name string
+	// 默认值
+	Default string
+	// 是否必填，必填项没有值时，创建WorkerIdProvider失败
+	Required bool
+	// 说明
+	Description string
+	// 是否为敏感信息，e.g. 密码，输出配置时隐藏
+	Secret bool
+}
+
+// ProviderFactory WorkerIdProvider工厂
+type ProviderFactory struct {
+	// 配置项
+	Options []ConfigOption
+	// New 根据配置创建WorkerIdProvider，config的key为配置项名称，未设置的配置项为默认值
+	New func(config map[string]string) (WorkerIdProvider, error)
+}
+
+var providerFactories = make(map[string]ProviderFactory)
+var providerFactoriesLock sync.RWMutex
+
+// RegisterProvider 注册WorkerIdProvider，注册后可以通过 WOKER_ID_PROVIDER=name 使用
+//
+// 一般在init函数中调用，名称重复或factory无效时panic
+func RegisterProvider(name string, factory ProviderFactory) {
+	providerFactoriesLock.Lock()
+	defer providerFactoriesLock.Unlock()
+	if name == "" || strings.Contains(name, ",") {
+		panic(fmt.Sprintf("worker id provider name %q is invalid", name))
+	}
+	if factory.New == nil {
+		panic(fmt.Sprintf("worker id provider %s: factory.New is nil", name))
+	}
+	if _, exists := providerFactories[name]; exists {
+		panic(fmt.Sprintf("worker id provider %s is already registered", name))
+	}
+	providerFactories[name] = factory
+}
+
+// ProviderNames 已注册的WorkerIdProvider名称
+func ProviderNames() []string {
+	providerFactoriesLock.RLock()
+	defer providerFactoriesLock.RUnlock()
+	names := make([]string, 0, len(providerFactories))
+	for name := range providerFactories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ProviderOptions 获取WorkerIdProvider的配置项
+func ProviderOptions(name string) ([]ConfigOption, bool) {
+	providerFactoriesLock.RLock()
+	defer providerFactoriesLock.RUnlock()
+	factory, ok := providerFactories[name]
+	return factory.Options, ok
+}
+
+// NewWorkerProvider 根据名称创建已注册的WorkerIdProvider，配置项为Config.ProviderOptions中的值
+func NewWorkerProvider(name string) (provider WorkerIdProvider, err error) {
+	providerFactoriesLock.RLock()
+	factory, ok := providerFactories[name]
+	providerFactoriesLock.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown worker id provider %q, valid names: %s", name, strings.Join(ProviderNames(), ", "))
+	}
+	config, err := loadProviderConfig(name, factory.Options)
+	if err != nil {
+		return nil, err
+	}
+	// 创建时panic则返回error
+	defer func() {
+		if r := recover(); r != nil {
+			provider, err = nil, fmt.Errorf("create worker id provider %s failed. %v", name, r)
+		}
+	}()
+	provider, err = factory.New(config)
+	if err != nil {
+		return nil, fmt.Errorf("create worker id provider %s failed. %w", name, err)
+	}
+	return provider, nil
+}
+
+// loadProviderConfig 读取配置项，未设置时为默认值
+func loadProviderConfig(name string, options []ConfigOption) (map[string]string, error) {
+	config := make(map[string]string, len(options))
+	for _, option := range options {
+		value, ok := conf.ProviderOptions[option.Name]
+		if !ok {
+			value = option.Default
+		}
+		if option.Required && value == "" {
+			return nil, fmt.Errorf("worker id provider %s requires %s. %s", name, option.Name, option.Description)
+		}
+		config[option.Name] = value
+	}
+	return config, nil
+}
+
+// configInt64 读取整型配置项
+func configInt64(config map[string]string, name string) (int64, error) {
+	value := config[name]
+	if value == "" {
+		return 0, nil
+	}
+	v, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%s must be a number, but it is %s", name, value)
+	}
+	return v, nil
+}
@@ -0,0 +1,1195 @@
+package snowflake
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-zookeeper/zk"
+)
+
+const rootNodePathTemplate = "/snowflake-go/worker-id-provider/%s"
+
+// 占位节点的根路径，子节点名称为workerId，数据为占用该workerId的节点名称，用于保证workerId不被重复分配
+const slotNodePathTemplate = "/snowflake-go/worker-id-slot/%s"
+
+// 保留节点的根路径，子节点名称为workerId，数据为保留原因等信息
+const reservedNodePathTemplate = "/snowflake-go/worker-id-reserved/%s"
+
+// 交接节点的根路径，子节点名称为workerId，数据为workerId释放时上一个占用者的负载，新的占用者需要等待时间超过其中的时间戳
+const handoffNodePathTemplate = "/snowflake-go/worker-id-handoff/%s"
+
+// 保留的workerId，其占位节点的数据，节点名称不会以 # 开头
+const reservedSlotData = "#reserved"
+
+// errSlotReserved 占位节点已被保留
+var errSlotReserved = errors.New("slot is reserved")
+
+// PayloadData 保存的的负载
+type PayloadData struct {
+	IP        string `json:"ip"`
+	Port      string `json:"port"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+// marshalPayloadData 创建负载数据
+func marshalPayloadData(ip, port string, timestamp int64) []byte {
+	data := PayloadData{
+		IP:        ip,
+		Port:      port,
+		Timestamp: timestamp,
+	}
+	v, _ := json.Marshal(data)
+	return v
+}
+
+// unmarshalPayloadData 解析负载数据
+func unmarshalPayloadData(value []byte) (*PayloadData, error) {
+	var data PayloadData
+	err := json.Unmarshal(value, &data)
+	if err == nil {
+		return &data, nil
+	} else {
+		return nil, fmt.Errorf("unmarshal playload data fialed. %s", value)
+	}
+}
+
+// ZookeeperWorkerIdProvider 基于Zookeeper实现
+//
+// 分配最小的空闲workerId，长时间未上报时间戳的节点，其workerId会被回收再分配
+//
+// 初始化成功后，会保持与Zookeeper的连接，并定时将当前时间戳（不小于已发放id的最新时间戳）写入workerId节点，
+// 以便重启时进行时钟校验
+//
+// 服务停止时释放workerId，并记录最后的时间戳，新的占用者等待时间超过该时间戳后再发放id
+//
+// 会话断开、过期或workerId节点归属无法确认时，归属状态变为未确认，IdGenerator将停止发放id，直到重新确认归属
+type ZookeeperWorkerIdProvider struct {
+	// 创建时的配置，用于创建备用WorkerIdProvider
+	config  ZookeeperConfig
+	connStr string
+	hosts   []string
+	// 所有节点路径的前辍
+	chroot string
+	// 认证方式，e.g. digest
+	authScheme string
+	// 认证信息，digest方式为 user:password
+	auth string
+	// 创建节点时使用的ACL
+	acl              []zk.ACL
+	ip               string
+	port             string
+	rootNodePath     string
+	slotNodePath     string
+	handoffNodePath  string
+	workerIdNodeName string
+	workerIdNodePath string
+	workerId         int64
+	// 上报时间戳的间隔
+	heartbeatInterval time.Duration
+	// 本机时间与其它存活节点时间戳平均值允许的最大偏差，单位ms
+	maxClockSkew int64
+	// 超过该时长未上报时间戳的节点，其workerId将被回收，小于等于0时不回收
+	recycleAfter time.Duration
+	conn         *zk.Conn
+	// workerId的租约，Init成功后创建
+	*leaseState
+	// 会话是否正常且已确认workerId节点的归属，会话断开或过期时立即变为false，重新建立会话并确认归属后变为true
+	confirmed atomic.Bool
+	released  bool
+	lock      sync.Mutex
+}
+
+// ZookeeperConfig ZookeeperWorkerIdProvider的配置
+type ZookeeperConfig struct {
+	// 连接字符串，多个用 , 分隔，支持 host1:2181,host2:2181/chroot 的形式
+	ConnStr string
+	// 上报时间戳的间隔
+	HeartbeatInterval time.Duration
+	// 启动时本机时间与其它存活节点时间戳平均值允许的最大偏差，单位ms，小于等于0时不校验
+	MaxClockSkew int64
+	// 超过该时长未上报时间戳的节点，其workerId将被回收，小于等于0时不回收
+	RecycleAfter time.Duration
+	// 所有节点路径的前辍，不为空时覆盖连接字符串中的chroot
+	Chroot string
+	// 认证方式，目前仅支持digest
+	AuthScheme string
+	// 认证信息，digest方式为 user:password，为空时不认证
+	Auth string
+	// 创建节点时使用的ACL，格式为 scheme:id:perms，多个用 , 分隔
+	ACL string
+}
+
+// DefaultZookeeperConfig 默认配置
+func DefaultZookeeperConfig(connStr string) ZookeeperConfig {
+	return ZookeeperConfig{
+		ConnStr:           connStr,
+		HeartbeatInterval: 3 * time.Second,
+		MaxClockSkew:      5000,
+		RecycleAfter:      24 * time.Hour,
+		AuthScheme:        "digest",
+	}
+}
+
+// NewZookeeperWorkerIdProviderWithConfig 创建ZookeeperWorkerIdProvider
+func NewZookeeperWorkerIdProviderWithConfig(config ZookeeperConfig) (*ZookeeperWorkerIdProvider, error) {
+	if config.ConnStr == "" {
+		return nil, errors.New("zookeeper connection string can't be empty")
+	}
+	if config.HeartbeatInterval <= 0 {
+		return nil, errors.New("zookeeper heartbeat interval must be greater than 0")
+	}
+	hosts, chroot := parseConnStr(config.ConnStr)
+	if config.Chroot != "" {
+		chroot = strings.TrimSuffix(config.Chroot, "/")
+	}
+	if chroot != "" && !strings.HasPrefix(chroot, "/") {
+		return nil, fmt.Errorf("zookeeper chroot must start with /, %s", chroot)
+	}
+	if config.AuthScheme == "sasl" {
+		return nil, errors.New("zookeeper sasl authentication is not supported by the zookeeper client, please use digest")
+	}
+	acl, err := parseACL(config.ACL)
+	if err != nil {
+		return nil, err
+	}
+	if len(acl) == 0 {
+		if config.Auth != "" {
+			// 仅已认证的用户拥有全部权限
+			acl = zk.AuthACL(zk.PermAll)
+		} else {
+			acl = zk.WorldACL(zk.PermAll)
+		}
+	}
+	return &ZookeeperWorkerIdProvider{
+		config:            config,
+		connStr:           config.ConnStr,
+		hosts:             hosts,
+		chroot:            chroot,
+		authScheme:        config.AuthScheme,
+		auth:              config.Auth,
+		acl:               acl,
+		heartbeatInterval: config.HeartbeatInterval,
+		maxClockSkew:      config.MaxClockSkew,
+		recycleAfter:      config.RecycleAfter,
+	}, nil
+}
+
+// newZookeeperWorkerIdProviderFromConfig 根据配置项创建ZookeeperWorkerIdProvider
+func newZookeeperWorkerIdProviderFromConfig(config map[string]string) (WorkerIdProvider, error) {
+	zkConfig := DefaultZookeeperConfig(config["ZOOKEEPER_CONN_STRING"])
+	heartbeatInterval, err := configInt64(config, "ZOOKEEPER_HEARTBEAT_INTERVAL")
+	if err != nil {
+		return nil, err
+	}
+	maxClockSkew, err := configInt64(config, "ZOOKEEPER_MAX_CLOCK_SKEW")
+	if err != nil {
+		return nil, err
+	}
+	recycleAfter, err := configInt64(config, "ZOOKEEPER_RECYCLE_AFTER")
+	if err != nil {
+		return nil, err
+	}
+	zkConfig.HeartbeatInterval = time.Duration(heartbeatInterval) * time.Millisecond
+	zkConfig.MaxClockSkew = maxClockSkew
+	zkConfig.RecycleAfter = time.Duration(recycleAfter) * time.Second
+	zkConfig.Chroot = config["ZOOKEEPER_CHROOT"]
+	zkConfig.AuthScheme = config["ZOOKEEPER_AUTH_SCHEME"]
+	zkConfig.Auth = config["ZOOKEEPER_AUTH"]
+	zkConfig.ACL = config["ZOOKEEPER_ACL"]
+	return NewZookeeperWorkerIdProviderWithConfig(zkConfig)
+}
+
+func init() {
+	RegisterProvider(PROVIDER_ZOOKEEPER, ProviderFactory{
+		Options: []ConfigOption{
+			{Name: "ZOOKEEPER_CONN_STRING", Default: "localhost:2181", Required: true, Description: "Zookeeper的连接字符串，多个用 , 分隔"},
+			{Name: "ZOOKEEPER_HEARTBEAT_INTERVAL", Default: "3000", Description: "定时往workerId节点上报时间戳的间隔，单位ms"},
+			{Name: "ZOOKEEPER_MAX_CLOCK_SKEW", Default: "5000", Description: "启动时本机时间与其它存活节点时间戳平均值允许的最大偏差，单位ms，小于等于0时不校验"},
+			{Name: "ZOOKEEPER_RECYCLE_AFTER", Default: "86400", Description: "超过该时长未上报时间戳的节点，其workerId将被回收，单位s，小于等于0时不回收"},
+			{Name: "ZOOKEEPER_CHROOT", Description: "所有节点路径的前辍，也可以在连接字符串后指定，e.g. localhost:2181/app"},
+			{Name: "ZOOKEEPER_AUTH_SCHEME", Default: "digest", Description: "认证方式，目前仅支持digest"},
+			{Name: "ZOOKEEPER_AUTH", Description: "认证信息，digest方式为 user:password，为空时不认证", Secret: true},
+			{Name: "ZOOKEEPER_ACL", Description: "创建节点时使用的ACL，格式为 scheme:id:perms，多个用 , 分隔。为空时，如果设置了认证信息，则为 auth::cdrwa，否则为 world:anyone:cdrwa"},
+		},
+		New: newZookeeperWorkerIdProviderFromConfig,
+	})
+}
+
+func (zwp *ZookeeperWorkerIdProvider) getConn() (*zk.Conn, <-chan zk.Event, error) {
+	conn, events, err := zk.Connect(zwp.hosts, time.Second*5)
+	if err != nil {
+		return nil, nil, fmt.Errorf("connect to zookeeper failed. %s, reason: %w", zwp.connStr, err)
+	}
+	if zwp.auth != "" {
+		err = conn.AddAuth(zwp.authScheme, []byte(zwp.auth))
+		if err != nil {
+			conn.Close()
+			return nil, nil, fmt.Errorf("zookeeper authentication failed. scheme: %s, reason: %w", zwp.authScheme, err)
+		}
+	}
+	return conn, events, nil
+}
+
+func (zwp *ZookeeperWorkerIdProvider) getRootNodePath(appName string) string {
+	return zwp.chroot + fmt.Sprintf(rootNodePathTemplate, appName)
+}
+
+func (zwp *ZookeeperWorkerIdProvider) getSlotNodePath(appName string) string {
+	return zwp.chroot + fmt.Sprintf(slotNodePathTemplate, appName)
+}
+
+func (zwp *ZookeeperWorkerIdProvider) getHandoffNodePath(appName string) string {
+	return zwp.chroot + fmt.Sprintf(handoffNodePathTemplate, appName)
+}
+
+func (zwp *ZookeeperWorkerIdProvider) getReservedNodePath(appName string) string {
+	return zwp.chroot + fmt.Sprintf(reservedNodePathTemplate, appName)
+}
+
+// Init 初始化
+func (zwp *ZookeeperWorkerIdProvider) Init(ip, port, appName string) error {
+	zwp.ip = ip
+	zwp.port = port
+	// 设置根节点名称
+	zwp.rootNodePath = zwp.getRootNodePath(appName)
+	zwp.slotNodePath = zwp.getSlotNodePath(appName)
+	zwp.handoffNodePath = zwp.getHandoffNodePath(appName)
+	// 设置workerId节点名称
+	zwp.workerIdNodeName = ip + ":" + port
+	// 给默认值
+	zwp.workerId = -1
+	conn, events, err := zwp.getConn()
+	if err != nil {
+		return err
+	}
+	err = zwp.initWorkerIdNode(conn)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	// 保持连接，由IdGenerator定时续约，即上报时间戳。会话断开后自动重连，重新建立会话后立即确认归属
+	zwp.conn = conn
+	zwp.confirmed.Store(true)
+	go zwp.watchSession(events)
+	zwp.leaseState = newLeaseState(zwp.leaseTTL())
+	zwp.extend()
+	return nil
+}
+
+// leaseTTL 租约时长为3个上报间隔，且小于回收时长，保证workerId被回收前已停止发放id
+func (zwp *ZookeeperWorkerIdProvider) leaseTTL() time.Duration {
+	ttl := 3 * zwp.heartbeatInterval
+	if zwp.recycleAfter > 0 && ttl > zwp.recycleAfter/2 {
+		ttl = zwp.recycleAfter / 2
+	}
+	return ttl
+}
+
+// watchSession 处理会话事件，会话断开或过期时立即将归属标记为未确认，IdGenerator停止发放id，重新建立会话后确认workerId节点的归属
+func (zwp *ZookeeperWorkerIdProvider) watchSession(events <-chan zk.Event) {
+	for event := range events {
+		if event.Type != zk.EventSession {
+			continue
+		}
+		switch event.State {
+		case zk.StateDisconnected, zk.StateExpired, zk.StateAuthFailed:
+			if zwp.confirmed.Swap(false) {
+				log.Printf("zookeeper session state is %s, stop issuing ids until ownership of workerId %d is confirmed", event.State.String(), zwp.workerId)
+			}
+		case zk.StateHasSession:
+			if !zwp.confirmed.Load() {
+				// 不能阻塞事件的处理，否则会丢失之后的事件
+				go zwp.reconfirm()
+			}
+		}
+	}
+}
+
+// reconfirm 重新建立会话后确认workerId节点的归属，节点被删除或被其它节点占用时租约丢失
+func (zwp *ZookeeperWorkerIdProvider) reconfirm() {
+	zwp.lock.Lock()
+	defer zwp.lock.Unlock()
+	if zwp.released || zwp.confirmed.Load() {
+		return
+	}
+	if _, _, err := zwp.verifyOwnership(); err != nil {
+		log.Printf("confirm ownership of workerId %d failed, will retry on next renewal. %s", zwp.workerId, err.Error())
+		return
+	}
+	zwp.confirmed.Store(true)
+	log.Printf("zookeeper session re-established, ownership of workerId %d confirmed", zwp.workerId)
+}
+
+// OwnershipConfirmed 会话是否正常且已确认workerId节点的归属
+func (zwp *ZookeeperWorkerIdProvider) OwnershipConfirmed() bool {
+	return zwp.confirmed.Load()
+}
+
+func (zwp *ZookeeperWorkerIdProvider) initWorkerIdNode(conn *zk.Conn) error {
+	// 处理根节点
+	err := dealRootNode(conn, zwp.rootNodePath, zwp.acl)
+	if err != nil {
+		return err
+	}
+	err = dealRootNode(conn, zwp.slotNodePath, zwp.acl)
+	if err != nil {
+		return err
+	}
+	// 处理workerId节点
+	// 找查已存在的节点
+	nodes, err := getWorkerIdNodes(conn, zwp.rootNodePath)
+	if err != nil {
+		return err
+	}
+	var own *workerIdNode
+	others := make([]*workerIdNode, 0, len(nodes))
+	for _, node := range nodes {
+		if own == nil && node.owner == zwp.workerIdNodeName {
+			own = node
+		} else {
+			others = append(others, node)
+		}
+	}
+	// 与其它存活节点进行时钟校验
+	err = zwp.checkClockSkew(others)
+	if err != nil {
+		return err
+	}
+	// 早期按顺序节点序号分配的workerId可能超出范围，启用js-safe后之前分配的workerId也可能超出范围，删除后重新分配
+	if own != nil && own.workerId > allocatableMaxWorkerId() {
+		log.Printf("workerId %d of node %s is out of range [0, %d], reallocate", own.workerId, own.path, allocatableMaxWorkerId())
+		err = deleteWorkerIdNode(conn, zwp.slotNodePath, own)
+		if err != nil {
+			return err
+		}
+		own = nil
+	}
+	// 找到当前节点
+	if own != nil {
+		// 等待时间超过上次运行时上报的时间戳
+		err = waitPastTimestamp(own.timestamp, "workerId node "+own.path)
+		if err != nil {
+			return err
+		}
+		_, err = conn.Set(own.path, marshalPayloadData(zwp.ip, zwp.port, timeGen()), own.version)
+		if err != nil {
+			return err
+		}
+		err = claimSlotNode(conn, zwp.rootNodePath, zwp.slotNodePath, own, zwp.acl)
+		if err == nil {
+			log.Printf("get workerId via exists workerId node. workerId: %d, path: %s", own.workerId, own.path)
+			zwp.workerId = own.workerId
+			zwp.workerIdNodePath = own.path
+			return nil
+		}
+		if !errors.Is(err, errSlotReserved) {
+			return err
+		}
+		// 早期未创建占位节点的workerId已被保留，删除后重新分配
+		log.Printf("workerId %d of node %s is reserved, reallocate", own.workerId, own.path)
+		if err = conn.Delete(own.path, -1); err != nil && err != zk.ErrNoNode {
+			return err
+		}
+	}
+	// 回收长时间未上报时间戳的节点，再分配最小的空闲workerId
+	others, _ = recycleStaleNodes(conn, zwp.slotNodePath, others, zwp.recycleAfter)
+	workerId, nodePath, err := zwp.allocateWorkerId(conn, others)
+	if err != nil {
+		return err
+	}
+	// 等待时间超过上一个占用者释放workerId时的时间戳，失败时删除新建的节点
+	err = zwp.waitHandoff(conn, workerId)
+	if err != nil {
+		if errDelete := deleteWorkerIdNode(conn, zwp.slotNodePath, &workerIdNode{name: path.Base(nodePath), path: nodePath, workerId: workerId, version: -1}); errDelete != nil {
+			log.Printf("delete workerId node %s failed. %s", nodePath, errDelete.Error())
+		}
+		return err
+	}
+	log.Printf("get workerId via new workerId node. workerId: %d, path: %s", workerId, nodePath)
+	zwp.workerId = workerId
+	zwp.workerIdNodePath = nodePath
+	return nil
+}
+
+// waitHandoff 读取交接节点，等待时间超过上一个占用者释放workerId时已发放id的最新时间戳
+func (zwp *ZookeeperWorkerIdProvider) waitHandoff(conn *zk.Conn, workerId int64) error {
+	data, _, err := conn.Get(zwp.handoffNodePath + "/" + strconv.FormatInt(workerId, 10))
+	if err == zk.ErrNoNode {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	payloadData, err := unmarshalPayloadData(data)
+	if err != nil {
+		return err
+	}
+	return waitPastTimestamp(payloadData.Timestamp, fmt.Sprintf("workerId %d previous holder %s:%s", workerId, payloadData.IP, payloadData.Port))
+}
+
+// allocateWorkerId 分配最小的空闲workerId
+//
+// 同时创建占位节点 slotNodePath/workerId 与 workerId节点 rootNodePath/ip:port-workerId，占位节点已存在说明该workerId已被占用
+func (zwp *ZookeeperWorkerIdProvider) allocateWorkerId(conn *zk.Conn, nodes []*workerIdNode) (int64, string, error) {
+	used := make(map[int64]bool, len(nodes))
+	for _, node := range nodes {
+		used[node.workerId] = true
+	}
+	acl := zwp.acl
+	// 占位节点的所有者已不存在时，清理后重试一次
+	retried := false
+	max := allocatableMaxWorkerId()
+	for workerId := int64(0); workerId <= max; workerId++ {
+		if used[workerId] {
+			continue
+		}
+		nodeName := fmt.Sprintf("%s-%010d", zwp.workerIdNodeName, workerId)
+		nodePath := zwp.rootNodePath + "/" + nodeName
+		slotPath := zwp.slotNodePath + "/" + strconv.FormatInt(workerId, 10)
+		_, err := conn.Multi(
+			&zk.CreateRequest{Path: slotPath, Data: []byte(nodeName), Acl: acl, Flags: 0},
+			&zk.CreateRequest{Path: nodePath, Data: marshalPayloadData(zwp.ip, zwp.port, timeGen()), Acl: acl, Flags: 0},
+		)
+		if err == nil {
+			return workerId, nodePath, nil
+		}
+		// 判断是否已被其它节点占用
+		slotData, slotStat, errGet := conn.Get(slotPath)
+		if errGet == zk.ErrNoNode {
+			return 0, "", err
+		}
+		if errGet != nil {
+			return 0, "", errGet
+		}
+		if string(slotData) == reservedSlotData {
+			retried = false
+			continue
+		}
+		ownerExists, _, errExists := conn.Exists(zwp.rootNodePath + "/" + string(slotData))
+		if errExists != nil {
+			return 0, "", errExists
+		}
+		if !ownerExists && !retried {
+			log.Printf("remove orphan slot node %s, owner %s doesn't exist", slotPath, slotData)
+			if errDelete := conn.Delete(slotPath, slotStat.Version); errDelete != nil && errDelete != zk.ErrNoNode && errDelete != zk.ErrBadVersion {
+				return 0, "", errDelete
+			}
+			retried = true
+			workerId--
+			continue
+		}
+		retried = false
+	}
+	return 0, "", fmt.Errorf("no free workerId, all %d workerIds are in use", max+1)
+}
+
+// claimSlotNode 确保workerId节点拥有对应的占位节点，兼容早期未创建占位节点的workerId节点
+func claimSlotNode(conn *zk.Conn, rootNodePath, slotNodePath string, node *workerIdNode, acl []zk.ACL) error {
+	slotPath := slotNodePath + "/" + strconv.FormatInt(node.workerId, 10)
+	_, err := conn.Create(slotPath, []byte(node.name), 0, acl)
+	if err != zk.ErrNodeExists {
+		return err
+	}
+	slotData, slotStat, err := conn.Get(slotPath)
+	if err != nil {
+		return err
+	}
+	if string(slotData) == node.name {
+		return nil
+	}
+	if string(slotData) == reservedSlotData {
+		return fmt.Errorf("workerId %d: %w", node.workerId, errSlotReserved)
+	}
+	// 占位节点的所有者已不存在，则接管
+	ownerExists, _, err := conn.Exists(rootNodePath + "/" + string(slotData))
+	if err != nil {
+		return err
+	}
+	if ownerExists {
+		return fmt.Errorf("workerId %d is claimed by another node %s", node.workerId, slotData)
+	}
+	_, err = conn.Set(slotPath, []byte(node.name), slotStat.Version)
+	return err
+}
+
+// recycleStaleNodes 回收超过olderThan未上报时间戳的节点，返回剩余的节点和被回收的节点
+func recycleStaleNodes(conn *zk.Conn, slotNodePath string, nodes []*workerIdNode, olderThan time.Duration) ([]*workerIdNode, []*workerIdNode) {
+	if olderThan <= 0 {
+		return nodes, nil
+	}
+	remaining := make([]*workerIdNode, 0, len(nodes))
+	recycled := make([]*workerIdNode, 0)
+	curTimestamp := timeGen()
+	for _, node := range nodes {
+		if !node.isStale(curTimestamp, olderThan) {
+			remaining = append(remaining, node)
+			continue
+		}
+		err := deleteWorkerIdNode(conn, slotNodePath, node)
+		if err != nil {
+			log.Printf("recycle workerId %d failed. path: %s, reason: %s", node.workerId, node.path, err.Error())
+			remaining = append(remaining, node)
+			continue
+		}
+		log.Printf("recycle workerId %d. path: %s, last timestamp: %d", node.workerId, node.path, node.timestamp)
+		recycled = append(recycled, node)
+	}
+	return remaining, recycled
+}
+
+// deleteWorkerIdNode 删除workerId节点及其占位节点，节点在读取后被更新过则删除失败
+func deleteWorkerIdNode(conn *zk.Conn, slotNodePath string, node *workerIdNode) error {
+	err := conn.Delete(node.path, node.version)
+	if err != nil && err != zk.ErrNoNode {
+		return err
+	}
+	slotPath := slotNodePath + "/" + strconv.FormatInt(node.workerId, 10)
+	slotData, slotStat, err := conn.Get(slotPath)
+	if err == zk.ErrNoNode {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if string(slotData) != node.name {
+		return nil
+	}
+	err = conn.Delete(slotPath, slotStat.Version)
+	if err != nil && err != zk.ErrNoNode {
+		return err
+	}
+	return nil
+}
+
+// workerIdNode workerId节点，节点名称格式为 ip:port-workerId
+type workerIdNode struct {
+	// 节点名称
+	name string
+	// 节点路径
+	path string
+	// ip:port
+	owner    string
+	workerId int64
+	payload  *PayloadData
+	// 最后上报的时间戳，负载无法解析时取节点的修改时间
+	timestamp int64
+	version   int32
+}
+
+func (node *workerIdNode) isStale(curTimestamp int64, olderThan time.Duration) bool {
+	return olderThan > 0 && curTimestamp-node.timestamp >= olderThan.Milliseconds()
+}
+
+// parseWorkerIdNodeName 解析节点名称，返回 ip:port 和 workerId
+func parseWorkerIdNodeName(name string) (string, int64, error) {
+	i := strings.LastIndex(name, "-")
+	if i < 0 {
+		return "", 0, fmt.Errorf("node name unrecognizable. %s", name)
+	}
+	workerId, err := strconv.ParseInt(name[i+1:], 10, 64)
+	if err != nil {
+		return "", 0, fmt.Errorf("node name unrecognizable. %s", name)
+	}
+	return name[:i], workerId, nil
+}
+
+// getWorkerIdNodes 获取根节点下的所有workerId节点
+func getWorkerIdNodes(conn *zk.Conn, rootNodePath string) ([]*workerIdNode, error) {
+	children, _, err := conn.Children(rootNodePath)
+	if err != nil {
+		return nil, fmt.Errorf("get children failed. reason: %w", err)
+	}
+	nodes := make([]*workerIdNode, 0, len(children))
+	for _, child := range children {
+		owner, workerId, err := parseWorkerIdNodeName(child)
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		nodePath := rootNodePath + "/" + child
+		data, stat, err := conn.Get(nodePath)
+		if err == zk.ErrNoNode {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		node := &workerIdNode{
+			name:      child,
+			path:      nodePath,
+			owner:     owner,
+			workerId:  workerId,
+			timestamp: stat.Mtime,
+			version:   stat.Version,
+		}
+		if payloadData, err := unmarshalPayloadData(data); err == nil {
+			node.payload = payloadData
+			node.timestamp = payloadData.Timestamp
+		}
+		nodes = append(nodes, node)
+	}
+	return nodes, nil
+}
+
+// checkClockSkew 计算其它存活节点时间戳的平均值，本机时间与之偏差过大时，拒绝启动
+//
+// 存活节点指时间戳与最新时间戳相差不超过3个上报间隔的节点，不依赖本机时间判断，避免本机时钟错误影响结果
+func (zwp *ZookeeperWorkerIdProvider) checkClockSkew(nodes []*workerIdNode) error {
+	if zwp.maxClockSkew <= 0 || len(nodes) == 0 {
+		return nil
+	}
+	var maxTimestamp int64 = 0
+	for _, node := range nodes {
+		if node.timestamp > maxTimestamp {
+			maxTimestamp = node.timestamp
+		}
+	}
+	liveWindow := 3 * zwp.heartbeatInterval.Milliseconds()
+	var sum, count int64 = 0, 0
+	for _, node := range nodes {
+		if maxTimestamp-node.timestamp <= liveWindow {
+			sum += node.timestamp
+			count++
+		}
+	}
+	if count == 0 {
+		return nil
+	}
+	avg := sum / count
+	curTimestamp := timeGen()
+	skew := curTimestamp - avg
+	if skew < 0 {
+		skew = -skew
+	}
+	if skew > zwp.maxClockSkew {
+		return fmt.Errorf("init timestamp check error, this node time %d differs from the average time %d of %d live nodes by %dms, max allowed %dms", curTimestamp, avg, count, skew, zwp.maxClockSkew)
+	}
+	log.Printf("init timestamp check passed. average time of %d live nodes: %d, this node time: %d", count, avg, curTimestamp)
+	return nil
+}
+
+// ListAllocations 列出应用的workerId分配记录
+func (zwp *ZookeeperWorkerIdProvider) ListAllocations(appName string) ([]WorkerIdAllocation, error) {
+	conn, _, err := zwp.getConn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	nodes, err := getWorkerIdNodes(conn, zwp.getRootNodePath(appName))
+	if errors.Is(err, zk.ErrNoNode) {
+		return []WorkerIdAllocation{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return zwp.toAllocations(nodes), nil
+}
+
+// WorkerIdOwners 使用该workerId且仍在上报时间戳的实例，实现WorkerIdRegistry
+func (zwp *ZookeeperWorkerIdProvider) WorkerIdOwners(appName string, workerId int64) ([]string, error) {
+	allocations, err := zwp.ListAllocations(appName)
+	if err != nil {
+		return nil, err
+	}
+	owners := make([]string, 0)
+	for _, allocation := range allocations {
+		if allocation.WorkerId == workerId && !allocation.Stale {
+			owners = append(owners, allocation.Owner)
+		}
+	}
+	return owners, nil
+}
+
+// ExpireStaleAllocations 回收超过olderThan未上报时间戳的workerId，olderThan小于等于0时，使用配置的回收时间
+func (zwp *ZookeeperWorkerIdProvider) ExpireStaleAllocations(appName string, olderThan time.Duration) ([]WorkerIdAllocation, error) {
+	if olderThan <= 0 {
+		olderThan = zwp.recycleAfter
+	}
+	if olderThan <= 0 {
+		return nil, errors.New("workerId recycling is disabled, please specify the expiration time")
+	}
+	conn, _, err := zwp.getConn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	nodes, err := getWorkerIdNodes(conn, zwp.getRootNodePath(appName))
+	if errors.Is(err, zk.ErrNoNode) {
+		return []WorkerIdAllocation{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	_, recycled := recycleStaleNodes(conn, zwp.getSlotNodePath(appName), nodes, olderThan)
+	return zwp.toAllocations(recycled), nil
+}
+
+// ReleaseAllocation 删除workerId节点及其占位节点，force为false时仅删除长时间未上报时间戳的节点
+func (zwp *ZookeeperWorkerIdProvider) ReleaseAllocation(appName string, workerId int64, force bool) (WorkerIdAllocation, error) {
+	conn, _, err := zwp.getConn()
+	if err != nil {
+		return WorkerIdAllocation{}, err
+	}
+	defer conn.Close()
+	nodes, err := getWorkerIdNodes(conn, zwp.getRootNodePath(appName))
+	if err != nil && !errors.Is(err, zk.ErrNoNode) {
+		return WorkerIdAllocation{}, err
+	}
+	var target *workerIdNode
+	for _, node := range nodes {
+		if node.workerId == workerId {
+			target = node
+			break
+		}
+	}
+	if target == nil {
+		return WorkerIdAllocation{}, fmt.Errorf("%w: workerId %d", ErrAllocationNotFound, workerId)
+	}
+	allocation := zwp.toAllocations([]*workerIdNode{target})[0]
+	if !force && !allocation.Stale {
+		return WorkerIdAllocation{}, fmt.Errorf("%w: workerId %d, last timestamp %d", ErrAllocationNotStale, workerId, target.timestamp)
+	}
+	if err = deleteWorkerIdNode(conn, zwp.getSlotNodePath(appName), target); err != nil {
+		return WorkerIdAllocation{}, fmt.Errorf("release workerId %d failed. path: %s, reason: %w", workerId, target.path, err)
+	}
+	log.Printf("release workerId %d. path: %s, last timestamp: %d", workerId, target.path, target.timestamp)
+	return allocation, nil
+}
+
+// ReserveWorkerId 同时创建保留节点和数据为 #reserved 的占位节点，已保留时更新原因
+func (zwp *ZookeeperWorkerIdProvider) ReserveWorkerId(appName string, workerId int64, reason string) error {
+	conn, _, err := zwp.getConn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	slotNodePath := zwp.getSlotNodePath(appName)
+	reservedNodePath := zwp.getReservedNodePath(appName)
+	if err = dealRootNode(conn, slotNodePath, zwp.acl); err != nil {
+		return err
+	}
+	if err = dealRootNode(conn, reservedNodePath, zwp.acl); err != nil {
+		return err
+	}
+	slotPath := slotNodePath + "/" + strconv.FormatInt(workerId, 10)
+	reservedPath := reservedNodePath + "/" + strconv.FormatInt(workerId, 10)
+	data, _ := json.Marshal(WorkerIdReservation{WorkerId: workerId, Reason: reason, Timestamp: timeGen()})
+	// 占位节点的所有者已不存在时，清理后重试一次
+	for retried := false; ; retried = true {
+		_, err = conn.Multi(
+			&zk.CreateRequest{Path: slotPath, Data: []byte(reservedSlotData), Acl: zwp.acl, Flags: 0},
+			&zk.CreateRequest{Path: reservedPath, Data: data, Acl: zwp.acl, Flags: 0},
+		)
+		if err == nil {
+			log.Printf("reserve workerId %d. path: %s, reason: %s", workerId, reservedPath, reason)
+			return nil
+		}
+		slotData, slotStat, errGet := conn.Get(slotPath)
+		if errGet == zk.ErrNoNode {
+			return err
+		}
+		if errGet != nil {
+			return errGet
+		}
+		if string(slotData) == reservedSlotData {
+			_, err = conn.Set(reservedPath, data, -1)
+			if err == zk.ErrNoNode {
+				_, err = conn.Create(reservedPath, data, 0, zwp.acl)
+			}
+			return err
+		}
+		ownerExists, _, errExists := conn.Exists(zwp.getRootNodePath(appName) + "/" + string(slotData))
+		if errExists != nil {
+			return errExists
+		}
+		if ownerExists || retried {
+			return fmt.Errorf("%w: workerId %d is claimed by %s", ErrWorkerIdInUse, workerId, slotData)
+		}
+		log.Printf("remove orphan slot node %s, owner %s doesn't exist", slotPath, slotData)
+		if errDelete := conn.Delete(slotPath, slotStat.Version); errDelete != nil && errDelete != zk.ErrNoNode && errDelete != zk.ErrBadVersion {
+			return errDelete
+		}
+	}
+}
+
+// UnreserveWorkerId 删除保留节点及其占位节点
+func (zwp *ZookeeperWorkerIdProvider) UnreserveWorkerId(appName string, workerId int64) error {
+	conn, _, err := zwp.getConn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	reservedPath := zwp.getReservedNodePath(appName) + "/" + strconv.FormatInt(workerId, 10)
+	slotPath := zwp.getSlotNodePath(appName) + "/" + strconv.FormatInt(workerId, 10)
+	_, reservedStat, err := conn.Get(reservedPath)
+	if err == zk.ErrNoNode {
+		return fmt.Errorf("%w: workerId %d", ErrWorkerIdNotReserved, workerId)
+	}
+	if err != nil {
+		return err
+	}
+	ops := []interface{}{&zk.DeleteRequest{Path: reservedPath, Version: reservedStat.Version}}
+	slotData, slotStat, err := conn.Get(slotPath)
+	if err != nil && err != zk.ErrNoNode {
+		return err
+	}
+	if err == nil && string(slotData) == reservedSlotData {
+		ops = append(ops, &zk.DeleteRequest{Path: slotPath, Version: slotStat.Version})
+	}
+	if _, err = conn.Multi(ops...); err != nil {
+		return err
+	}
+	log.Printf("unreserve workerId %d. path: %s", workerId, reservedPath)
+	return nil
+}
+
+// ListReservations 列出保留节点
+func (zwp *ZookeeperWorkerIdProvider) ListReservations(appName string) ([]WorkerIdReservation, error) {
+	conn, _, err := zwp.getConn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	reservedNodePath := zwp.getReservedNodePath(appName)
+	children, _, err := conn.Children(reservedNodePath)
+	if err == zk.ErrNoNode {
+		return []WorkerIdReservation{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	reservations := make([]WorkerIdReservation, 0, len(children))
+	for _, child := range children {
+		workerId, err := strconv.ParseInt(child, 10, 64)
+		if err != nil {
+			log.Printf("node name unrecognizable. %s", child)
+			continue
+		}
+		data, stat, err := conn.Get(reservedNodePath + "/" + child)
+		if err == zk.ErrNoNode {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		reservation := WorkerIdReservation{WorkerId: workerId, Timestamp: stat.Ctime}
+		if err = json.Unmarshal(data, &reservation); err != nil {
+			log.Printf("unmarshal reservation of workerId %d failed. %s", workerId, data)
+		}
+		reservation.WorkerId = workerId
+		reservations = append(reservations, reservation)
+	}
+	sort.Slice(reservations, func(i, j int) bool {
+		return reservations[i].WorkerId < reservations[j].WorkerId
+	})
+	return reservations, nil
+}
+
+func (zwp *ZookeeperWorkerIdProvider) toAllocations(nodes []*workerIdNode) []WorkerIdAllocation {
+	curTimestamp := timeGen()
+	allocations := make([]WorkerIdAllocation, 0, len(nodes))
+	for _, node := range nodes {
+		allocation := WorkerIdAllocation{
+			WorkerId:  node.workerId,
+			Owner:     node.owner,
+			Path:      node.path,
+			Timestamp: node.timestamp,
+			Stale:     node.isStale(curTimestamp, zwp.recycleAfter),
+		}
+		allocations = append(allocations, allocation)
+	}
+	sort.Slice(allocations, func(i, j int) bool {
+		return allocations[i].WorkerId < allocations[j].WorkerId
+	})
+	return allocations
+}
+
+// Lease workerId节点的租约
+func (zwp *ZookeeperWorkerIdProvider) Lease() (Lease, error) {
+	if zwp.leaseState == nil {
+		return nil, errors.New("zookeeper worker id provider is not initialized")
+	}
+	return zwp, nil
+}
+
+// WorkerId 租约对应的workerId
+func (zwp *ZookeeperWorkerIdProvider) WorkerId() int64 {
+	return zwp.workerId
+}
+
+// RenewInterval 续约间隔，即上报时间戳的间隔
+func (zwp *ZookeeperWorkerIdProvider) RenewInterval() time.Duration {
+	return zwp.heartbeatInterval
+}
+
+// Renew 确认workerId节点的归属，并将时间戳写入workerId节点，时间戳不小于已发放id的最新时间戳
+//
+// workerId节点被删除（如被回收）或被其它节点占用时，租约丢失
+func (zwp *ZookeeperWorkerIdProvider) Renew(issuedTimestamp int64) (time.Time, error) {
+	zwp.lock.Lock()
+	defer zwp.lock.Unlock()
+	if zwp.released {
+		return time.Time{}, errors.New("lease of workerId node is released")
+	}
+	err := zwp.updateNewData(issuedTimestamp)
+	if err != nil {
+		return time.Time{}, err
+	}
+	zwp.confirmed.Store(true)
+	return zwp.extend(), nil
+}
+
+// Release 将最后的时间戳写入交接节点，并删除workerId节点及其占位节点，workerId可以分配给其它实例，e.g. 滚动更新时的新实例
+//
+// 新的占用者等待时间超过交接节点中的时间戳后再发放id
+func (zwp *ZookeeperWorkerIdProvider) Release(issuedTimestamp int64) error {
+	zwp.lock.Lock()
+	defer zwp.lock.Unlock()
+	if zwp.released {
+		return nil
+	}
+	zwp.released = true
+	timestamp := latestTimestamp(issuedTimestamp)
+	version, slotVersion, err := zwp.verifyOwnership()
+	if err != nil {
+		return err
+	}
+	err = dealRootNode(zwp.conn, zwp.handoffNodePath, zwp.acl)
+	if err != nil {
+		return err
+	}
+	handoffPath := zwp.handoffNodePath + "/" + strconv.FormatInt(zwp.workerId, 10)
+	data := marshalPayloadData(zwp.ip, zwp.port, timestamp)
+	var handoffOp interface{} = &zk.CreateRequest{Path: handoffPath, Data: data, Acl: zwp.acl, Flags: 0}
+	exists, _, err := zwp.conn.Exists(handoffPath)
+	if err != nil {
+		return err
+	}
+	if exists {
+		handoffOp = &zk.SetDataRequest{Path: handoffPath, Data: data, Version: -1}
+	}
+	_, err = zwp.conn.Multi(
+		handoffOp,
+		&zk.DeleteRequest{Path: zwp.workerIdNodePath, Version: version},
+		&zk.DeleteRequest{Path: zwp.slotNodePath + "/" + strconv.FormatInt(zwp.workerId, 10), Version: slotVersion},
+	)
+	if err != nil {
+		return fmt.Errorf("release workerId node failed. path: %s, reason: %s", zwp.workerIdNodePath, err.Error())
+	}
+	log.Printf("release workerId %d. path: %s, last timestamp: %d", zwp.workerId, zwp.workerIdNodePath, timestamp)
+	return nil
+}
+
+// updateNewData 确认归属后将时间戳写入workerId节点，调用前需要加锁
+func (zwp *ZookeeperWorkerIdProvider) updateNewData(issuedTimestamp int64) error {
+	timestamp := latestTimestamp(issuedTimestamp)
+	version, _, err := zwp.verifyOwnership()
+	if err != nil {
+		return err
+	}
+	// 使用读取时的版本号写入，避免覆盖其它节点的写入
+	_, err = zwp.conn.Set(zwp.workerIdNodePath, marshalPayloadData(zwp.ip, zwp.port, timestamp), version)
+	if err == zk.ErrNoNode {
+		zwp.markLost(zwp.workerId, "workerId node doesn't exist")
+	}
+	if err != nil {
+		return fmt.Errorf("update workerId node data failed. path: %s, reason: %s", zwp.workerIdNodePath, err.Error())
+	}
+	return nil
+}
+
+// verifyOwnership 确认workerId节点及其占位节点仍归属于当前应用，返回workerId节点及占位节点的版本号
+//
+// 节点不存在或属于其它节点时，租约丢失
+func (zwp *ZookeeperWorkerIdProvider) verifyOwnership() (int32, int32, error) {
+	if zwp.conn.State() != zk.StateHasSession {
+		zwp.confirmed.Store(false)
+		return 0, 0, fmt.Errorf("zookeeper session state is %s", zwp.conn.State().String())
+	}
+	data, stat, err := zwp.conn.Get(zwp.workerIdNodePath)
+	if err == zk.ErrNoNode {
+		zwp.markLost(zwp.workerId, "workerId node doesn't exist")
+	}
+	if err != nil {
+		return 0, 0, fmt.Errorf("get workerId node failed. path: %s, reason: %s", zwp.workerIdNodePath, err.Error())
+	}
+	payloadData, err := unmarshalPayloadData(data)
+	if err != nil {
+		return 0, 0, err
+	}
+	if payloadData.IP != zwp.ip || payloadData.Port != zwp.port {
+		err = fmt.Errorf("workerId node %s is owned by %s:%s", zwp.workerIdNodePath, payloadData.IP, payloadData.Port)
+		zwp.markLost(zwp.workerId, err.Error())
+		return 0, 0, err
+	}
+	slotPath := zwp.slotNodePath + "/" + strconv.FormatInt(zwp.workerId, 10)
+	slotData, slotStat, err := zwp.conn.Get(slotPath)
+	if err == zk.ErrNoNode {
+		zwp.markLost(zwp.workerId, "slot node doesn't exist")
+	}
+	if err != nil {
+		return 0, 0, fmt.Errorf("get slot node failed. path: %s, reason: %s", slotPath, err.Error())
+	}
+	if string(slotData) != path.Base(zwp.workerIdNodePath) {
+		err = fmt.Errorf("workerId %d is claimed by another node %s", zwp.workerId, slotData)
+		zwp.markLost(zwp.workerId, err.Error())
+		return 0, 0, err
+	}
+	return stat.Version, slotStat.Version, nil
+}
+
+func (zwp *ZookeeperWorkerIdProvider) ProviderName() string {
+	return PROVIDER_ZOOKEEPER
+}
+
+// GetWorkerId 获取id
+func (zwp *ZookeeperWorkerIdProvider) GetWorkerId() (int64, error) {
+	if zwp.workerId < 0 {
+		return 0, fmt.Errorf("worker id is wrong. Please check the provider")
+	}
+	return zwp.workerId, nil
+}
+
+// NewSpare 使用相同配置的ZookeeperWorkerIdProvider，不使用index，IdGenerator以 port#spareN 作为端口初始化，
+// 因此以 ip:port#spareN 的身份创建workerId节点，获得其它workerId
+func (zwp *ZookeeperWorkerIdProvider) NewSpare(index int) (WorkerIdProvider, error) {
+	return NewZookeeperWorkerIdProviderWithConfig(zwp.config)
+}
+
+// Close 未释放租约时先释放，然后关闭连接
+func (zwp *ZookeeperWorkerIdProvider) Close() {
+	if zwp.conn == nil {
+		return
+	}
+	if err := zwp.Release(timeGen()); err != nil {
+		log.Printf("release workerId node failed. %s", err.Error())
+	}
+	zwp.conn.Close()
+	zwp.conn = nil
+}
+
+// parseConnStr 解析连接字符串，支持 host1:2181,host2:2181/chroot 的形式
+func parseConnStr(connStr string) ([]string, string) {
+	chroot := ""
+	if i := strings.Index(connStr, "/"); i >= 0 {
+		chroot = strings.TrimSuffix(connStr[i:], "/")
+		connStr = connStr[:i]
+	}
+	return strings.Split(connStr, ","), chroot
+}
+
+// parseACL 解析ACL，格式为 scheme:id:perms，多个用 , 分隔
+//
+// perms 由 c(create) d(delete) r(read) w(write) a(admin) 组成，e.g. digest:user:xxxxxx:cdrwa,world:anyone:r
+func parseACL(aclStr string) ([]zk.ACL, error) {
+	acl := make([]zk.ACL, 0)
+	if aclStr == "" {
+		return acl, nil
+	}
+	for _, item := range strings.Split(aclStr, ",") {
+		first, last := strings.Index(item, ":"), strings.LastIndex(item, ":")
+		if first < 0 || first == last {
+			return nil, fmt.Errorf("zookeeper acl is wrong. %s, acl must match scheme:id:perms", item)
+		}
+		perms, err := parsePerms(item[last+1:])
+		if err != nil {
+			return nil, err
+		}
+		acl = append(acl, zk.ACL{Perms: perms, Scheme: item[:first], ID: item[first+1 : last]})
+	}
+	return acl, nil
+}
+
+func parsePerms(perms string) (int32, error) {
+	var value int32 = 0
+	for _, p := range perms {
+		switch p {
+		case 'c':
+			value |= zk.PermCreate
+		case 'd':
+			value |= zk.PermDelete
+		case 'r':
+			value |= zk.PermRead
+		case 'w':
+			value |= zk.PermWrite
+		case 'a':
+			value |= zk.PermAdmin
+		default:
+			return 0, fmt.Errorf("zookeeper acl perms is wrong. %s, perms must be composed of c d r w a", perms)
+		}
+	}
+	return value, nil
+}
+
+func dealRootNode(conn *zk.Conn, rootNodePath string, acl []zk.ACL) error {
+	exists, _, err := conn.Exists(rootNodePath)
+	if err != nil {
+		return err
+	}
+	// 不存在，则创建节点
+	//flags有4种取值：
+	//0:永久，除非手动删除
+	//zk.FlagEphemeral = 1:短暂，session断开则改节点也被删除
+	//zk.FlagSequence  = 2:会自动在节点后面添加序号
+	//3:Ephemeral和Sequence，即，短暂且自动添加序号
+	if !exists {
+		errCreate := createNodeAll(conn, rootNodePath, 0, acl)
+		if errCreate != nil {
+			return errCreate
+		}
+		return nil
+	} else {
+		return nil
+	}
+}
+
+// 递归创建，存在则跳过
+//
+// flags有4种取值：
+//
+// 0:永久，除非手动删除
+//
+// zk.FlagEphemeral = 1:短暂，session断开则改节点也被删除
+//
+// zk.FlagSequence  = 2:会自动在节点后面添加序号
+//
+// 3:Ephemeral和Sequence，即，短暂且自动添加序号
+func createNodeAll(conn *zk.Conn, path string, flags int32, acl []zk.ACL) error {
+	paths := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	if len(paths) < 1 {
+		return fmt.Errorf("path is error, %s", path)
+	}
+	curPath := ""
+	// 是否进行是否存在的检测
+	checkExists := true
+	nodeExists := false
+	var err error
+	for i := 0; i < len(paths); i++ {
+		curPath += "/" + paths[i]
+		if checkExists {
+			nodeExists, _, err = conn.Exists(curPath)
+			if err != nil {
+				return err
+			}
+		}
+		// 如果不存在，则创建
+		if !nodeExists {
+			// 某父节点一旦不存在，之后，就不进行是否存在的检测
+			checkExists = false
+			_, errCreate := conn.Create(curPath, nil, flags, acl)
+			if errCreate != nil {
+				return errCreate
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package snowflake
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/go-zookeeper/zk"
+)
+
+func TestZookeeperSessionLossFencesGeneratorImmediately(t *testing.T) {
+	for _, state := range []zk.State{zk.StateExpired, zk.StateDisconnected, zk.StateAuthFailed} {
+		zwp := &ZookeeperWorkerIdProvider{workerId: 3}
+		zwp.confirmed.Store(true)
+		sig := &IdGenerator{ownershipVerifier: zwp}
+		sig.initFlag.Store(true)
+		if err := sig.Ready(); err != nil {
+			t.Fatalf("%s: generator should be ready before session loss, got %v", state, err)
+		}
+		events := make(chan zk.Event)
+		go zwp.watchSession(events)
+		events <- zk.Event{Type: zk.EventSession, State: state}
+		// 事件按顺序处理，下一个事件被接收时上一个事件已处理完
+		events <- zk.Event{Type: zk.EventNodeDataChanged}
+		if err := sig.Ready(); !errors.Is(err, ErrOwnershipUnconfirmed) {
+			t.Fatalf("%s: got %v, want %v", state, err, ErrOwnershipUnconfirmed)
+		}
+		if _, err := sig.GetId(); !errors.Is(err, ErrOwnershipUnconfirmed) {
+			t.Fatalf("%s: ids should not be issued after session loss, got %v", state, err)
+		}
+		// 已停止发放id时，重新连接但未建立会话不会恢复
+		events <- zk.Event{Type: zk.EventSession, State: zk.StateConnected}
+		events <- zk.Event{Type: zk.EventNodeDataChanged}
+		if zwp.OwnershipConfirmed() {
+			t.Fatalf("%s: ownership should stay unconfirmed until re-verified", state)
+		}
+		close(events)
+	}
+}
@@ -1,6 +1,11 @@
 package snowflake
 
-import "sfgo/common/tools"
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
 
 const (
 	PROVIDER_HOSTNAME   = "hostname"
@@ -8,33 +13,146 @@ const (
 	PROVIDER_ZOOKEEPER  = "zookeeper"
 )
 
-// WOKER_ID_PROVIDER 工作节点ID提供者可以为  hostName envirnment zookeeper
+type WorkerIdProvider interface {
+	Init(ip, port, appName string) error
+	GetWorkerId() (int64, error)
+}
+
+// WorkerIdAllocation workerId分配记录
+type WorkerIdAllocation struct {
+	WorkerId int64 `json:"workerId"`
+	// 占用者，格式为 ip:port
+	Owner string `json:"owner"`
+	// 分配记录的存储位置
+	Path string `json:"path"`
+	// 最后上报的时间戳
+	Timestamp int64 `json:"timestamp"`
+	// 是否长时间未上报时间戳，可被回收
+	Stale bool `json:"stale"`
+}
+
+// WorkerIdRecycler 支持查看、回收workerId分配记录的WorkerIdProvider可实现该接口
+type WorkerIdRecycler interface {
+	// ListAllocations 列出应用的workerId分配记录
+	ListAllocations(appName string) ([]WorkerIdAllocation, error)
+	// ExpireStaleAllocations 回收超过olderThan未上报时间戳的workerId，返回被回收的记录
+	ExpireStaleAllocations(appName string, olderThan time.Duration) ([]WorkerIdAllocation, error)
+}
+
+var (
+	// ErrAllocationNotFound workerId未被分配
+	ErrAllocationNotFound = errors.New("worker id is not allocated")
+	// ErrAllocationNotStale workerId的占用者仍在上报时间戳，需要强制释放
+	ErrAllocationNotStale = errors.New("worker id is not stale")
+	// ErrWorkerIdInUse workerId已被占用，释放后才能保留
+	ErrWorkerIdInUse = errors.New("worker id is in use")
+	// ErrWorkerIdNotReserved workerId未被保留
+	ErrWorkerIdNotReserved = errors.New("worker id is not reserved")
+)
+
+// WorkerIdReservation workerId保留记录，保留的workerId不会被分配
+type WorkerIdReservation struct {
+	WorkerId int64  `json:"workerId"`
+	Reason   string `json:"reason"`
+	// 保留时的时间戳
+	Timestamp int64 `json:"timestamp"`
+}
+
+// WorkerIdAdmin 支持释放、保留workerId的WorkerIdProvider可实现该接口，用于管理接口
+type WorkerIdAdmin interface {
+	WorkerIdRecycler
+	// ReleaseAllocation 释放workerId，force为false时仅释放可被回收的workerId，返回被释放的记录
+	//
+	// 占用者仍在运行时，其租约将丢失并停止发放id
+	ReleaseAllocation(appName string, workerId int64, force bool) (WorkerIdAllocation, error)
+	// ReserveWorkerId 保留workerId，workerId已被占用时返回ErrWorkerIdInUse
+	ReserveWorkerId(appName string, workerId int64, reason string) error
+	// UnreserveWorkerId 取消保留workerId
+	UnreserveWorkerId(appName string, workerId int64) error
+	// ListReservations 列出保留的workerId
+	ListReservations(appName string) ([]WorkerIdReservation, error)
+}
+
+// OwnershipVerifier 可确认workerId归属的WorkerIdProvider可实现该接口，归属未确认时，IdGenerator将停止发放id
 //
-// 默认值为 envirnment
+// 新的WorkerIdProvider建议实现LeaseProvider，由IdGenerator统一续约
+type OwnershipVerifier interface {
+	OwnershipConfirmed() bool
+}
+
+// ErrLeaseNotSupported WorkerIdProvider不以租约方式提供workerId
+var ErrLeaseNotSupported = errors.New("worker id provider doesn't support lease")
+
+// Lease workerId租约
 //
-// 如果WOKER_ID_PROVIDER=hostname，则要求系统hostname格式为 xxxx-1 xxxx-2等，在k8s里采用StatefulSet部署即可
-var workerIdProvider = tools.GetEnv("WOKER_ID_PROVIDER", "envirnment")
+// IdGenerator每隔RenewInterval续约一次，续约时上报已发放id的最新时间戳。到期前未能续约，或者租约丢失时，IdGenerator停止发放id
+type Lease interface {
+	// WorkerId 租约对应的workerId
+	WorkerId() int64
+	// Expiry 到期时间，零值表示不会到期
+	Expiry() time.Time
+	// RenewInterval 续约间隔
+	RenewInterval() time.Duration
+	// Renew 续约，issuedTimestamp为已发放id的最新时间戳，返回新的到期时间
+	Renew(issuedTimestamp int64) (time.Time, error)
+	// Release 上报最后的时间戳并释放租约，释放后不能再续约
+	Release(issuedTimestamp int64) error
+	// Lost 租约丢失时关闭，e.g. workerId被回收或被其它实例占用，丢失后不能恢复
+	Lost() <-chan struct{}
+}
 
-// 如果WOKER_ID_PROVIDER=envirnment，则需要在系统环境变量里设置下面的环境变量值
-var workerIdProviderEnvName = "SNOWFLAKE_WORKER_ID"
+// LeaseProvider 以租约方式提供workerId的WorkerIdProvider可实现该接口
+type LeaseProvider interface {
+	// Lease Init成功后获取workerId的租约，不支持时返回ErrLeaseNotSupported
+	Lease() (Lease, error)
+}
 
-// 如果WOKER_ID_PROVIDER=zookeeper，则需要提供Zookeeper的连接字符串
-var zkConnString = tools.GetEnv("ZOOKEEPER_CONN_STRING", "localhost:2181")
+// WorkerIdRanger 可声明workerId取值范围的WorkerIdProvider可实现该接口，用于组合使用时判断取值范围是否重叠
+type WorkerIdRanger interface {
+	// WorkerIdRange 返回workerId的最小值和最大值
+	WorkerIdRange() (int64, int64)
+}
 
-type WorkerIdProvider interface {
-	Init(ip, port, appName string) error
-	GetWorkerId() (int64, error)
+// ProviderNamer WorkerIdProvider的名称，用于日志、监控指标等
+type ProviderNamer interface {
+	ProviderName() string
+}
+
+// IssuedTimestampAware 需要获取已发放id最新时间戳的WorkerIdProvider可实现该接口
+type IssuedTimestampAware interface {
+	SetIssuedTimestampFunc(fn func() int64)
+}
+
+// SpareWorkerIdProvider 可以为同一实例额外提供备用workerId的WorkerIdProvider可实现该接口，时钟回拨时IdGenerator临时使用备用workerId
+type SpareWorkerIdProvider interface {
+	// NewSpare 在Init成功后创建第index（从1开始）个备用WorkerIdProvider，IdGenerator以 port#spareN 的身份初始化它，
+	// 它提供的workerId必须与当前workerId及其它备用workerId不同，支持租约时与当前workerId一起续约、释放
+	NewSpare(index int) (WorkerIdProvider, error)
+}
+
+// GetWorkerProvider 根据配置的 WOKER_ID_PROVIDER 创建WorkerIdProvider，名称无效时返回error，并列出有效的名称
+//
+// WOKER_ID_PROVIDER 可以为 hostname envirnment zookeeper 等，以及通过RegisterProvider注册的其它名称。
+// 多个用 , 分隔时，按顺序尝试，使用第一个成功提供workerId的，e.g. zookeeper,hostname,envirnment
+func GetWorkerProvider() (WorkerIdProvider, error) {
+	if strings.Contains(conf.WorkerIdProvider, ",") {
+		return NewChainedWorkerIdProvider(conf.ProviderNameList(), conf.WorkerIdProviderAllowOverlap)
+	}
+	return NewWorkerProvider(strings.TrimSpace(conf.WorkerIdProvider))
+}
+
+// GetProviderName 获取WorkerIdProvider的名称
+func GetProviderName(provider WorkerIdProvider) string {
+	if n, ok := provider.(ProviderNamer); ok {
+		return n.ProviderName()
+	}
+	return fmt.Sprintf("%T", provider)
 }
 
-func GetWorkerProvider() WorkerIdProvider {
-	var wokerIdProvider WorkerIdProvider
-	switch workerIdProvider {
-	case PROVIDER_ENVIRNMENT:
-		wokerIdProvider = NewEnvWorkerIdProvider(workerIdProviderEnvName)
-	case PROVIDER_ZOOKEEPER:
-		wokerIdProvider = NewZookeeperWorkerIdProvider(zkConnString)
-	default:
-		wokerIdProvider = NewHostNameWokerIdProvider()
+// getProviderTimeout 组合多个WorkerIdProvider时，WorkerIdProvider获取workerId的超时时间，单位ms
+func getProviderTimeout(name string) int64 {
+	if timeout, ok := conf.WorkerIdProviderTimeouts[name]; ok {
+		return timeout
 	}
-	return wokerIdProvider
+	return conf.WorkerIdProviderTimeout
 }
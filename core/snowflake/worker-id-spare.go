@@ -0,0 +1,116 @@
+package snowflake
+
+import (
+	"errors"
+	"fmt"
+	"log"
+)
+
+/*
+ * 备用workerId。时钟回拨超过5ms时，workerId在时间超过回拨前的时间戳之前无法发放id，
+ * 实例可以额外占用少量备用workerId，回拨期间使用备用workerId继续发放id，时间超过回拨前的时间戳后换回workerId
+ */
+
+// spareWorkerId 备用workerId及提供它的WorkerIdProvider
+type spareWorkerId struct {
+	workerId int64
+	provider WorkerIdProvider
+	// WorkerIdProvider以租约方式提供workerId时不为nil，租约无效时不能使用该备用workerId
+	leaseKeeper *leaseKeeper
+}
+
+// claimSpares 获取备用workerId，获取失败时不影响启动，只是时钟回拨时仍会停止发放id
+func (sig *IdGenerator) claimSpares() {
+	// SPARE_WORKER_ID_COUNT 需要WorkerIdProvider支持，e.g. zookeeper raft filelock envirnment
+	if conf.SpareWorkerIdCount <= 0 {
+		return
+	}
+	sp, ok := sig.workerIdProvider.(SpareWorkerIdProvider)
+	// workerId来自本地文件时，WorkerIdProvider未初始化，无法分配备用workerId
+	if !ok || !sig.workerIdHolder.FromProvider() {
+		log.Printf("worker id provider %s can't provide spare worker ids, source: %s", sig.providerName, sig.source)
+		return
+	}
+	used := map[int64]bool{sig.workerId: true}
+	for index := 1; index <= int(conf.SpareWorkerIdCount); index++ {
+		spare, err := sig.claimSpare(sp, index, used)
+		if err != nil {
+			log.Printf("claim spare workerId #%d failed. %s", index, err.Error())
+			break
+		}
+		used[spare.workerId] = true
+		sig.spares = append(sig.spares, spare)
+		var available func() error
+		if spare.leaseKeeper != nil {
+			available = spare.leaseKeeper.Valid
+		}
+		// 备用workerId的上一个占用者已在Init时等待过，仅使用当前时间之后的时间戳
+		sl.AddSpare(spare.workerId, timeGen(), available)
+		log.Printf("claim spare workerId %d", spare.workerId)
+	}
+	spareWorkerIds.Set(float64(len(sig.spares)))
+}
+
+// claimSpare 以 port#spareN 的身份初始化第index个备用WorkerIdProvider，workerId不能与used中的重复
+func (sig *IdGenerator) claimSpare(sp SpareWorkerIdProvider, index int, used map[int64]bool) (*spareWorkerId, error) {
+	provider, err := sp.NewSpare(index)
+	if err != nil {
+		return nil, err
+	}
+	err = provider.Init(sig.ip, fmt.Sprintf("%s#spare%d", sig.port, index), sig.appName)
+	if err != nil {
+		closeProvider(provider)
+		return nil, err
+	}
+	workerId, err := provider.GetWorkerId()
+	if err == nil && (workerId < 0 || workerId > MaxWorkerId()) {
+		err = fmt.Errorf("spare workerId %d must between 0 and %d", workerId, MaxWorkerId())
+	}
+	if err == nil && used[workerId] {
+		err = fmt.Errorf("spare workerId %d is already used by this instance", workerId)
+	}
+	if err != nil {
+		closeProvider(provider)
+		return nil, err
+	}
+	spare := &spareWorkerId{workerId: workerId, provider: provider}
+	if lp, ok := provider.(LeaseProvider); ok {
+		lease, err := lp.Lease()
+		if err != nil && !errors.Is(err, ErrLeaseNotSupported) {
+			closeProvider(provider)
+			return nil, fmt.Errorf("get lease of spare workerId %d failed. %s", workerId, err.Error())
+		}
+		if err == nil {
+			// 备用workerId仅在时间早于已发放id的最新时间戳时使用，上报该时间戳即可
+			spare.leaseKeeper = newLeaseKeeper(lease, sl.LastTimestamp)
+			spare.leaseKeeper.spare = true
+			spare.leaseKeeper.start()
+		}
+	}
+	return spare, nil
+}
+
+// releaseSpares 释放备用workerId的租约，调用前需要已停止发放id
+func (sig *IdGenerator) releaseSpares() {
+	for _, spare := range sig.spares {
+		if spare.leaseKeeper != nil {
+			spare.leaseKeeper.release()
+		}
+	}
+}
+
+// closeSpares 关闭备用WorkerIdProvider
+func (sig *IdGenerator) closeSpares() {
+	for _, spare := range sig.spares {
+		closeProvider(spare.provider)
+	}
+}
+
+// spareWorkerIdList 备用workerId
+func (sig *IdGenerator) spareWorkerIdList() []int64 {
+	workerIds := make([]int64, 0, len(sig.spares))
+	for _, spare := range sig.spares {
+		workerIds = append(workerIds, spare.workerId)
+	}
+	return workerIds
+}
@@ -0,0 +1,51 @@
+package stringid
+
+import (
+	"encoding/binary"
+	"math/big"
+	"strings"
+)
+
+// KSUID的起始时间戳，单位s
+const ksuidEpoch int64 = 1400000000
+
+// KsuidGenerator 生成KSUID，32位秒级时间戳及128位随机数，同一秒内随机数递增，以base62编码为27个字符
+type KsuidGenerator struct {
+	m *monotonic
+}
+
+// NewKsuidGenerator 创建KSUID生成器
+func NewKsuidGenerator() *KsuidGenerator {
+	return &KsuidGenerator{m: newMonotonic(1000, 128)}
+}
+
+// GetStringId 获取1个KSUID
+func (g *KsuidGenerator) GetStringId() (string, error) {
+	timestamp, random, err := g.m.next()
+	if err != nil {
+		return "", err
+	}
+	var b [20]byte
+	binary.BigEndian.PutUint32(b[:4], uint32(timestamp-ksuidEpoch))
+	copy(b[4:], random)
+	// big.Int的62进制为 0-9a-zA-Z，KSUID为 0-9A-Za-z，交换大小写
+	s := swapCase(new(big.Int).SetBytes(b[:]).Text(62))
+	return strings.Repeat("0", 27-len(s)) + s, nil
+}
+
+// GetStringIds 获取n个KSUID
+func (g *KsuidGenerator) GetStringIds(n int) ([]string, error) {
+	return generateN(n, g.GetStringId)
+}
+
+func swapCase(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z':
+			return r - 'A' + 'a'
+		}
+		return r
+	}, s)
+}
@@ -0,0 +1,36 @@
+package stringid
+
+import (
+	"math/big"
+	"testing"
+	"time"
+)
+
+func TestKsuidFormat(t *testing.T) {
+	before := time.Now().Unix()
+	ids, err := NewKsuidGenerator().GetStringIds(1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	after := time.Now().Unix()
+	for i, id := range ids {
+		if len(id) != 27 {
+			t.Fatalf("got %s, want 27 characters", id)
+		}
+		v, ok := new(big.Int).SetString(swapCase(id), 62)
+		if !ok || v.BitLen() > 160 {
+			t.Fatalf("got %s, want 160 bits encoded in base62", id)
+		}
+		// 高32位为秒级时间戳
+		timestamp := new(big.Int).Rsh(v, 128).Int64() + ksuidEpoch
+		if timestamp < before || timestamp > after+1 {
+			t.Fatalf("got timestamp %d of %s, want between %d and %d", timestamp, id, before, after)
+		}
+		if i > 0 && id <= ids[i-1] {
+			t.Fatalf("got %s after %s", id, ids[i-1])
+		}
+	}
+	if ids, _ = NewKsuidGenerator().GetStringIds(0); len(ids) != 1 {
+		t.Fatalf("got %d ids for n=0, want 1", len(ids))
+	}
+}
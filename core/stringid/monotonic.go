@@ -0,0 +1,82 @@
+package stringid
+
+import (
+	"crypto/rand"
+	"sync"
+	"time"
+)
+
+// monotonic 生成时间戳及随机数，同一时间戳内随机数加1，保证生成的id单调递增
+type monotonic struct {
+	lock sync.Mutex
+	// 时间戳单位的毫秒数
+	unit int64
+	// 随机数的位数
+	bits     int
+	lastTick int64
+	// 随机数，大端序，超出位数的高位为0
+	random []byte
+}
+
+func newMonotonic(unit int64, bits int) *monotonic {
+	return &monotonic{unit: unit, bits: bits, lastTick: -1, random: make([]byte, (bits+7)/8)}
+}
+
+// next 返回时间戳及随机数的副本
+//
+// 时间戳与上一次相同或时钟回拨时，沿用上一次的时间戳并将随机数加1，随机数溢出时使用上一次的时间戳+1
+func (m *monotonic) next() (int64, []byte, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	tick := time.Now().UnixMilli() / m.unit
+	if tick <= m.lastTick {
+		if m.increment() {
+			return m.lastTick, m.copyRandom(), nil
+		}
+		tick = m.lastTick + 1
+	}
+	if _, err := rand.Read(m.random); err != nil {
+		return 0, nil, err
+	}
+	// 清除超出位数的高位，并将最高位置0，为同一时间戳内的递增留出空间
+	m.random[0] &= byte(0xff >> (len(m.random)*8 - m.bits + 1))
+	m.lastTick = tick
+	return tick, m.copyRandom(), nil
+}
+
+// increment 随机数加1，溢出时返回false
+func (m *monotonic) increment() bool {
+	for i := len(m.random) - 1; i >= 0; i-- {
+		m.random[i]++
+		if m.random[i] != 0 {
+			break
+		}
+		if i == 0 {
+			return false
+		}
+	}
+	excess := len(m.random)*8 - m.bits
+	return m.random[0]>>(8-excess) == 0
+}
+
+func (m *monotonic) copyRandom() []byte {
+	random := make([]byte, len(m.random))
+	copy(random, m.random)
+	return random
+}
+
+// generateN 调用n次generate
+func generateN(n int, generate func() (string, error)) ([]string, error) {
+	if n <= 1 {
+		n = 1
+	}
+	ids := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		id, err := generate()
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
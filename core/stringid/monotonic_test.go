@@ -0,0 +1,98 @@
+package stringid
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+// maxRandom 位数为bits的随机数的最大值
+func maxRandom(bits int) []byte {
+	random := bytes.Repeat([]byte{0xff}, (bits+7)/8)
+	random[0] >>= len(random)*8 - bits
+	return random
+}
+
+// assertExcessBitsCleared 超出位数的高位及最高位为0
+func assertExcessBitsCleared(t *testing.T, bits int, random []byte) {
+	t.Helper()
+	excess := len(random)*8 - bits
+	if random[0]>>(7-excess) != 0 {
+		t.Fatalf("%d bits: got random %x, the excess bits and the top bit should be 0", bits, random)
+	}
+}
+
+func TestMonotonicIncreasesWithinTick(t *testing.T) {
+	m := newMonotonic(1, 80)
+	if _, _, err := m.next(); err != nil {
+		t.Fatal(err)
+	}
+	// 时间戳晚于当前时间，之后的id都在同一时间戳内
+	future := time.Now().UnixMilli() + 1000000
+	m.lastTick = future
+	var last []byte
+	for i := 0; i < 1000; i++ {
+		tick, random, err := m.next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tick != future {
+			t.Fatalf("got tick %d, want %d", tick, future)
+		}
+		if last != nil && bytes.Compare(random, last) <= 0 {
+			t.Fatalf("got random %x after %x", random, last)
+		}
+		last = random
+	}
+}
+
+func TestMonotonicIncrementCarriesAcrossBytes(t *testing.T) {
+	m := newMonotonic(1, 80)
+	copy(m.random, []byte{0, 0, 0, 0, 0, 0, 0, 0x01, 0xff, 0xff})
+	if !m.increment() {
+		t.Fatal("increment should not overflow")
+	}
+	if want := []byte{0, 0, 0, 0, 0, 0, 0, 0x02, 0, 0}; !bytes.Equal(m.random, want) {
+		t.Fatalf("got %x, want %x", m.random, want)
+	}
+}
+
+func TestMonotonicOverflowRollsIntoNextTick(t *testing.T) {
+	for _, bits := range []int{74, 80, 128} {
+		m := newMonotonic(1, bits)
+		future := time.Now().UnixMilli() + 1000000
+		m.lastTick = future
+		copy(m.random, maxRandom(bits))
+		tick, random, err := m.next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tick != future+1 {
+			t.Fatalf("%d bits: got tick %d, want %d", bits, tick, future+1)
+		}
+		assertExcessBitsCleared(t, bits, random)
+	}
+}
+
+func TestMonotonicMasksExcessBits(t *testing.T) {
+	for _, bits := range []int{74, 80, 128} {
+		m := newMonotonic(1, bits)
+		if len(m.random) != (bits+7)/8 {
+			t.Fatalf("%d bits: got %d bytes", bits, len(m.random))
+		}
+		for i := 0; i < 100; i++ {
+			// 每次都是新的时间戳，重新生成随机数
+			m.lastTick = -1
+			_, random, err := m.next()
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertExcessBitsCleared(t, bits, random)
+		}
+		// 递增到超出位数时视为溢出
+		copy(m.random, maxRandom(bits))
+		if m.increment() {
+			t.Fatalf("%d bits: increment of the max value should overflow", bits)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package stringid
+
+import "encoding/binary"
+
+// Crockford base32 的字符，不包括 I L O U
+const crockfordAlphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// UlidGenerator 生成ULID，48位毫秒时间戳及80位随机数，同一毫秒内随机数递增，以Crockford base32编码为26个字符
+type UlidGenerator struct {
+	m *monotonic
+}
+
+// NewUlidGenerator 创建ULID生成器
+func NewUlidGenerator() *UlidGenerator {
+	return &UlidGenerator{m: newMonotonic(1, 80)}
+}
+
+// GetStringId 获取1个ULID
+func (g *UlidGenerator) GetStringId() (string, error) {
+	timestamp, random, err := g.m.next()
+	if err != nil {
+		return "", err
+	}
+	var b [16]byte
+	b[0], b[1], b[2], b[3], b[4], b[5] = byte(timestamp>>40), byte(timestamp>>32), byte(timestamp>>24), byte(timestamp>>16), byte(timestamp>>8), byte(timestamp)
+	copy(b[6:], random)
+	// 128位按每5位编码，共26个字符，最高2位补0
+	hi, lo := binary.BigEndian.Uint64(b[:8]), binary.BigEndian.Uint64(b[8:])
+	var s [26]byte
+	for i := len(s) - 1; i >= 0; i-- {
+		s[i] = crockfordAlphabet[lo&31]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(s[:]), nil
+}
+
+// GetStringIds 获取n个ULID
+func (g *UlidGenerator) GetStringIds(n int) ([]string, error) {
+	return generateN(n, g.GetStringId)
+}
@@ -0,0 +1,41 @@
+package stringid
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUlidFormat(t *testing.T) {
+	before := time.Now().UnixMilli()
+	ids, err := NewUlidGenerator().GetStringIds(1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	after := time.Now().UnixMilli()
+	for i, id := range ids {
+		if len(id) != 26 {
+			t.Fatalf("got %s, want 26 characters", id)
+		}
+		var timestamp int64
+		for j, c := range id {
+			v := strings.IndexRune(crockfordAlphabet, c)
+			if v < 0 {
+				t.Fatalf("got %s, %q is not a Crockford base32 character", id, c)
+			}
+			// 前10个字符为48位时间戳，最高2位为0
+			if j < 10 {
+				timestamp = timestamp<<5 | int64(v)
+			}
+		}
+		if id[0] > '7' {
+			t.Fatalf("got %s, the first character must be at most 7", id)
+		}
+		if timestamp < before || timestamp > after+1 {
+			t.Fatalf("got timestamp %d of %s, want between %d and %d", timestamp, id, before, after)
+		}
+		if i > 0 && id <= ids[i-1] {
+			t.Fatalf("got %s after %s", id, ids[i-1])
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package stringid
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+)
+
+// Uuid7Generator 生成UUIDv7（RFC 9562），48位毫秒时间戳，其余74位为随机数，同一毫秒内随机数递增
+type Uuid7Generator struct {
+	m *monotonic
+}
+
+// NewUuid7Generator 创建UUIDv7生成器
+func NewUuid7Generator() *Uuid7Generator {
+	return &Uuid7Generator{m: newMonotonic(1, 74)}
+}
+
+// GetStringId 获取1个UUIDv7，格式为 xxxxxxxx-xxxx-7xxx-xxxx-xxxxxxxxxxxx
+func (g *Uuid7Generator) GetStringId() (string, error) {
+	timestamp, random, err := g.m.next()
+	if err != nil {
+		return "", err
+	}
+	var b [16]byte
+	b[0], b[1], b[2], b[3], b[4], b[5] = byte(timestamp>>40), byte(timestamp>>32), byte(timestamp>>24), byte(timestamp>>16), byte(timestamp>>8), byte(timestamp)
+	// 随机数的高12位为rand_a，低62位为rand_b
+	hi := uint64(random[0])<<8 | uint64(random[1])
+	lo := binary.BigEndian.Uint64(random[2:])
+	randA := hi<<2 | lo>>62
+	randB := lo & (1<<62 - 1)
+	// 版本号 7
+	b[6] = 0x70 | byte(randA>>8)&0x0f
+	b[7] = byte(randA)
+	// 变体 10
+	binary.BigEndian.PutUint64(b[8:], randB|1<<63)
+	var s [36]byte
+	hex.Encode(s[0:8], b[0:4])
+	s[8] = '-'
+	hex.Encode(s[9:13], b[4:6])
+	s[13] = '-'
+	hex.Encode(s[14:18], b[6:8])
+	s[18] = '-'
+	hex.Encode(s[19:23], b[8:10])
+	s[23] = '-'
+	hex.Encode(s[24:], b[10:])
+	return string(s[:]), nil
+}
+
+// GetStringIds 获取n个UUIDv7
+func (g *Uuid7Generator) GetStringIds(n int) ([]string, error) {
+	return generateN(n, g.GetStringId)
+}
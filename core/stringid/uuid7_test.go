@@ -0,0 +1,37 @@
+package stringid
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUuid7Format(t *testing.T) {
+	before := time.Now().UnixMilli()
+	ids, err := NewUuid7Generator().GetStringIds(1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	after := time.Now().UnixMilli()
+	for i, id := range ids {
+		if len(id) != 36 || id[8] != '-' || id[13] != '-' || id[18] != '-' || id[23] != '-' {
+			t.Fatalf("got %s, want the format xxxxxxxx-xxxx-7xxx-xxxx-xxxxxxxxxxxx", id)
+		}
+		// 版本号7，变体为10，即第4段的第1个字符为 8 9 a b
+		if id[14] != '7' || !strings.ContainsRune("89ab", rune(id[19])) {
+			t.Fatalf("got %s, want version 7 and variant 10", id)
+		}
+		timestamp, err := strconv.ParseInt(strings.ReplaceAll(id[:13], "-", ""), 16, 64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// 同一毫秒内随机数溢出时可能使用下一毫秒
+		if timestamp < before || timestamp > after+1 {
+			t.Fatalf("got timestamp %d of %s, want between %d and %d", timestamp, id, before, after)
+		}
+		if i > 0 && id <= ids[i-1] {
+			t.Fatalf("got %s after %s", id, ids[i-1])
+		}
+	}
+}
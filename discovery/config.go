@@ -0,0 +1,72 @@
+package discovery
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Config 服务发现的配置，通过AutoRegister设置
+//
+// 标签 yaml toml 为配置文件中的名称，env 为环境变量名称，desc 为说明
+type Config struct {
+	Enabled   bool   `yaml:"enabled" toml:"enabled" env:"DISCOVERY_ENABLED" desc:"是否启用服务发现"`
+	Namespace string `yaml:"namespace" toml:"namespace" env:"DISCOVERY_NAMESPACE" desc:"往注册中心注册时的命名空间"`
+	SrvAddr   string `yaml:"srvAddr" toml:"srvAddr" env:"DISCOVERY_SRV_ADDR" desc:"注册中心地址，格式为 host:port，多个用 , 分隔"`
+	Host      string `yaml:"host" toml:"host" env:"DISCOVERY_MICROSRV_HOST" desc:"微服务ip，默认自动获取，多个用 , 分隔时随机取1个"`
+	Port      string `yaml:"port" toml:"port" env:"DISCOVERY_MICROSRV_PORT" desc:"微服务端口，为-1时使用SERVER_PORT"`
+	// 健康检查地址可访问时，才会向注册中心注册
+	HealthCheckHost string `yaml:"healthCheckHost" toml:"healthCheckHost" env:"DISCOVERY_MICROSRV_HEALTH_HOST" desc:"微服务健康检查ip，默认为微服务ip"`
+	HealthCheckPort string `yaml:"healthCheckPort" toml:"healthCheckPort" env:"DISCOVERY_MICROSRV_HEALTH_PORT" desc:"微服务健康检查端口，默认为微服务端口"`
+	HealthCheckUrl  string `yaml:"healthCheckUrl" toml:"healthCheckUrl" env:"DISCOVERY_MICROSRV_HEALTH_URL" desc:"微服务健康检查地址，为空时不检查"`
+	LogLevel        string `yaml:"logLevel" toml:"logLevel" env:"DISCOVERY_LOG_LEVEL" desc:"Nacos客户端的日志级别，debug info warn error"`
+	// 仅在 WOKER_ID_PROVIDER=raft 且未配置 RAFT_PEERS 时使用
+	RaftPeers bool `yaml:"raftPeers" toml:"raftPeers" env:"DISCOVERY_RAFT_PEERS" desc:"是否通过Nacos获取raft节点列表"`
+}
+
+// DefaultConfig 默认配置
+func DefaultConfig() Config {
+	return Config{
+		Enabled:        true,
+		Namespace:      "public",
+		SrvAddr:        "localhost:8848",
+		Port:           "-1",
+		HealthCheckUrl: "/health",
+		LogLevel:       "warn",
+	}
+}
+
+// Validate 校验配置，未启用服务发现时不校验，返回所有无效的配置项
+func (c Config) Validate() error {
+	if !c.Enabled {
+		return nil
+	}
+	problems := make([]string, 0)
+	for _, srv := range strings.Split(c.SrvAddr, ",") {
+		if _, port, err := net.SplitHostPort(srv); err != nil || !validPort(port) {
+			problems = append(problems, fmt.Sprintf("DISCOVERY_SRV_ADDR must be host:port separated by , but %q is invalid", srv))
+		}
+	}
+	if c.Port != "" && c.Port != "-1" && !validPort(c.Port) {
+		problems = append(problems, fmt.Sprintf("DISCOVERY_MICROSRV_PORT must between 1 and 65535 or -1, got %q", c.Port))
+	}
+	if c.HealthCheckPort != "" && c.HealthCheckPort != "-1" && !validPort(c.HealthCheckPort) {
+		problems = append(problems, fmt.Sprintf("DISCOVERY_MICROSRV_HEALTH_PORT must between 1 and 65535, got %q", c.HealthCheckPort))
+	}
+	switch c.LogLevel {
+	case "debug", "info", "warn", "error":
+	default:
+		problems = append(problems, fmt.Sprintf("DISCOVERY_LOG_LEVEL must be one of debug, info, warn, error, got %q", c.LogLevel))
+	}
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, "\n"))
+	}
+	return nil
+}
+
+func validPort(port string) bool {
+	p, err := strconv.Atoi(port)
+	return err == nil && p >= 1 && p <= 65535
+}
@@ -8,7 +8,7 @@ import (
 	"os/signal"
 	"sfgo/common/httputil"
 	"sfgo/common/netutil"
-	"sfgo/common/tools"
+	"sfgo/core/snowflake"
 	"sfgo/discovery/shell_gen"
 	"syscall"
 	"time"
@@ -22,35 +22,11 @@ import (
 	"github.com/nacos-group/nacos-sdk-go/vo"
 )
 
-// 是否启用服务发现
-var enabled = tools.GetEnv("DISCOVERY_ENABLED", "true")
+// conf 当前配置，由AutoRegister设置
+var conf = DefaultConfig()
 
-// 往注册中心注册时的命名空间，默认 public
-var namespace = tools.GetEnv("DISCOVERY_NAMESPACE", "public")
-
-// 注册中心hosts，多个用 , 分隔
-var srvAddr = tools.GetEnv("DISCOVERY_SRV_ADDR", "localhost:8848")
-
-// 微服务ip，默认自动获取，多个IP用 , 分隔，将随机取1个
-var microSrvHost = tools.GetEnv("DISCOVERY_MICROSRV_HOST", "")
-
-// 微服务端口，默认为-1，为-1时，将使用 SERVER_PORT
-var microSrvHostPort = tools.GetEnv("DISCOVERY_MICROSRV_PORT", "-1")
-
-// 微服务名称，默认 demo-microsrv
-var microSrvName = tools.GetEnv("DISCOVERY_MICROSRV_NAME", "idgen-microsrv")
-
-// 微服务健康检查IP，可访问时，才会向Nacos注册
-var microSrvHealthCheckHost = tools.GetEnv("DISCOVERY_MICROSRV_HEALTH_HOST", "")
-
-// 微服务健康检查Port，可访问时，才会向Nacos注册
-var microSrvHealthCheckPort = tools.GetEnv("DISCOVERY_MICROSRV_HEALTH_PORT", "")
-
-// 微服务健康检查地址，可访问时，才会向Nacos注册
-var microSrvHealthCheckUrl = tools.GetEnv("DISCOVERY_MICROSRV_HEALTH_URL", "/health")
-
-// 日志级别
-var logLevel = tools.GetEnv("DISCOVERY_LOG_LEVEL", "warn")
+// serviceName 微服务名称
+var serviceName string
 
 type NacosHost struct {
 	IpAddr string
@@ -65,31 +41,31 @@ func chkError(err error) {
 
 func paramInit(serverPort string) {
 	// 如果微服务host无效，则自动获取
-	if microSrvHost == "" {
-		microSrvHost = netutil.GetFirstNonLoopbackIP()
+	if conf.Host == "" {
+		conf.Host = netutil.GetFirstNonLoopbackIP()
 	} else {
 		// 如果微服务host有效，且有多个，则随机取一个
-		hosts := strings.Split(microSrvHost, ",")
+		hosts := strings.Split(conf.Host, ",")
 		hostsLen := len(hosts)
 		rand.Seed(time.Now().UnixNano())
 		if hostsLen > 1 {
-			microSrvHost = hosts[rand.Intn(hostsLen)]
+			conf.Host = hosts[rand.Intn(hostsLen)]
 		}
 	}
-	if microSrvHostPort == "" || microSrvHostPort == "-1" {
-		microSrvHostPort = serverPort
+	if conf.Port == "" || conf.Port == "-1" {
+		conf.Port = serverPort
 	}
-	if microSrvHealthCheckHost == "" {
-		microSrvHealthCheckHost = microSrvHost
+	if conf.HealthCheckHost == "" {
+		conf.HealthCheckHost = conf.Host
 	}
-	if microSrvHealthCheckPort == "" || microSrvHealthCheckPort == "-1" {
-		microSrvHealthCheckPort = microSrvHostPort
+	if conf.HealthCheckPort == "" || conf.HealthCheckPort == "-1" {
+		conf.HealthCheckPort = conf.Port
 	}
 }
 
 func getNacosHost() []constant.ServerConfig {
 	serverConfigs := make([]constant.ServerConfig, 0)
-	srvs := strings.Split(srvAddr, ",")
+	srvs := strings.Split(conf.SrvAddr, ",")
 	for _, srv := range srvs {
 		ipPort := strings.Split(srv, ":")
 		port, _ := strconv.Atoi(ipPort[1])
@@ -106,8 +82,8 @@ func getNacosHost() []constant.ServerConfig {
 func healthCheck() {
 	// 如果健康检查的地址是k8s里的 nodeIP:nodePort，集群里只要有可用Pod，将立即返回200，这可能造成误解，即当前被探测的应用并没有准备好，就注册了
 	// 健康检查地址不为空，因此，要一直等到地址返回200，才进行注册
-	if microSrvHealthCheckUrl != "" {
-		fullUrl := "http://" + microSrvHealthCheckHost + ":" + microSrvHealthCheckPort + microSrvHealthCheckUrl
+	if conf.HealthCheckUrl != "" {
+		fullUrl := "http://" + conf.HealthCheckHost + ":" + conf.HealthCheckPort + conf.HealthCheckUrl
 		for {
 			resp, err := httputil.HttpGet(fullUrl, 5)
 			if err != nil {
@@ -127,52 +103,61 @@ func healthCheck() {
 	}
 }
 
-func Register() {
-	// 健康检查
-	healthCheck()
+// newNamingClient 创建Nacos客户端
+func newNamingClient() (naming_client.INamingClient, error) {
 	clientConfig := constant.ClientConfig{
-		NamespaceId:         namespace, //we can create multiple clients with different namespaceId to support multiple namespace.When namespace is public, fill in the blank string here.
+		NamespaceId:         conf.Namespace, //we can create multiple clients with different namespaceId to support multiple namespace.When namespace is public, fill in the blank string here.
 		TimeoutMs:           10000,
 		NotLoadCacheAtStart: true,
-		LogLevel:            logLevel,
+		LogLevel:            conf.LogLevel,
 	}
 	serverConfigs := getNacosHost()
-	namingClient, err := clients.NewNamingClient(
+	return clients.NewNamingClient(
 		vo.NacosClientParam{
 			ClientConfig:  &clientConfig,
 			ServerConfigs: serverConfigs,
 		},
 	)
+}
+
+func Register() {
+	// 健康检查
+	healthCheck()
+	namingClient, err := newNamingClient()
 	chkError(err)
-	port, err := strconv.Atoi(microSrvHostPort)
+	port, err := strconv.Atoi(conf.Port)
 	chkError(err)
+	metadata := map[string]string{"preserved.register.source": "microSrvName"}
+	if workerId, ok := snowflake.LocalWorkerId(); ok {
+		metadata[workerIdMetadataKey] = strconv.FormatInt(workerId, 10)
+	}
 	registerInstanceParam := vo.RegisterInstanceParam{
-		Ip:          microSrvHost,
+		Ip:          conf.Host,
 		Port:        uint64(port),
-		ServiceName: microSrvName,
+		ServiceName: serviceName,
 		Weight:      1,
 		Enable:      true,
 		Healthy:     true,
 		Ephemeral:   true,
-		Metadata:    map[string]string{"preserved.register.source": "microSrvName"},
+		Metadata:    metadata,
 		ClusterName: "DEFAULT",       // default value is DEFAULT
 		GroupName:   "DEFAULT_GROUP", // default value is DEFAULT_GROUP
 	}
 	success, err := namingClient.RegisterInstance(registerInstanceParam)
 	chkError(err)
 	if success {
-		log.Printf("nacos registry, %v DEFAULT_GROUP %v %v %v register finished", namespace, microSrvName, microSrvHost, microSrvHostPort)
+		log.Printf("nacos registry, %v DEFAULT_GROUP %v %v %v register finished", conf.Namespace, serviceName, conf.Host, conf.Port)
 	} else {
 		log.Println("register failed")
 	}
 	// 生成上下线脚本
 	param := shell_gen.GenOnOfflineShellParma{
-		ServiceName:   microSrvName,
-		IP:            microSrvHost,
-		Port:          microSrvHostPort,
+		ServiceName:   serviceName,
+		IP:            conf.Host,
+		Port:          conf.Port,
 		Scheme:        "http",
-		RegCenterHost: srvAddr,
-		ExtParam:      map[string]string{"namespaceId": namespace},
+		RegCenterHost: conf.SrvAddr,
+		ExtParam:      map[string]string{"namespaceId": conf.Namespace},
 	}
 	// 生成上线脚本
 	shell_gen.GenOnlineShell(param)
@@ -200,14 +185,17 @@ func DeregisterWhenShutdown(namingClient naming_client.INamingClient, regParam v
 	})
 	chkError(err)
 	if success {
-		log.Printf("nacos registry, %v DEFAULT_GROUP %v %v %v deregister finished", namespace, microSrvName, microSrvHost, microSrvHostPort)
+		log.Printf("nacos registry, %v DEFAULT_GROUP %v %v %v deregister finished", conf.Namespace, serviceName, conf.Host, conf.Port)
 	} else {
 		log.Println("deregister failed")
 	}
 }
 
-func AutoRegister(serverPort string) {
-	if enabled != "true" {
+// AutoRegister 启用服务发现时，以appName为微服务名称注册到Nacos，需要在 EnableRaftPeerDiscovery 等之前调用
+func AutoRegister(c Config, appName, serverPort string) {
+	conf = c
+	serviceName = appName
+	if !conf.Enabled {
 		log.Println("discovery is disabled")
 		return
 	}
@@ -0,0 +1,103 @@
+package discovery
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"sfgo/core/snowflake"
+	"strconv"
+	"sync"
+
+	"github.com/nacos-group/nacos-sdk-go/clients/naming_client"
+	"github.com/nacos-group/nacos-sdk-go/vo"
+)
+
+// raft节点注册的服务名称为 微服务名称-raft
+const raftServiceSuffix = "-raft"
+
+// raft节点ID保存在实例的元数据中
+const raftIdMetadataKey = "raft.id"
+
+var raftNamingClient naming_client.INamingClient
+var raftRegisterLock sync.Mutex
+
+// EnableRaftPeerDiscovery 启用 DISCOVERY_RAFT_PEERS 时，通过Nacos获取raft节点列表，需要在 AutoRegister 之后、id生成器初始化之前调用
+func EnableRaftPeerDiscovery() {
+	if !conf.Enabled || !conf.RaftPeers {
+		return
+	}
+	log.Println("raft peer discovery is enabled")
+	snowflake.SetRaftPeerResolver(resolveRaftPeers)
+}
+
+// resolveRaftPeers 注册当前raft节点，并获取已注册的raft节点
+//
+// raft节点在选出leader后才能提供id，因此不做健康检查，立即注册
+func resolveRaftPeers(selfId, selfAddr string) (map[string]string, error) {
+	// 注册失败时，下次获取时重试
+	raftRegisterLock.Lock()
+	if raftNamingClient == nil {
+		if err := registerRaftPeer(selfId, selfAddr); err != nil {
+			raftRegisterLock.Unlock()
+			return nil, err
+		}
+	}
+	raftRegisterLock.Unlock()
+	instances, err := raftNamingClient.SelectInstances(vo.SelectInstancesParam{
+		ServiceName: serviceName + raftServiceSuffix,
+		GroupName:   "DEFAULT_GROUP",
+		HealthyOnly: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	peers := make(map[string]string, len(instances))
+	for _, instance := range instances {
+		id := instance.Metadata[raftIdMetadataKey]
+		if id == "" {
+			continue
+		}
+		peers[id] = net.JoinHostPort(instance.Ip, strconv.FormatUint(instance.Port, 10))
+	}
+	return peers, nil
+}
+
+// registerRaftPeer 注册raft节点，监听地址为 0.0.0.0 等时使用微服务ip
+func registerRaftPeer(selfId, selfAddr string) error {
+	host, portStr, err := net.SplitHostPort(selfAddr)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = conf.Host
+	}
+	port, err := strconv.ParseUint(portStr, 10, 64)
+	if err != nil {
+		return err
+	}
+	namingClient, err := newNamingClient()
+	if err != nil {
+		return err
+	}
+	success, err := namingClient.RegisterInstance(vo.RegisterInstanceParam{
+		Ip:          host,
+		Port:        port,
+		ServiceName: serviceName + raftServiceSuffix,
+		Weight:      1,
+		Enable:      true,
+		Healthy:     true,
+		Ephemeral:   true,
+		Metadata:    map[string]string{raftIdMetadataKey: selfId},
+		ClusterName: "DEFAULT",
+		GroupName:   "DEFAULT_GROUP",
+	})
+	if err != nil {
+		return err
+	}
+	if !success {
+		return fmt.Errorf("register raft peer %s %s:%d failed", selfId, host, port)
+	}
+	log.Printf("nacos registry, %v DEFAULT_GROUP %v%v %v %v register finished", conf.Namespace, serviceName, raftServiceSuffix, host, port)
+	raftNamingClient = namingClient
+	return nil
+}
@@ -0,0 +1,62 @@
+package discovery
+
+import (
+	"log"
+	"sfgo/core/snowflake"
+	"strconv"
+	"sync"
+
+	"github.com/nacos-group/nacos-sdk-go/clients/naming_client"
+	"github.com/nacos-group/nacos-sdk-go/vo"
+)
+
+// workerId保存在实例的元数据中
+const workerIdMetadataKey = "workerId"
+
+// nacosWorkerIdRegistry 通过Nacos中实例元数据的workerId，检查workerId是否已被其它实例使用
+type nacosWorkerIdRegistry struct {
+	namingClient naming_client.INamingClient
+	lock         sync.Mutex
+}
+
+// EnableWorkerIdRegistry 启用服务发现时，将Nacos作为workerId注册中心，供 IP_CONFLICT_CHECK=nacos 使用，需要在 AutoRegister 之后、id生成器初始化之前调用
+func EnableWorkerIdRegistry() {
+	if !conf.Enabled {
+		return
+	}
+	snowflake.SetWorkerIdRegistry("nacos", &nacosWorkerIdRegistry{})
+}
+
+// WorkerIdOwners 获取元数据中workerId相同的健康实例，appName对应的应用即为当前微服务
+func (r *nacosWorkerIdRegistry) WorkerIdOwners(appName string, workerId int64) ([]string, error) {
+	// 创建失败时，下次获取时重试
+	r.lock.Lock()
+	if r.namingClient == nil {
+		namingClient, err := newNamingClient()
+		if err != nil {
+			r.lock.Unlock()
+			return nil, err
+		}
+		r.namingClient = namingClient
+	}
+	r.lock.Unlock()
+	instances, err := r.namingClient.SelectAllInstances(vo.SelectAllInstancesParam{
+		ServiceName: serviceName,
+		GroupName:   "DEFAULT_GROUP",
+	})
+	if err != nil {
+		return nil, err
+	}
+	value := strconv.FormatInt(workerId, 10)
+	owners := make([]string, 0)
+	for _, instance := range instances {
+		if !instance.Healthy || !instance.Enable || instance.Metadata[workerIdMetadataKey] != value {
+			continue
+		}
+		owners = append(owners, instance.Ip+":"+strconv.FormatUint(instance.Port, 10))
+	}
+	if len(owners) > 0 {
+		log.Printf("workerId %d is registered in nacos by %v", workerId, owners)
+	}
+	return owners, nil
+}
@@ -1,16 +1,10 @@
 package main
 
 import (
-	"log"
-	"sfgo/common/tools"
-	"sfgo/discovery"
-	"sfgo/web"
+	"os"
+	"sfgo/cli"
 )
 
-var port = tools.GetEnv("SERVER_PORT", "8074")
-
 func main() {
-	log.Println("server start.")
-	discovery.AutoRegister(port)
-	web.Run("", port)
+	os.Exit(cli.Run(os.Args[1:]))
 }
@@ -1,12 +1,68 @@
 package actuator
 
 import (
+	"fmt"
 	"net/http"
+	"strings"
+	"sync"
 
 	"github.com/gin-gonic/gin"
 )
 
+type readinessCheck struct {
+	name  string
+	check func() error
+}
+
+var readinessChecks = make([]readinessCheck, 0)
+var readinessLock sync.RWMutex
+
+var infoContributors = make(map[string]func() any)
+var infoLock sync.RWMutex
+
+// RegisterReadinessCheck 注册就绪检查，check返回error时，表示未就绪
+func RegisterReadinessCheck(name string, check func() error) {
+	readinessLock.Lock()
+	defer readinessLock.Unlock()
+	readinessChecks = append(readinessChecks, readinessCheck{name: name, check: check})
+}
+
+// RegisterInfoContributor 注册应用信息，name为 /actuator/info 返回结果中的key
+func RegisterInfoContributor(name string, contributor func() any) {
+	infoLock.Lock()
+	defer infoLock.Unlock()
+	infoContributors[name] = contributor
+}
+
 // Health 健康检查
 func Health(ctx *gin.Context) {
 	ctx.String(http.StatusOK, "Hi Golang, I Feel Great!!!")
 }
+
+// Readiness 就绪检查，所有检查都通过时返回200，否则返回503
+func Readiness(ctx *gin.Context) {
+	readinessLock.RLock()
+	defer readinessLock.RUnlock()
+	failures := make([]string, 0)
+	for _, c := range readinessChecks {
+		if err := c.check(); err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %s", c.name, err.Error()))
+		}
+	}
+	if len(failures) > 0 {
+		ctx.String(http.StatusServiceUnavailable, "Not Ready. %s", strings.Join(failures, "; "))
+		return
+	}
+	ctx.String(http.StatusOK, "Ready")
+}
+
+// Info 应用信息
+func Info(ctx *gin.Context) {
+	infoLock.RLock()
+	defer infoLock.RUnlock()
+	info := make(map[string]any, len(infoContributors))
+	for name, contributor := range infoContributors {
+		info[name] = contributor()
+	}
+	ctx.JSON(http.StatusOK, info)
+}
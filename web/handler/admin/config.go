@@ -0,0 +1,25 @@
+package admin
+
+import (
+	"net/http"
+	"sfgo/config"
+	"sfgo/web/vo"
+
+	"github.com/gin-gonic/gin"
+)
+
+// EffectiveConfig 当前生效的配置
+type EffectiveConfig struct {
+	// 配置文件路径，未使用配置文件时为空
+	File     string           `json:"file"`
+	Settings []config.Setting `json:"settings"`
+}
+
+// GetConfig 当前生效的配置及其来源，敏感信息隐藏，reloadable 为true的配置项修改配置文件后无需重启
+func GetConfig(ctx *gin.Context) {
+	cfg := configManager.Current()
+	ctx.JSON(http.StatusOK, vo.SuccessRespBase(EffectiveConfig{
+		File:     cfg.File(),
+		Settings: cfg.Settings(),
+	}))
+}
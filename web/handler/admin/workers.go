@@ -0,0 +1,132 @@
+package admin
+
+import (
+	"net/http"
+	"sfgo/config"
+	"sfgo/core/snowflake"
+	"sfgo/web/vo"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+var generator *snowflake.IdGenerator
+
+var configManager *config.Manager
+
+// Init 初始化管理接口，需要在id生成器初始化之后调用
+func Init(idGenerator *snowflake.IdGenerator, m *config.Manager) {
+	generator = idGenerator
+	configManager = m
+}
+
+// WorkerAllocation workerId分配记录
+type WorkerAllocation struct {
+	snowflake.WorkerIdAllocation
+	// 距最后上报时间戳的时长，单位ms
+	Age int64 `json:"age"`
+}
+
+// Workers workerId分配及保留记录
+type Workers struct {
+	Provider     string                          `json:"provider"`
+	Allocations  []WorkerAllocation              `json:"allocations"`
+	Reservations []snowflake.WorkerIdReservation `json:"reservations"`
+}
+
+// ListWorkers 列出workerId分配记录，WorkerIdProvider支持保留时同时列出保留的workerId
+func ListWorkers(ctx *gin.Context) {
+	provider := generator.WorkerIdProvider()
+	recycler, ok := provider.(snowflake.WorkerIdRecycler)
+	if !ok {
+		ctx.JSON(http.StatusOK, vo.BusinessFailedRespBase("the worker id provider doesn't support listing allocations"))
+		return
+	}
+	allocations, err := recycler.ListAllocations(generator.AppName())
+	if err != nil {
+		ctx.JSON(http.StatusOK, vo.BusinessFailedRespBase(err.Error()))
+		return
+	}
+	workers := Workers{
+		Provider:     snowflake.GetProviderName(provider),
+		Allocations:  toWorkerAllocations(allocations),
+		Reservations: []snowflake.WorkerIdReservation{},
+	}
+	if admin, ok := provider.(snowflake.WorkerIdAdmin); ok {
+		workers.Reservations, err = admin.ListReservations(generator.AppName())
+		if err != nil {
+			ctx.JSON(http.StatusOK, vo.BusinessFailedRespBase(err.Error()))
+			return
+		}
+	}
+	ctx.JSON(http.StatusOK, vo.SuccessRespBase(workers))
+}
+
+// ReleaseWorker 释放workerId，默认仅释放长时间未上报时间戳的workerId，force=true时强制释放
+//
+// 占用者仍在运行时，其租约将丢失并停止发放id
+func ReleaseWorker(ctx *gin.Context) {
+	admin, workerId, ok := parseAdminRequest(ctx)
+	if !ok {
+		return
+	}
+	allocation, err := admin.ReleaseAllocation(generator.AppName(), workerId, ctx.Query("force") == "true")
+	if err != nil {
+		ctx.JSON(http.StatusOK, vo.BusinessFailedRespBase(err.Error()))
+		return
+	}
+	ctx.JSON(http.StatusOK, vo.SuccessRespBase(toWorkerAllocations([]snowflake.WorkerIdAllocation{allocation})[0]))
+}
+
+// ReserveWorker 保留workerId，保留的workerId不会被分配，reason为保留原因
+func ReserveWorker(ctx *gin.Context) {
+	admin, workerId, ok := parseAdminRequest(ctx)
+	if !ok {
+		return
+	}
+	err := admin.ReserveWorkerId(generator.AppName(), workerId, ctx.Query("reason"))
+	if err != nil {
+		ctx.JSON(http.StatusOK, vo.BusinessFailedRespBase(err.Error()))
+		return
+	}
+	ctx.JSON(http.StatusOK, vo.SuccessRespBase(workerId))
+}
+
+// UnreserveWorker 取消保留workerId
+func UnreserveWorker(ctx *gin.Context) {
+	admin, workerId, ok := parseAdminRequest(ctx)
+	if !ok {
+		return
+	}
+	err := admin.UnreserveWorkerId(generator.AppName(), workerId)
+	if err != nil {
+		ctx.JSON(http.StatusOK, vo.BusinessFailedRespBase(err.Error()))
+		return
+	}
+	ctx.JSON(http.StatusOK, vo.SuccessRespBase(workerId))
+}
+
+// parseAdminRequest 解析路径中的workerId，WorkerIdProvider不支持或参数无效时返回响应
+func parseAdminRequest(ctx *gin.Context) (snowflake.WorkerIdAdmin, int64, bool) {
+	admin, ok := generator.WorkerIdProvider().(snowflake.WorkerIdAdmin)
+	if !ok {
+		ctx.JSON(http.StatusOK, vo.BusinessFailedRespBase("the worker id provider doesn't support releasing or reserving worker ids"))
+		return nil, 0, false
+	}
+	workerId, err := strconv.ParseInt(ctx.Param("workerId"), 10, 64)
+	if err != nil || workerId < 0 || workerId > snowflake.MaxWorkerId() {
+		ctx.JSON(http.StatusOK, vo.ParamInvalidRespBase("workerId"))
+		return nil, 0, false
+	}
+	return admin, workerId, true
+}
+
+func toWorkerAllocations(allocations []snowflake.WorkerIdAllocation) []WorkerAllocation {
+	now := time.Now().UnixMilli()
+	workers := make([]WorkerAllocation, 0, len(allocations))
+	for _, a := range allocations {
+		workers = append(workers, WorkerAllocation{WorkerIdAllocation: a, Age: now - a.Timestamp})
+	}
+	return workers
+}
@@ -0,0 +1,95 @@
+package id
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Config /id 接口的配置，通过Init设置，可以通过Reconfigure在运行时修改
+//
+// 标签 yaml toml 为配置文件中的名称，env 为环境变量名称，以 _* 结尾时为前缀，desc 为说明，reload 为true时可以在运行时修改
+type Config struct {
+	LegacyErrors bool  `yaml:"legacyErrors" toml:"legacyErrors" env:"ID_LEGACY_ERRORS" reload:"true" desc:"是否使用旧版本的错误响应，为true时HTTP状态码均为200"`
+	MaxBatchSize int64 `yaml:"maxBatchSize" toml:"maxBatchSize" env:"ID_MAX_BATCH_SIZE" reload:"true" desc:"批量获取id的最大数量"`
+	// key为接口名称，e.g. batch，环境变量为 ID_MAX_BATCH_SIZE_<接口名称大写>
+	EndpointMaxBatchSize map[string]int64 `yaml:"endpointMaxBatchSize" toml:"endpointMaxBatchSize" env:"ID_MAX_BATCH_SIZE_*" reload:"true" desc:"各接口批量获取id的最大数量"`
+	// key为业务标签，不能超过接口的最大数量，环境变量格式为 标签:数量，多个用 , 分隔，e.g. order:1000,user:100
+	TagMaxBatchSize map[string]int64 `yaml:"tagMaxBatchSize" toml:"tagMaxBatchSize" env:"ID_TAG_MAX_BATCH_SIZE" reload:"true" desc:"各业务标签批量获取id的最大数量"`
+	// 多个用 , 分隔，这些业务标签通过 /id/get /id/batch 获取的id为不超过 2^53-1 的数字，需要启用 SNOWFLAKE_JS_SAFE
+	JsSafeTags string `yaml:"jsSafeTags" toml:"jsSafeTags" env:"ID_JS_SAFE_TAGS" reload:"true" desc:"返回js-safe数字id的业务标签"`
+}
+
+// DefaultConfig 默认配置
+func DefaultConfig() Config {
+	return Config{
+		MaxBatchSize:         10000,
+		EndpointMaxBatchSize: map[string]int64{},
+		TagMaxBatchSize:      map[string]int64{},
+	}
+}
+
+// 批量获取id的接口名称，用于按接口设置最大数量
+var batchEndpoints = []string{endpointBatch, endpointJsBatch, endpointUuid7Batch, endpointUlidBatch, endpointKsuidBatch}
+
+// JsSafeTagList JsSafeTags中的各业务标签
+func (c Config) JsSafeTagList() []string {
+	tags := make([]string, 0)
+	for _, tag := range strings.Split(c.JsSafeTags, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// Validate 校验配置，返回所有无效的配置项
+func (c Config) Validate() error {
+	problems := make([]string, 0)
+	if c.MaxBatchSize <= 0 {
+		problems = append(problems, fmt.Sprintf("ID_MAX_BATCH_SIZE must be greater than 0, got %d", c.MaxBatchSize))
+	}
+	for _, endpoint := range sortedKeys(c.EndpointMaxBatchSize) {
+		name := "ID_MAX_BATCH_SIZE_" + strings.ToUpper(endpoint)
+		if !contains(batchEndpoints, endpoint) {
+			problems = append(problems, fmt.Sprintf("%s: unknown endpoint %q, valid endpoints: %s", name, endpoint, strings.Join(batchEndpoints, ", ")))
+		} else if size := c.EndpointMaxBatchSize[endpoint]; size <= 0 {
+			problems = append(problems, fmt.Sprintf("%s must be greater than 0, got %d", name, size))
+		}
+	}
+	for _, tag := range sortedKeys(c.TagMaxBatchSize) {
+		if !tagRegexp.MatchString(tag) {
+			problems = append(problems, fmt.Sprintf("ID_TAG_MAX_BATCH_SIZE: tag %q must be 1 to 64 letters, digits, '_', '-' or '.'", tag))
+		} else if size := c.TagMaxBatchSize[tag]; size <= 0 {
+			problems = append(problems, fmt.Sprintf("ID_TAG_MAX_BATCH_SIZE: size of tag %s must be greater than 0, got %d", tag, size))
+		}
+	}
+	for _, tag := range c.JsSafeTagList() {
+		if !tagRegexp.MatchString(tag) {
+			problems = append(problems, fmt.Sprintf("ID_JS_SAFE_TAGS: tag %q must be 1 to 64 letters, digits, '_', '-' or '.'", tag))
+		}
+	}
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, "\n"))
+	}
+	return nil
+}
+
+func sortedKeys(m map[string]int64) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,62 @@
+package id
+
+import (
+	"math"
+	"net/http"
+	"sfgo/core"
+	"sfgo/web/vo"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// errorStatus 状态码不为503的错误码
+var errorStatus = map[string]int{
+	// 未启用时接口不可用，重试或换其它实例均无法恢复
+	core.ErrCodeJsSafeDisabled: http.StatusNotFound,
+}
+
+// respondError id生成失败
+//
+// id生成器无法发放id时（e.g. 时钟回拨、租约丢失）返回503，可以重试时通过Retry-After给出建议的重试间隔，
+// 未启用js-safe时返回404，其它错误返回500
+func respondError(ctx *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	errorCode := vo.ErrCodeInternal
+	e, ok := core.AsError(err)
+	if ok {
+		errorCode = e.Code
+		status = http.StatusServiceUnavailable
+		if codeStatus, known := errorStatus[e.Code]; known {
+			status = codeStatus
+		}
+	}
+	// 旧版本的错误响应，HTTP状态码均为200，通过响应中的code、resultcode区分成功与失败，供旧客户端使用
+	if currentConfig().LegacyErrors {
+		resp := vo.BusinessFailedRespBase(err.Error())
+		resp.ErrorCode = errorCode
+		ctx.JSON(http.StatusOK, resp)
+		return
+	}
+	if ok && e.RetryAfter > 0 {
+		ctx.Header("Retry-After", strconv.FormatInt(int64(math.Ceil(e.RetryAfter.Seconds())), 10))
+	}
+	ctx.JSON(status, vo.ErrorRespBase(status, errorCode, err.Error()))
+}
+
+// respondParamsInvalid 参数无效，返回400，data为各参数无效的原因
+func respondParamsInvalid(ctx *gin.Context, errs []vo.FieldError) {
+	if currentConfig().LegacyErrors {
+		fields := make([]string, 0, len(errs))
+		for _, e := range errs {
+			fields = append(fields, e.Field)
+		}
+		legacy := vo.ParamInvalidRespBase(strings.Join(fields, ","))
+		resp := vo.InvalidParamsRespBase(legacy.Code, errs)
+		resp.Msg = legacy.Msg
+		ctx.JSON(http.StatusOK, resp)
+		return
+	}
+	ctx.JSON(http.StatusBadRequest, vo.InvalidParamsRespBase(http.StatusBadRequest, errs))
+}
@@ -0,0 +1,106 @@
+package id
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sfgo/core"
+	"sfgo/web/vo"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// failingGenerator 总是返回err的IdGenerator，仅用于测试
+type failingGenerator struct {
+	err error
+}
+
+func (g *failingGenerator) Init() {}
+
+func (g *failingGenerator) GetId() (int64, error) { return 0, g.err }
+
+func (g *failingGenerator) GetIds(n int) ([]int64, error) { return nil, g.err }
+
+func (g *failingGenerator) Ready() error { return g.err }
+
+func (g *failingGenerator) Close() {}
+
+// getOneWithError 使用返回err的IdGenerator请求 /id/get
+func getOneWithError(t *testing.T, err error) (*httptest.ResponseRecorder, vo.RespBase[json.RawMessage]) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	prev := idGenerator
+	t.Cleanup(func() { idGenerator = prev })
+	idGenerator = &failingGenerator{err: err}
+	router := gin.New()
+	router.GET("/id/get", GetOne)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/id/get", nil))
+	var resp vo.RespBase[json.RawMessage]
+	if e := json.Unmarshal(w.Body.Bytes(), &resp); e != nil {
+		t.Fatalf("invalid response %q: %v", w.Body.String(), e)
+	}
+	return w, resp
+}
+
+func TestRespondErrorStatus(t *testing.T) {
+	tests := []struct {
+		err        error
+		status     int
+		errorCode  string
+		retryAfter string
+	}{
+		{core.NewError(core.ErrCodeClockBackwards, "clock moved backwards", 1500*time.Millisecond), http.StatusServiceUnavailable, core.ErrCodeClockBackwards, "2"},
+		{core.NewError(core.ErrCodeSequenceExhausted, "sequence exhausted", time.Millisecond), http.StatusServiceUnavailable, core.ErrCodeSequenceExhausted, "1"},
+		{core.NewError(core.ErrCodeWorkerLeaseLost, "lease lost", 0), http.StatusServiceUnavailable, core.ErrCodeWorkerLeaseLost, ""},
+		{http.ErrHandlerTimeout, http.StatusInternalServerError, vo.ErrCodeInternal, ""},
+	}
+	for _, tt := range tests {
+		w, resp := getOneWithError(t, tt.err)
+		if w.Code != tt.status || resp.Code != tt.status || resp.ErrorCode != tt.errorCode {
+			t.Errorf("%s: got status %d code %d errorCode %s, want %d", tt.errorCode, w.Code, resp.Code, resp.ErrorCode, tt.status)
+		}
+		if got := w.Header().Get("Retry-After"); got != tt.retryAfter {
+			t.Errorf("%s: got Retry-After %q, want %q", tt.errorCode, got, tt.retryAfter)
+		}
+	}
+}
+
+func TestRespondErrorLegacy(t *testing.T) {
+	prev := current.Load()
+	defer current.Store(prev)
+	c := DefaultConfig()
+	c.LegacyErrors = true
+	Reconfigure(c)
+	w, resp := getOneWithError(t, core.NewError(core.ErrCodeWorkerLeaseLost, "lease lost", 0))
+	if w.Code != http.StatusOK || resp.ResultCode != 0 || resp.ErrorCode != core.ErrCodeWorkerLeaseLost {
+		t.Fatalf("got status %d resultcode %d errorCode %s, want 200 0 %s", w.Code, resp.ResultCode, resp.ErrorCode, core.ErrCodeWorkerLeaseLost)
+	}
+	if w.Header().Get("Retry-After") != "" {
+		t.Fatal("legacy response should not have Retry-After")
+	}
+}
+
+func TestRespondErrorJsSafeDisabled(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	prev := idGenerator
+	defer func() { idGenerator = prev }()
+	// 不支持js-safe的id的IdGenerator
+	idGenerator = &failingGenerator{}
+	router := gin.New()
+	router.GET("/id/js/get", GetJsSafeOne)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/id/js/get", nil))
+	var resp vo.RespBase[json.RawMessage]
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusNotFound || resp.Code != http.StatusNotFound || resp.ErrorCode != core.ErrCodeJsSafeDisabled {
+		t.Fatalf("got status %d code %d errorCode %s, want 404 %s", w.Code, resp.Code, resp.ErrorCode, core.ErrCodeJsSafeDisabled)
+	}
+	if w.Header().Get("Retry-After") != "" {
+		t.Fatal("js-safe disabled should not have Retry-After")
+	}
+}
@@ -1,56 +1,245 @@
 package id
 
 import (
+	"log"
 	"net/http"
-	"sfgo/common/convutil"
 	"sfgo/common/netutil"
-	"sfgo/common/tools"
-	"sfgo/common/valiutil"
 	"sfgo/core"
+	"sfgo/core/idcodec"
 	"sfgo/core/snowflake"
+	"sfgo/web/handler/actuator"
 	"sfgo/web/vo"
 	"strconv"
+	"sync/atomic"
 
 	"github.com/gin-gonic/gin"
 )
 
-const maxCount = 10000
-
 var idGenerator core.IdGenerator
 
-var port = tools.GetEnv("SERVER_PORT", "8074")
+// handlerConfig 当前配置及根据配置创建的batchLimits
+type handlerConfig struct {
+	Config
+	limits *batchLimits
+	// 返回js-safe数字id的业务标签
+	jsSafeTags map[string]bool
+}
+
+func newHandlerConfig(c Config) *handlerConfig {
+	jsSafeTags := make(map[string]bool)
+	for _, tag := range c.JsSafeTagList() {
+		jsSafeTags[tag] = true
+	}
+	return &handlerConfig{Config: c, limits: newBatchLimits(c), jsSafeTags: jsSafeTags}
+}
+
+// current 当前配置，由Init设置，可以通过Reconfigure在运行时替换
+var current atomic.Pointer[handlerConfig]
+
+// currentConfig 当前配置，Init之前为默认配置
+func currentConfig() *handlerConfig {
+	if c := current.Load(); c != nil {
+		return c
+	}
+	return newHandlerConfig(DefaultConfig())
+}
+
+// Reconfigure 替换配置，配置需要已校验，其中的配置项均可在运行时修改
+func Reconfigure(c Config) {
+	current.Store(newHandlerConfig(c))
+}
 
-var appName = tools.GetEnv("DISCOVERY_MICROSRV_NAME", "id-generator")
+// Init 初始化id生成器，配置需要已校验，snowflake的配置需要已通过 snowflake.Configure 设置
+//
+// port 服务端口，appName 应用名称，用于分配workerId
+func Init(c Config, port, appName string) {
+	Reconfigure(c)
+	generator, err := snowflake.NewIdGenerator(netutil.GetFirstNonLoopbackIP(), port, appName)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	generator.Init()
+	idGenerator = generator
+	actuator.RegisterInfoContributor("worker", func() any {
+		return generator.Info()
+	})
+	actuator.RegisterReadinessCheck("idGenerator", idGenerator.Ready)
+	actuator.RegisterReadinessCheck("workerIdConflict", generator.ConflictCheck)
+}
 
-func init() {
-	idGenerator = snowflake.NewIdGenerator(netutil.GetFirstNonLoopbackIP(), port, appName)
-	idGenerator.Init()
+// Generator id生成器，需要在Init之后调用
+func Generator() *snowflake.IdGenerator {
+	generator, _ := idGenerator.(*snowflake.IdGenerator)
+	return generator
 }
 
-// GetOne 获取1个id
+// Close 关闭id生成器，释放workerId
+func Close() {
+	if idGenerator != nil {
+		idGenerator.Close()
+	}
+}
+
+// GetOne 获取1个id，业务标签tag在 ID_JS_SAFE_TAGS 中时返回js-safe的数字id
+//
+// 可选参数 encoding 为id的编码方式，decimal base62 base32 base58，为空时为十进制
 func GetOne(ctx *gin.Context) {
-	id, _ := idGenerator.GetId()
-	resp := vo.SuccessRespBase(strconv.FormatInt(id, 10))
+	var req IdRequest
+	if !bindQuery(ctx, &req) {
+		return
+	}
+	if currentConfig().jsSafeTags[req.Tag] {
+		getJsSafeOne(ctx, req)
+		return
+	}
+	id, err := idGenerator.GetId()
+	recordIssued(kindSnowflake, 1, err)
+	if err != nil {
+		respondError(ctx, err)
+		return
+	}
+	resp := vo.SuccessRespBase(req.encoding().Encode(id))
 	ctx.JSON(http.StatusOK, resp)
 }
 
-// GetBatch 获取 count 个id
+// GetBatch 获取 count 个id，count不能超过接口及业务标签tag的最大数量，业务标签tag在 ID_JS_SAFE_TAGS 中时返回js-safe的数字id
+//
+// 可选参数 encoding 与 GetOne 相同
 func GetBatch(ctx *gin.Context) {
-	paramCount := ctx.DefaultQuery("count", "1")
-	if !valiutil.IsNumber(paramCount) {
-		ctx.JSON(http.StatusOK, vo.ParamInvalidRespBase("count"))
+	var req BatchRequest
+	if !bindQuery(ctx, &req) {
+		return
+	}
+	if errs := req.validate(endpointBatch); len(errs) > 0 {
+		respondParamsInvalid(ctx, errs)
 		return
 	}
-	count, _ := strconv.Atoi(paramCount)
-	if count > maxCount {
-		count = maxCount
+	if currentConfig().jsSafeTags[req.Tag] {
+		getJsSafeBatch(ctx, req)
+		return
 	}
-	ids, err := idGenerator.GetIds(count)
+	ids, err := idGenerator.GetIds(req.count)
+	recordIssued(kindSnowflake, req.count, err)
 	if err != nil {
-		ctx.JSON(http.StatusOK, vo.BusinessFailedRespBase(err.Error()))
+		respondError(ctx, err)
 		return
 	}
-	idsStr := convutil.SliceInt2Str(ids)
-	resp := vo.SuccessRespBase(idsStr)
+	resp := vo.SuccessRespBase(req.encoding().EncodeAll(ids))
 	ctx.JSON(http.StatusOK, resp)
 }
+
+// GetJsSafeOne 获取1个js-safe的id，不超过 2^53-1，以数字返回，需要启用 SNOWFLAKE_JS_SAFE
+//
+// 指定了 decimal 以外的 encoding 时以编码后的字符串返回
+func GetJsSafeOne(ctx *gin.Context) {
+	var req IdRequest
+	if !bindQuery(ctx, &req) {
+		return
+	}
+	getJsSafeOne(ctx, req)
+}
+
+// GetJsSafeBatch 获取 count 个js-safe的id，以数字返回，count不能超过接口及业务标签tag的最大数量
+func GetJsSafeBatch(ctx *gin.Context) {
+	var req BatchRequest
+	if !bindQuery(ctx, &req) {
+		return
+	}
+	if errs := req.validate(endpointJsBatch); len(errs) > 0 {
+		respondParamsInvalid(ctx, errs)
+		return
+	}
+	getJsSafeBatch(ctx, req)
+}
+
+func getJsSafeOne(ctx *gin.Context, req IdRequest) {
+	ids, err := getJsSafeIds(1)
+	if err != nil {
+		respondError(ctx, err)
+		return
+	}
+	if e := req.encoding(); e != idcodec.Decimal {
+		ctx.JSON(http.StatusOK, vo.SuccessRespBase(e.Encode(ids[0])))
+		return
+	}
+	ctx.JSON(http.StatusOK, vo.SuccessRespBase(ids[0]))
+}
+
+func getJsSafeBatch(ctx *gin.Context, req BatchRequest) {
+	ids, err := getJsSafeIds(req.count)
+	if err != nil {
+		respondError(ctx, err)
+		return
+	}
+	if e := req.encoding(); e != idcodec.Decimal {
+		ctx.JSON(http.StatusOK, vo.SuccessRespBase(e.EncodeAll(ids)))
+		return
+	}
+	ctx.JSON(http.StatusOK, vo.SuccessRespBase(ids))
+}
+
+// getJsSafeIds id生成器不支持js-safe的id时返回 snowflake.ErrJsSafeDisabled
+func getJsSafeIds(n int) ([]int64, error) {
+	generator, ok := idGenerator.(core.JsSafeIdGenerator)
+	if !ok {
+		return nil, snowflake.ErrJsSafeDisabled
+	}
+	ids, err := generator.GetJsSafeIds(n)
+	recordIssued(kindJsSafe, n, err)
+	return ids, err
+}
+
+// IdRange 时间范围内生成的id的范围，包括两端
+type IdRange struct {
+	// 时间范围，单位ms，超出id能表示的时间范围时取最近的边界，layout为js-safe时为所在秒的开始
+	From int64 `json:"from"`
+	To   int64 `json:"to"`
+	// 指定了workerId时，范围内还包括其它workerId生成的id
+	WorkerId *int64 `json:"workerId,omitempty"`
+	MinId    string `json:"minId"`
+	MaxId    string `json:"maxId"`
+}
+
+// GetRange 时间范围 from 到 to 内生成的最小及最大id，用于按时间范围查询，e.g. WHERE id BETWEEN minId AND maxId
+//
+// 可选参数 worker 限制为该workerId生成的id，layout 为 js-safe 时为 /id/js 接口的id的范围
+func GetRange(ctx *gin.Context) {
+	var req RangeRequest
+	if !bindQuery(ctx, &req) {
+		return
+	}
+	if errs := req.validate(); len(errs) > 0 {
+		respondParamsInvalid(ctx, errs)
+		return
+	}
+	layout := req.layout
+	minId := layout.MinId(req.from, req.worker)
+	maxId := layout.MaxId(req.to, req.worker)
+	min, _ := layout.Decompose(minId)
+	max, _ := layout.Decompose(maxId)
+	idRange := IdRange{
+		From:  min.Timestamp,
+		To:    max.Timestamp,
+		MinId: strconv.FormatInt(minId, 10),
+		MaxId: strconv.FormatInt(maxId, 10),
+	}
+	if req.worker != snowflake.AnyWorker {
+		idRange.WorkerId = &req.worker
+	}
+	ctx.JSON(http.StatusOK, vo.SuccessRespBase(idRange))
+}
+
+// GetParse 解析id的时间戳、workerId、序列号，参数 id 可以有多个，可以为十进制、base62、base32、base58形式
+//
+// 可选参数 encoding 为id的编码方式，为空时识别编码方式，无法区分base62与base58时返回所有可能的结果；layout 为 js-safe 时解析 /id/js 接口的id
+func GetParse(ctx *gin.Context) {
+	var req ParseRequest
+	if !bindQuery(ctx, &req) {
+		return
+	}
+	if errs := req.validate(); len(errs) > 0 {
+		respondParamsInvalid(ctx, errs)
+		return
+	}
+	ctx.JSON(http.StatusOK, vo.SuccessRespBase(req.parsed))
+}
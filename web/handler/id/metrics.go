@@ -0,0 +1,47 @@
+package id
+
+import (
+	"sfgo/core"
+	"sfgo/web/vo"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// id的类型，用作监控指标的kind
+const (
+	kindSnowflake = "snowflake"
+	kindJsSafe    = "js_safe"
+	kindUuid7     = "uuid7"
+	kindUlid      = "ulid"
+	kindKsuid     = "ksuid"
+)
+
+// idsIssued 发放的id数量
+//
+// kind 为 snowflake js_safe uuid7 ulid ksuid
+var idsIssued = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "sfgo_ids_issued_total",
+	Help: "Number of ids issued by kind.",
+}, []string{"kind"})
+
+// idFailures 生成id失败的次数
+//
+// code 为错误码，e.g. CLOCK_BACKWARDS
+var idFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "sfgo_id_failures_total",
+	Help: "Failures to generate ids by kind and error code.",
+}, []string{"kind", "code"})
+
+// recordIssued 记录发放的id数量，err不为nil时记录失败
+func recordIssued(kind string, n int, err error) {
+	if err == nil {
+		idsIssued.WithLabelValues(kind).Add(float64(n))
+		return
+	}
+	code := vo.ErrCodeInternal
+	if e, ok := core.AsError(err); ok {
+		code = e.Code
+	}
+	idFailures.WithLabelValues(kind, code).Inc()
+}
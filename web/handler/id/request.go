@@ -0,0 +1,251 @@
+package id
+
+import (
+	"fmt"
+	"log"
+	"reflect"
+	"regexp"
+	"sfgo/common/convutil"
+	"sfgo/core/idcodec"
+	"sfgo/core/snowflake"
+	"sfgo/web/vo"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+// 批量获取id的接口名称，用于按接口设置最大数量
+const (
+	endpointBatch   = "batch"
+	endpointJsBatch = "js_batch"
+	// 字符串id的批量接口为 <类型>_batch，e.g. uuid7_batch
+	endpointUuid7Batch = kindUuid7 + "_batch"
+	endpointUlidBatch  = kindUlid + "_batch"
+	endpointKsuidBatch = kindKsuid + "_batch"
+)
+
+// 业务标签的格式，在包初始化时编译，避免每次请求编译
+var tagRegexp = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,64}$`)
+
+// batchLimits 批量获取id的最大数量
+type batchLimits struct {
+	// 未单独设置的接口的最大数量
+	defaultSize int64
+	// 各接口的最大数量
+	endpoints map[string]int64
+	// 各业务标签的最大数量
+	tags map[string]int64
+}
+
+// newBatchLimits 根据配置创建batchLimits，配置需要已校验
+func newBatchLimits(c Config) *batchLimits {
+	l := &batchLimits{
+		defaultSize: c.MaxBatchSize,
+		endpoints:   make(map[string]int64, len(c.EndpointMaxBatchSize)),
+		tags:        make(map[string]int64, len(c.TagMaxBatchSize)),
+	}
+	for endpoint, size := range c.EndpointMaxBatchSize {
+		l.endpoints[endpoint] = size
+	}
+	for tag, size := range c.TagMaxBatchSize {
+		l.tags[tag] = size
+	}
+	return l
+}
+
+// maxBatchSize 接口的最大数量，业务标签设置了更小的值时使用业务标签的值
+func (l *batchLimits) maxBatchSize(endpoint, tag string) int64 {
+	size, ok := l.endpoints[endpoint]
+	if !ok {
+		size = l.defaultSize
+	}
+	if tagSize, ok := l.tags[tag]; ok && tagSize < size {
+		return tagSize
+	}
+	return size
+}
+
+// IdRequest /id/get 的参数
+type IdRequest struct {
+	// 业务标签，可选，用于按业务设置批量获取的最大数量等
+	Tag string `form:"tag" binding:"omitempty,tag"`
+	// 编码方式，可选，为空时为十进制
+	Encoding string `form:"encoding" binding:"omitempty,oneof=decimal base62 base32 base58"`
+}
+
+// encoding 请求的编码方式，为空时为十进制
+func (req IdRequest) encoding() *idcodec.Encoding {
+	e, _ := idcodec.ByName(req.Encoding)
+	return e
+}
+
+// BatchRequest /id/batch 的参数
+type BatchRequest struct {
+	IdRequest
+	// 数量，为空时为1。按字符串绑定，由validate转换，以便超出范围时给出明确的原因
+	Count string `form:"count" binding:"omitempty,number"`
+	count int
+}
+
+// validate 校验数量，不能超过接口及业务标签的最大数量
+func (req *BatchRequest) validate(endpoint string) []vo.FieldError {
+	if req.Count == "" {
+		req.count = 1
+		return nil
+	}
+	limits := currentConfig().limits
+	max := limits.maxBatchSize(endpoint, req.Tag)
+	count, err := strconv.ParseInt(req.Count, 10, 64)
+	if err != nil || count < 1 || count > max {
+		msg := fmt.Sprintf("count must be between 1 and %d", max)
+		if tagSize, ok := limits.tags[req.Tag]; ok && tagSize == max {
+			msg += " for tag " + req.Tag
+		}
+		return []vo.FieldError{{Field: "count", Message: msg}}
+	}
+	req.count = int(count)
+	return nil
+}
+
+// RangeRequest /id/range 的参数
+type RangeRequest struct {
+	// 时间范围，包括两端，格式为毫秒时间戳或日期时间，日期时间未带时区时使用服务器的时区
+	From string `form:"from" binding:"required"`
+	To   string `form:"to" binding:"required"`
+	// workerId，可选，为空时不限制
+	Worker string `form:"worker" binding:"omitempty,number"`
+	// 位分配方式，可选，为 js-safe 时为 /id/js 接口的id的范围
+	Layout string `form:"layout" binding:"omitempty,oneof=default js-safe"`
+	from   time.Time
+	to     time.Time
+	worker int64
+	layout snowflake.Layout
+}
+
+// validate 解析时间范围及workerId
+func (req *RangeRequest) validate() []vo.FieldError {
+	errs := make([]vo.FieldError, 0)
+	var err error
+	if req.from, err = convutil.ParseTime(req.From, time.Local); err != nil {
+		errs = append(errs, vo.FieldError{Field: "from", Message: "from is invalid: " + err.Error()})
+	}
+	if req.to, err = convutil.ParseTime(req.To, time.Local); err != nil {
+		errs = append(errs, vo.FieldError{Field: "to", Message: "to is invalid: " + err.Error()})
+	}
+	if len(errs) == 0 && req.to.Before(req.from) {
+		errs = append(errs, vo.FieldError{Field: "to", Message: "to can't be earlier than from"})
+	}
+	req.layout = snowflake.DefaultLayout
+	if req.Layout == snowflake.LAYOUT_JS_SAFE {
+		req.layout = snowflake.JsSafeLayout
+	}
+	req.worker = snowflake.AnyWorker
+	if req.Worker != "" {
+		worker, err := strconv.ParseInt(req.Worker, 10, 64)
+		if err != nil || worker > req.layout.MaxWorkerId() {
+			errs = append(errs, vo.FieldError{Field: "worker", Message: fmt.Sprintf("worker must be between 0 and %d", req.layout.MaxWorkerId())})
+		}
+		req.worker = worker
+	}
+	return errs
+}
+
+// 一次最多解析的id数量
+const maxParseIds = 100
+
+// ParseRequest /id/parse 的参数
+type ParseRequest struct {
+	// id，可以有多个，e.g. id=xxx&id=yyy，可以为十进制、base62、base32、base58形式
+	Id []string `form:"id" binding:"required"`
+	// 编码方式，可选，为空时识别编码方式
+	Encoding string `form:"encoding" binding:"omitempty,oneof=decimal base62 base32 base58"`
+	// 位分配方式，可选，为 js-safe 时解析 /id/js 接口的id
+	Layout string `form:"layout" binding:"omitempty,oneof=default js-safe"`
+	parsed []snowflake.ParsedId
+}
+
+// validate 解析id，返回各无效的id的原因
+func (req *ParseRequest) validate() []vo.FieldError {
+	if len(req.Id) > maxParseIds {
+		return []vo.FieldError{{Field: "id", Message: fmt.Sprintf("at most %d ids can be parsed at a time", maxParseIds)}}
+	}
+	layout := snowflake.DefaultLayout
+	if req.Layout == snowflake.LAYOUT_JS_SAFE {
+		layout = snowflake.JsSafeLayout
+	}
+	errs := make([]vo.FieldError, 0)
+	req.parsed = make([]snowflake.ParsedId, 0, len(req.Id))
+	for _, raw := range req.Id {
+		parsed, err := layout.ParseAny(raw, req.Encoding)
+		if err != nil {
+			errs = append(errs, vo.FieldError{Field: "id", Message: fmt.Sprintf("invalid id %q: %s", raw, err.Error())})
+			continue
+		}
+		req.parsed = append(req.parsed, parsed...)
+	}
+	return errs
+}
+
+var registerValidationOnce sync.Once
+
+// registerValidation 参数名称使用form中的名称，并注册业务标签的校验规则
+func registerValidation() {
+	v, ok := binding.Validator.Engine().(*validator.Validate)
+	if !ok {
+		return
+	}
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name, _, _ := strings.Cut(field.Tag.Get("form"), ",")
+		if name == "" || name == "-" {
+			return field.Name
+		}
+		return name
+	})
+	err := v.RegisterValidation("tag", func(fl validator.FieldLevel) bool {
+		return tagRegexp.MatchString(fl.Field().String())
+	})
+	if err != nil {
+		log.Fatalln(err)
+	}
+}
+
+// bindQuery 绑定并校验查询参数，参数无效时返回400及各参数无效的原因
+func bindQuery(ctx *gin.Context, req any) bool {
+	registerValidationOnce.Do(registerValidation)
+	err := ctx.ShouldBindQuery(req)
+	if err == nil {
+		return true
+	}
+	errs, ok := err.(validator.ValidationErrors)
+	if !ok {
+		respondParamsInvalid(ctx, []vo.FieldError{{Field: "query", Message: err.Error()}})
+		return false
+	}
+	fieldErrs := make([]vo.FieldError, 0, len(errs))
+	for _, e := range errs {
+		fieldErrs = append(fieldErrs, vo.FieldError{Field: e.Field(), Message: fieldErrorMessage(e)})
+	}
+	respondParamsInvalid(ctx, fieldErrs)
+	return false
+}
+
+// fieldErrorMessage 参数无效的原因
+func fieldErrorMessage(e validator.FieldError) string {
+	switch e.Tag() {
+	case "number":
+		return e.Field() + " must be a positive integer"
+	case "required":
+		return e.Field() + " is required"
+	case "oneof":
+		return fmt.Sprintf("%s must be one of %s", e.Field(), strings.ReplaceAll(e.Param(), " ", ", "))
+	case "tag":
+		return e.Field() + " must be 1 to 64 letters, digits, '_', '-' or '.'"
+	default:
+		return fmt.Sprintf("%s is invalid: %s", e.Field(), e.Tag())
+	}
+}
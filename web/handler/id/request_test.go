@@ -0,0 +1,142 @@
+package id
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sfgo/web/vo"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// sequenceGenerator 依次发放id的IdGenerator，仅用于测试
+type sequenceGenerator struct {
+	last int64
+}
+
+func (g *sequenceGenerator) Init() {}
+
+func (g *sequenceGenerator) GetId() (int64, error) {
+	g.last++
+	return g.last, nil
+}
+
+func (g *sequenceGenerator) GetIds(n int) ([]int64, error) {
+	ids := make([]int64, n)
+	for i := range ids {
+		ids[i], _ = g.GetId()
+	}
+	return ids, nil
+}
+
+func (g *sequenceGenerator) Ready() error { return nil }
+
+func (g *sequenceGenerator) Close() {}
+
+// setupBatch 使用配置c及sequenceGenerator，测试结束后恢复
+func setupBatch(t *testing.T, c Config) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	prevConfig, prevGenerator := current.Load(), idGenerator
+	t.Cleanup(func() {
+		current.Store(prevConfig)
+		idGenerator = prevGenerator
+	})
+	Reconfigure(c)
+	idGenerator = &sequenceGenerator{}
+	router := gin.New()
+	router.GET("/id/batch", GetBatch)
+	return router
+}
+
+func getBatch(t *testing.T, router *gin.Engine, query string) (int, vo.RespBase[json.RawMessage]) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/id/batch?"+query, nil))
+	var resp vo.RespBase[json.RawMessage]
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("%s: invalid response %q: %v", query, w.Body.String(), err)
+	}
+	return w.Code, resp
+}
+
+func TestGetBatchRejectsInvalidParams(t *testing.T) {
+	c := DefaultConfig()
+	c.TagMaxBatchSize = map[string]int64{"small": 5}
+	router := setupBatch(t, c)
+	tests := []struct {
+		query   string
+		field   string
+		message string
+	}{
+		{"count=abc", "count", "count must be a positive integer"},
+		{"count=1.5", "count", "count must be a positive integer"},
+		{"count=-1", "count", "count must be a positive integer"},
+		{"count=0", "count", "count must be between 1 and 10000"},
+		{"count=99999999999999999999", "count", "count must be between 1 and 10000"},
+		{"count=10001", "count", "count must be between 1 and 10000"},
+		{"count=6&tag=small", "count", "count must be between 1 and 5 for tag small"},
+		{"count=2&tag=bad%20tag", "tag", "tag must be 1 to 64 letters, digits, '_', '-' or '.'"},
+		{"count=2&tag=a/b", "tag", "tag must be 1 to 64 letters, digits, '_', '-' or '.'"},
+		{"count=2&tag=" + strings.Repeat("a", 65), "tag", "tag must be 1 to 64 letters, digits, '_', '-' or '.'"},
+	}
+	for _, tt := range tests {
+		code, resp := getBatch(t, router, tt.query)
+		if code != http.StatusBadRequest {
+			t.Errorf("%s: got status %d, want %d", tt.query, code, http.StatusBadRequest)
+			continue
+		}
+		var errs []vo.FieldError
+		if err := json.Unmarshal(resp.Data, &errs); err != nil {
+			t.Fatalf("%s: invalid field errors %s: %v", tt.query, resp.Data, err)
+		}
+		if len(errs) != 1 || errs[0].Field != tt.field || errs[0].Message != tt.message {
+			t.Errorf("%s: got %+v, want %s: %s", tt.query, errs, tt.field, tt.message)
+		}
+	}
+}
+
+func TestGetBatchAcceptsValidParams(t *testing.T) {
+	c := DefaultConfig()
+	c.TagMaxBatchSize = map[string]int64{"small": 5}
+	router := setupBatch(t, c)
+	tests := []struct {
+		query string
+		count int
+	}{
+		{"", 1},
+		{"count=1", 1},
+		{"count=10000", 10000},
+		{"count=5&tag=small", 5},
+		{"count=3&tag=" + strings.Repeat("a", 64), 3},
+		{"count=3&tag=order-v1.2_x", 3},
+	}
+	for _, tt := range tests {
+		code, resp := getBatch(t, router, tt.query)
+		if code != http.StatusOK {
+			t.Errorf("%s: got status %d, want %d: %s", tt.query, code, http.StatusOK, resp.Data)
+			continue
+		}
+		var ids []string
+		if err := json.Unmarshal(resp.Data, &ids); err != nil {
+			t.Fatalf("%s: invalid ids %s: %v", tt.query, resp.Data, err)
+		}
+		if len(ids) != tt.count {
+			t.Errorf("%s: got %d ids, want %d", tt.query, len(ids), tt.count)
+		}
+	}
+}
+
+func TestTagRegexpMatchesConfigValidation(t *testing.T) {
+	c := DefaultConfig()
+	c.TagMaxBatchSize = map[string]int64{"bad tag": 5}
+	if err := c.Validate(); err == nil || !strings.Contains(err.Error(), `tag "bad tag"`) {
+		t.Fatalf("got %v, want invalid tag error", err)
+	}
+	c.TagMaxBatchSize = map[string]int64{"good.tag": 5}
+	if err := c.Validate(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,58 @@
+package id
+
+import (
+	"net/http"
+	"sfgo/core"
+	"sfgo/core/stringid"
+	"sfgo/web/vo"
+
+	"github.com/gin-gonic/gin"
+)
+
+// stringIdGenerators 各类型的字符串id生成器，不依赖workerId，各实例独立生成
+var stringIdGenerators = map[string]core.StringIdGenerator{
+	kindUuid7: stringid.NewUuid7Generator(),
+	kindUlid:  stringid.NewUlidGenerator(),
+	kindKsuid: stringid.NewKsuidGenerator(),
+}
+
+// GetStringOne 获取1个kind类型的字符串id，kind 为 uuid7 ulid ksuid
+func GetStringOne(kind string) gin.HandlerFunc {
+	generator := stringIdGenerators[kind]
+	return func(ctx *gin.Context) {
+		var req IdRequest
+		if !bindQuery(ctx, &req) {
+			return
+		}
+		id, err := generator.GetStringId()
+		recordIssued(kind, 1, err)
+		if err != nil {
+			respondError(ctx, err)
+			return
+		}
+		ctx.JSON(http.StatusOK, vo.SuccessRespBase(id))
+	}
+}
+
+// GetStringBatch 获取 count 个kind类型的字符串id，count不能超过接口 <kind>_batch 及业务标签tag的最大数量
+func GetStringBatch(kind string) gin.HandlerFunc {
+	generator := stringIdGenerators[kind]
+	endpoint := kind + "_batch"
+	return func(ctx *gin.Context) {
+		var req BatchRequest
+		if !bindQuery(ctx, &req) {
+			return
+		}
+		if errs := req.validate(endpoint); len(errs) > 0 {
+			respondParamsInvalid(ctx, errs)
+			return
+		}
+		ids, err := generator.GetStringIds(req.count)
+		recordIssued(kind, req.count, err)
+		if err != nil {
+			respondError(ctx, err)
+			return
+		}
+		ctx.JSON(http.StatusOK, vo.SuccessRespBase(ids))
+	}
+}
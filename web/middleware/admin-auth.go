@@ -0,0 +1,32 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"log"
+	"net/http"
+	"sfgo/web/vo"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AdminAuthMiddleware 管理接口认证，并记录操作日志
+//
+// adminToken 返回管理接口的令牌，令牌可以在运行时修改，请求头为 Authorization: Bearer <令牌>，为空时禁用管理接口
+func AdminAuthMiddleware(adminToken func() string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		adminToken := adminToken()
+		if adminToken == "" {
+			c.AbortWithStatusJSON(http.StatusForbidden, vo.ForbiddenRespBase("admin api is disabled, set ADMIN_TOKEN to enable it"))
+			return
+		}
+		token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) != 1 {
+			log.Printf("admin auth failed. %s %s from %s", c.Request.Method, c.Request.URL.Path, c.ClientIP())
+			c.AbortWithStatusJSON(http.StatusUnauthorized, vo.UnauthorizedRespBase())
+			return
+		}
+		c.Next()
+		log.Printf("admin %s %s from %s, status: %d", c.Request.Method, c.Request.URL.String(), c.ClientIP(), c.Writer.Status())
+	}
+}
@@ -6,8 +6,11 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"sfgo/config"
 	"sfgo/web/handler/actuator"
+	"sfgo/web/handler/admin"
 	"sfgo/web/handler/id"
+	"sfgo/web/middleware"
 	"syscall"
 	"time"
 
@@ -17,12 +20,14 @@ import (
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
-func routerInit(r *gin.Engine) {
+func routerInit(r *gin.Engine, m *config.Manager) {
 	r.GET("/health", actuator.Health)
 	// 监控
 	groupActuator := r.Group("/actuator")
 	{
 		groupActuator.GET("/health", actuator.Health)
+		groupActuator.GET("/readiness", actuator.Readiness)
+		groupActuator.GET("/info", actuator.Info)
 		groupActuator.GET("/metrics", ginprom.PromHandler(promhttp.Handler()))
 	}
 	// id组
@@ -31,19 +36,52 @@ func routerInit(r *gin.Engine) {
 		groupId.GET("/get", id.GetOne)
 		// 获取多个id
 		groupId.GET("/batch", id.GetBatch)
+		// 时间范围内的id范围
+		groupId.GET("/range", id.GetRange)
+		// 解析十进制、base62、base32、base58形式的id
+		groupId.GET("/parse", id.GetParse)
+		// 不超过 2^53-1 的数字id
+		groupId.GET("/js/get", id.GetJsSafeOne)
+		groupId.GET("/js/batch", id.GetJsSafeBatch)
+		// 字符串id，按字符串排序单调递增，不依赖workerId
+		groupId.GET("/uuid7", id.GetStringOne("uuid7"))
+		groupId.GET("/uuid7/batch", id.GetStringBatch("uuid7"))
+		groupId.GET("/ulid", id.GetStringOne("ulid"))
+		groupId.GET("/ulid/batch", id.GetStringBatch("ulid"))
+		groupId.GET("/ksuid", id.GetStringOne("ksuid"))
+		groupId.GET("/ksuid/batch", id.GetStringBatch("ksuid"))
+	}
+	// 管理接口，需要认证
+	groupAdmin := r.Group("/admin", middleware.AdminAuthMiddleware(func() string {
+		return m.Current().Server.AdminToken
+	}))
+	{
+		groupAdmin.GET("/workers", admin.ListWorkers)
+		groupAdmin.DELETE("/workers/allocations/:workerId", admin.ReleaseWorker)
+		groupAdmin.PUT("/workers/reservations/:workerId", admin.ReserveWorker)
+		groupAdmin.DELETE("/workers/reservations/:workerId", admin.UnreserveWorker)
+		groupAdmin.GET("/config", admin.GetConfig)
 	}
 }
 
-func Run(ip, port string) {
+// Run 启动Web服务，收到SIGINT、SIGTERM后停止，配置重新加载后应用到id接口
+func Run(m *config.Manager) {
+	cfg := m.Current()
+	// id生成器初始化
+	id.Init(cfg.Id, cfg.Server.Port, cfg.AppName)
+	admin.Init(id.Generator(), m)
+	m.OnReload(func(c *config.Config) {
+		id.Reconfigure(c.Id)
+	})
 	// Web服务初始化
 	r := gin.Default()
 	// 增加promethues指标导出中间件
 	r.Use(ginprom.PromMiddleware(nil))
 	//路由初始化
-	routerInit(r)
+	routerInit(r, m)
 	// 启动
 	srv := &http.Server{
-		Addr:    ip + ":" + port,
+		Addr:    ":" + cfg.Server.Port,
 		Handler: r,
 	}
 	go func() {
@@ -64,8 +102,10 @@ func Run(ip, port string) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 	if err := srv.Shutdown(ctx); err != nil {
-		log.Fatal("Server Shutdown:", err)
+		log.Println("Server Shutdown:", err)
 	}
+	// 不再处理请求后，停止发放id，上报最后的时间戳并释放workerId，关闭失败时也需要释放
+	id.Close()
 	// catching ctx.Done(). timeout of 5 seconds.
 	<-ctx.Done()
 	log.Println("Server exiting.")
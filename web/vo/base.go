@@ -2,6 +2,16 @@ package vo
 
 import (
 	"fmt"
+	"net/http"
+	"strings"
+)
+
+// 接口层的错误码，id生成失败的错误码见 core.ErrCodeClockBackwards 等
+const (
+	// ErrCodeInvalidParam 参数无效
+	ErrCodeInvalidParam = "INVALID_PARAM"
+	// ErrCodeInternal 未知错误
+	ErrCodeInternal = "INTERNAL_ERROR"
 )
 
 type RespBase[T any] struct {
@@ -9,7 +19,9 @@ type RespBase[T any] struct {
 	Msg        string `json:"msg"`
 	ResultCode int    `json:"resultcode"`
 	ResultMsg  string `json:"resultmsg"`
-	Data       T      `json:"data"`
+	// 失败时的错误码，值不会变化，供调用方判断失败的原因
+	ErrorCode string `json:"errorCode,omitempty"`
+	Data      T      `json:"data"`
 }
 
 // SuccessRespBase 业务成功
@@ -30,6 +42,30 @@ func ParamInvalidRespBase(paramName string) RespBase[string] {
 		Msg:        fmt.Sprintf("参数错误: %s", paramName),
 		ResultCode: 0,
 		ResultMsg:  "业务失败",
+		ErrorCode:  ErrCodeInvalidParam,
+	}
+}
+
+// FieldError 参数无效的原因
+type FieldError struct {
+	// 参数名称
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// InvalidParamsRespBase 参数无效，code为HTTP状态码，data为各参数无效的原因
+func InvalidParamsRespBase(code int, errs []FieldError) RespBase[[]FieldError] {
+	messages := make([]string, 0, len(errs))
+	for _, e := range errs {
+		messages = append(messages, e.Message)
+	}
+	return RespBase[[]FieldError]{
+		Code:       code,
+		Msg:        strings.ToLower(http.StatusText(code)),
+		ResultCode: 0,
+		ResultMsg:  strings.Join(messages, "; "),
+		ErrorCode:  ErrCodeInvalidParam,
+		Data:       errs,
 	}
 }
 
@@ -42,3 +78,34 @@ func BusinessFailedRespBase(resultMsg string) RespBase[string] {
 		ResultMsg:  resultMsg,
 	}
 }
+
+// ErrorRespBase 失败，code为HTTP状态码，errorCode为错误码
+func ErrorRespBase(code int, errorCode, resultMsg string) RespBase[string] {
+	return RespBase[string]{
+		Code:       code,
+		Msg:        strings.ToLower(http.StatusText(code)),
+		ResultCode: 0,
+		ResultMsg:  resultMsg,
+		ErrorCode:  errorCode,
+	}
+}
+
+// UnauthorizedRespBase 未认证
+func UnauthorizedRespBase() RespBase[string] {
+	return RespBase[string]{
+		Code:       401,
+		Msg:        "unauthorized",
+		ResultCode: 0,
+		ResultMsg:  "认证失败",
+	}
+}
+
+// ForbiddenRespBase 禁止访问
+func ForbiddenRespBase(resultMsg string) RespBase[string] {
+	return RespBase[string]{
+		Code:       403,
+		Msg:        "forbidden",
+		ResultCode: 0,
+		ResultMsg:  resultMsg,
+	}
+}